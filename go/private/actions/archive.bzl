@@ -37,7 +37,7 @@ load(
     "cgo_configure",
 )
 
-def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_deps = None, is_external_pkg = False):
+def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_deps = None, is_external_pkg = False, _vet_nogo = None):
     """See go/toolchains.rst#archive for full documentation."""
 
     if source == None:
@@ -64,10 +64,35 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
         out_facts = go.declare_file(go, name = source.name, ext = pre_ext + ".facts")
         out_nogo_log = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo.log")
         out_nogo_validation = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo")
+        out_nogo_fix = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo.patch")
+        out_nogo_json = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo.json")
+        out_nogo_sarif = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo.sarif")
+        if go.mode.nogo_profile:
+            out_nogo_profile = go.declare_file(go, name = source.name, ext = pre_ext + ".nogo.profile.json")
+        else:
+            out_nogo_profile = None
     else:
         out_facts = None
         out_nogo_log = None
         out_nogo_validation = None
+        out_nogo_fix = None
+        out_nogo_json = None
+        out_nogo_sarif = None
+        out_nogo_profile = None
+
+    # _vet_nogo runs the vet analyzers of go test, independently of nogo.
+    if _vet_nogo:
+        vet = struct(
+            nogo = _vet_nogo,
+            out_facts = go.declare_file(go, name = source.name, ext = pre_ext + ".vet.facts"),
+            out_log = go.declare_file(go, name = source.name, ext = pre_ext + ".vet.log"),
+            out_validation = go.declare_file(go, name = source.name, ext = pre_ext + ".vet"),
+            out_fix = go.declare_file(go, name = source.name, ext = pre_ext + ".vet.patch"),
+            out_json = go.declare_file(go, name = source.name, ext = pre_ext + ".vet.json"),
+            out_sarif = go.declare_file(go, name = source.name, ext = pre_ext + ".vet.sarif"),
+        )
+    else:
+        vet = None
 
     direct = source.deps
 
@@ -113,7 +138,12 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
             out_facts = out_facts,
             out_nogo_log = out_nogo_log,
             out_nogo_validation = out_nogo_validation,
+            out_nogo_fix = out_nogo_fix,
+            out_nogo_json = out_nogo_json,
+            out_nogo_sarif = out_nogo_sarif,
+            out_nogo_profile = out_nogo_profile,
             nogo = nogo,
+            _vet = vet,
             out_cgo_export_h = out_cgo_export_h,
             gc_goopts = source.gc_goopts,
             cgo = True,
@@ -142,7 +172,12 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
             out_facts = out_facts,
             out_nogo_log = out_nogo_log,
             out_nogo_validation = out_nogo_validation,
+            out_nogo_fix = out_nogo_fix,
+            out_nogo_json = out_nogo_json,
+            out_nogo_sarif = out_nogo_sarif,
+            out_nogo_profile = out_nogo_profile,
             nogo = nogo,
+            _vet = vet,
             gc_goopts = source.gc_goopts,
             cgo = False,
             testfilter = testfilter,
@@ -185,6 +220,11 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
         facts_file = out_facts,
         runfiles = source.runfiles,
         _validation_output = out_nogo_validation,
+        _nogo_fix_output = out_nogo_fix,
+        _nogo_findings_outputs = (out_nogo_json, out_nogo_sarif) if nogo else (),
+        _nogo_profile_output = out_nogo_profile,
+        _vet_facts_file = vet.out_facts if vet else None,
+        _vet_validation_output = vet.out_validation if vet else None,
         _cgo_deps = cgo_deps,
     )
     x_defs = dict(source.x_defs)
@@ -206,4 +246,6 @@ def emit_archive(go, source = None, _recompile_suffix = "", recompile_internal_d
         cgo_deps = depset(transitive = [cgo_deps] + [a.cgo_deps for a in direct]),
         cgo_exports = cgo_exports,
         runfiles = runfiles,
+        # The transitive set of covered source files.
+        _cover = depset(transitive = [source.cover] + [a._cover for a in direct]),
     )
@@ -13,12 +13,23 @@
 # limitations under the License.
 
 load("//go/private:common.bzl", "GO_TOOLCHAIN_LABEL", "SUPPORTS_PATH_MAPPING_REQUIREMENT")
+load("//go/private:sdk.bzl", "parse_version")
 load(
     "//go/private:mode.bzl",
     "link_mode_arg",
 )
 load("//go/private/actions:utils.bzl", "quote_opts")
 
+# The test infrastructure of rules_go isn't instrumented for fuzzing, like the
+# testing package with 'go test -fuzz', since its coverage would mislead the
+# fuzzing engine. Neither are main packages without an import path, like the
+# generated main package of tests.
+_FUZZ_UNINSTRUMENTED_IMPORTPATHS = [
+    "github.com/bazelbuild/rules_go/go/tools/bzltestutil",
+    "github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir",
+    "github.com/bazelbuild/rules_go/go/tools/coverdata",
+]
+
 def _archive(v):
     importpaths = [v.data.importpath]
     importpaths.extend(v.data.importpath_aliases)
@@ -29,7 +40,12 @@ def _archive(v):
     )
 
 def _facts(v):
-    facts_file = v.data.facts_file
+    return _facts_arg(v, v.data.facts_file)
+
+def _vet_facts(v):
+    return _facts_arg(v, getattr(v.data, "_vet_facts_file", None))
+
+def _facts_arg(v, facts_file):
     if not facts_file:
         return None
     importpaths = [v.data.importpath]
@@ -70,7 +86,12 @@ def emit_compilepkg(
         out_facts = None,
         out_nogo_log = None,
         out_nogo_validation = None,
+        out_nogo_fix = None,
+        out_nogo_json = None,
+        out_nogo_sarif = None,
+        out_nogo_profile = None,
         nogo = None,
+        _vet = None,
         out_cgo_export_h = None,
         gc_goopts = [],
         testfilter = None,  # TODO: remove when test action compiles packages
@@ -89,10 +110,28 @@ def emit_compilepkg(
         fail("nogo must be specified if and only if out_nogo_log is specified")
     if have_nogo != (out_nogo_validation != None):
         fail("nogo must be specified if and only if out_nogo_validation is specified")
+    if have_nogo != (out_nogo_fix != None):
+        fail("nogo must be specified if and only if out_nogo_fix is specified")
+    if have_nogo != (out_nogo_json != None):
+        fail("nogo must be specified if and only if out_nogo_json is specified")
+    if have_nogo != (out_nogo_sarif != None):
+        fail("nogo must be specified if and only if out_nogo_sarif is specified")
+    if out_nogo_profile and not have_nogo:
+        fail("nogo must be specified if out_nogo_profile is specified")
 
-    if cover and go.coverdata:
+    native_coverage = go.mode.native_coverage and go.coverage_enabled
+    if native_coverage:
+        version = parse_version(go.sdk.version)
+        if version and version[0] <= 1 and version[1] < 20:
+            fail("native_coverage requires Go 1.20 or later, got {}".format(go.sdk.version))
+    elif cover and go.coverdata:
         archives = archives + [go.coverdata]
 
+    if go.mode.fuzz:
+        version = parse_version(go.sdk.version)
+        if version and version[0] <= 1 and version[1] < 18:
+            fail("fuzz requires Go 1.18 or later, got {}".format(go.sdk.version))
+
     sdk = go.sdk
     inputs_direct = (sources + embedsrcs + [sdk.package_list] +
                      [archive.data.export_file for archive in archives])
@@ -119,7 +158,14 @@ def emit_compilepkg(
         expand_directories = False,
     )
 
-    if cover and go.coverdata:
+    if native_coverage:
+        # Main packages are instrumented even without covered files so that
+        # they initialize the coverage runtime. The coverage mode is not
+        # passed to nogo, which analyzes the original sources.
+        compile_args.add("-cover_mode", "atomic" if go.mode.race else "set")
+        compile_args.add("-cover_native")
+        compile_args.add_all(cover, before_each = "-cover")
+    elif cover and go.coverdata:
         if go.mode.race:
             cover_mode = "atomic"
         else:
@@ -154,6 +200,9 @@ def emit_compilepkg(
         gc_flags.append("-race")
     if go.mode.msan:
         gc_flags.append("-msan")
+    if go.mode.fuzz and importpath not in _FUZZ_UNINSTRUMENTED_IMPORTPATHS and (importpath or importmap != "main"):
+        # Coverage instrumentation used by the fuzzing engine of Go 1.18+.
+        gc_flags.append("-d=libfuzzer")
     if go.mode.debug:
         gc_flags.extend(["-N", "-l"])
     gc_flags.extend(go.toolchain.flags.compile)
@@ -175,7 +224,7 @@ def emit_compilepkg(
         execution_requirements = SUPPORTS_PATH_MAPPING_REQUIREMENT
     cgo_go_srcs_for_nogo = None
     if cgo:
-        if nogo:
+        if nogo or _vet:
             cgo_go_srcs_for_nogo = go.declare_directory(go, path = out_lib.basename + ".cgo")
             outputs.append(cgo_go_srcs_for_nogo)
             compile_args.add("-cgo_go_srcs", cgo_go_srcs_for_nogo.path)
@@ -220,9 +269,33 @@ def emit_compilepkg(
             out_facts = out_facts,
             out_log = out_nogo_log,
             out_validation = out_nogo_validation,
+            out_fix = out_nogo_fix,
+            out_json = out_nogo_json,
+            out_sarif = out_nogo_sarif,
+            out_profile = out_nogo_profile,
             nogo = nogo,
         )
 
+    # The vet analyzers of go test run separately from nogo, since nogo may not
+    # include them. Their facts are only exchanged with other vet runs.
+    if _vet:
+        _run_nogo(
+            go,
+            shared_args = shared_args,
+            sources = sources,
+            cgo_go_srcs = cgo_go_srcs_for_nogo,
+            archives = archives,
+            out_facts = _vet.out_facts,
+            out_log = _vet.out_log,
+            out_validation = _vet.out_validation,
+            out_fix = _vet.out_fix,
+            out_json = _vet.out_json,
+            out_sarif = _vet.out_sarif,
+            out_profile = None,
+            nogo = _vet.nogo,
+            vet = True,
+        )
+
 def _run_nogo(
         go,
         shared_args,
@@ -233,24 +306,41 @@ def _run_nogo(
         out_facts,
         out_log,
         out_validation,
-        nogo):
-    """Runs nogo on Go source files, including those generated by cgo."""
+        out_fix,
+        out_json,
+        out_sarif,
+        out_profile,
+        nogo,
+        vet = False):
+    """Runs nogo on Go source files, including those generated by cgo.
+
+    If vet is set, nogo runs the vet analyzers of go test, using the facts of
+    the vet runs of the dependencies.
+    """
     sdk = go.sdk
+    facts_field, facts, name = ("_vet_facts_file", _vet_facts, "vet") if vet else ("facts_file", _facts, "nogo")
 
+    facts_files = [getattr(archive.data, facts_field, None) for archive in archives]
     inputs_direct = (sources + [nogo, sdk.package_list] +
-                     [archive.data.facts_file for archive in archives if archive.data.facts_file] +
+                     [facts_file for facts_file in facts_files if facts_file] +
                      [archive.data.export_file for archive in archives])
     inputs_transitive = [sdk.tools, sdk.headers, go.stdlib.libs]
-    outputs = [out_facts, out_log]
+    outputs = [out_facts, out_log, out_fix, out_json, out_sarif]
 
     nogo_args = go.tool_args(go)
     if cgo_go_srcs:
         inputs_direct.append(cgo_go_srcs)
-        nogo_args.add_all([cgo_go_srcs], before_each = "-ignore_src")
+        nogo_args.add_all([cgo_go_srcs], before_each = "-generated_src")
 
-    nogo_args.add_all(archives, before_each = "-facts", map_each = _facts)
+    nogo_args.add_all(archives, before_each = "-facts", map_each = facts)
     nogo_args.add("-out_facts", out_facts)
     nogo_args.add("-out_log", out_log)
+    nogo_args.add("-out_fix", out_fix)
+    nogo_args.add("-out_json", out_json)
+    nogo_args.add("-out_sarif", out_sarif)
+    if out_profile:
+        outputs.append(out_profile)
+        nogo_args.add("-out_profile", out_profile)
     nogo_args.add("-nogo", nogo)
 
     # This action runs nogo and produces the facts files for downstream nogo actions.
@@ -269,7 +359,7 @@ def _run_nogo(
         env = go.env_for_path_mapping,
         toolchain = GO_TOOLCHAIN_LABEL,
         execution_requirements = SUPPORTS_PATH_MAPPING_REQUIREMENT,
-        progress_message = "Running nogo on %{label}",
+        progress_message = "Running %s on %%{label}" % name,
     )
 
     # This is a separate action that produces the validation output registered with Bazel. It
@@ -279,12 +369,14 @@ def _run_nogo(
     validation_args.add("nogovalidation")
     validation_args.add(out_validation)
     validation_args.add(out_log)
+    validation_args.add(out_fix)
+    validation_args.add(out_json)
     go.actions.run(
-        inputs = [out_log],
+        inputs = [out_log, out_fix, out_json],
         outputs = [out_validation],
         mnemonic = "ValidateNogo",
         executable = go.toolchain._builder,
         arguments = [validation_args],
         execution_requirements = SUPPORTS_PATH_MAPPING_REQUIREMENT,
-        progress_message = "Validating nogo output for %{label}",
+        progress_message = "Validating %s output for %%{label}" % name,
     )
@@ -453,6 +453,10 @@ default_go_config_info = GoConfigInfo(
     amd64 = None,
     arm = None,
     pgoprofile = None,
+    nogo_profile = False,
+    native_coverage = False,
+    fuzz = False,
+    test_vet = False,
 )
 
 def go_context(
@@ -1001,6 +1005,10 @@ def _go_config_impl(ctx):
         amd64 = ctx.attr.amd64,
         arm = ctx.attr.arm,
         pgoprofile = pgoprofile,
+        nogo_profile = ctx.attr.nogo_profile[BuildSettingInfo].value,
+        native_coverage = ctx.attr.native_coverage[BuildSettingInfo].value,
+        fuzz = ctx.attr.fuzz[BuildSettingInfo].value,
+        test_vet = ctx.attr.test_vet[BuildSettingInfo].value,
     )
     validate_mode(go_config_info)
 
@@ -1057,6 +1065,22 @@ go_config = rule(
             mandatory = True,
             allow_files = True,
         ),
+        "nogo_profile": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "native_coverage": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "fuzz": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "test_vet": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
     },
     provides = [GoConfigInfo],
     doc = """Collects information about build settings in the current
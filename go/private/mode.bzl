@@ -38,6 +38,11 @@ LINKMODES_REQUIRING_EXTERNAL_LINKING = [
     LINKMODE_C_SHARED,
 ]
 
+# Platforms supporting coverage-guided fuzzing, like in 'go test -fuzz'.
+FUZZ_GOOSES = ["darwin", "freebsd", "linux", "openbsd", "windows"]
+
+FUZZ_GOARCHES = ["amd64", "arm64"]
+
 def mode_string(mode):
     result = [mode.goos, mode.goarch]
     if mode.static:
@@ -68,6 +73,10 @@ def validate_mode(mode):
         if mode.linkmode in LINKMODES_REQUIRING_EXTERNAL_LINKING and mode.goos != "wasip1":
             fail(("linkmode '{}' can't be used when cgo is disabled. Check that pure is not set to \"off\" and that a C/C++ toolchain is configured for " +
                   "your current platform. If you defined a custom platform, make sure that it has the @io_bazel_rules_go//go/toolchain:cgo_on constraint value.").format(mode.linkmode))
+    if mode.native_coverage and mode.cover_format != "lcov":
+        fail("native_coverage only supports the lcov cover_format, got '{}'".format(mode.cover_format))
+    if mode.fuzz and (mode.goarch not in FUZZ_GOARCHES or mode.goos not in FUZZ_GOOSES):
+        fail("fuzz instrumentation is not supported on {}_{}".format(mode.goos, mode.goarch))
 
 def installsuffix(mode):
     s = mode.goos + "_" + mode.goarch
@@ -152,6 +152,7 @@ def _go_binary_impl(ctx):
         executable = executable,
     )
     validation_output = archive.data._validation_output
+    nogo_fix_output = archive.data._nogo_fix_output
 
     providers = [
         archive,
@@ -159,6 +160,9 @@ def _go_binary_impl(ctx):
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
             _validation = [validation_output] if validation_output else [],
+            nogo_fix = [nogo_fix_output] if nogo_fix_output else [],
+            nogo_findings = list(archive.data._nogo_findings_outputs),
+            nogo_profile = [archive.data._nogo_profile_output] if archive.data._nogo_profile_output else [],
         ),
     ]
 
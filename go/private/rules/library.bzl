@@ -49,6 +49,7 @@ def _go_library_impl(ctx):
     go_info = new_go_info(go, ctx.attr)
     archive = go.archive(go, go_info)
     validation_output = archive.data._validation_output
+    nogo_fix_output = archive.data._nogo_fix_output
 
     return [
         go_info,
@@ -66,6 +67,9 @@ def _go_library_impl(ctx):
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
             _validation = [validation_output] if validation_output else [],
+            nogo_fix = [nogo_fix_output] if nogo_fix_output else [],
+            nogo_findings = list(archive.data._nogo_findings_outputs),
+            nogo_profile = [archive.data._nogo_profile_output] if archive.data._nogo_profile_output else [],
         ),
     ]
 
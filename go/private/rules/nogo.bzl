@@ -45,6 +45,8 @@ def _nogo_impl(ctx):
     nogo_args.add("-output", nogo_main)
     if ctx.attr.debug:
         nogo_args.add("-debug")
+    if ctx.attr.strict_nolint:
+        nogo_args.add("-strict_nolint")
     nogo_inputs = []
     analyzer_archives = [dep[GoArchive] for dep in ctx.attr.deps]
     analyzer_importpaths = [archive.data.importpath for archive in analyzer_archives]
@@ -52,6 +54,9 @@ def _nogo_impl(ctx):
     if ctx.file.config:
         nogo_args.add("-config", ctx.file.config)
         nogo_inputs.append(ctx.file.config)
+    if ctx.file.baseline:
+        nogo_args.add("-baseline", ctx.file.baseline)
+        nogo_inputs.append(ctx.file.baseline)
     ctx.actions.run(
         inputs = nogo_inputs,
         outputs = [nogo_main],
@@ -94,9 +99,15 @@ _nogo = rule(
         "config": attr.label(
             allow_single_file = True,
         ),
+        "baseline": attr.label(
+            allow_single_file = True,
+        ),
         "debug": attr.bool(
             default = False,
         ),
+        "strict_nolint": attr.bool(
+            default = False,
+        ),
         "_nogo_srcs": attr.label(
             default = "//go/tools/builders:nogo_srcs",
         ),
@@ -138,6 +149,35 @@ def nogo(name, visibility = None, **kwargs):
         **kwargs
     )
 
+# The analyzers that `go test` runs with `go vet` before running tests.
+GO_TEST_VET_ANALYZERS = [
+    Label("@org_golang_x_tools//go/analysis/passes/atomic:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/bools:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/buildtag:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/directive:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/errorsas:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/ifaceassert:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/nilfunc:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/printf:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/stringintconv:go_default_library"),
+    Label("@org_golang_x_tools//go/analysis/passes/tests:go_default_library"),
+]
+
+def go_test_vet_nogo(name, **kwargs):
+    """Declares the nogo binary that go_test runs on the test packages with vet.
+
+    Unlike nogo, the binary isn't aliased to a no-op: go_test only depends on it
+    when vet is enabled, see //go/private:go_test_vet.
+    """
+    kwargs.setdefault("tags", [])
+    if "manual" not in kwargs["tags"]:
+        kwargs["tags"].append("manual")
+    _nogo(
+        name = name,
+        deps = GO_TEST_VET_ANALYZERS,
+        **kwargs
+    )
+
 def nogo_wrapper(**kwargs):
     if kwargs.get("vet"):
         kwargs["deps"] = kwargs.get("deps", []) + [
@@ -51,6 +51,15 @@ load(
     "go_transition",
 )
 
+def _go_test_vet(vet):
+    if vet == "on":
+        return Label("//:go_test_vet")
+    if vet == "auto":
+        # Resolves to a no-op unless --@io_bazel_rules_go//go/config:test_vet
+        # is set.
+        return Label("//go/private:go_test_vet")
+    return None
+
 def _go_test_impl(ctx):
     """go_test_impl implements go testing.
 
@@ -69,6 +78,11 @@ def _go_test_impl(ctx):
     )
 
     validation_outputs = []
+    nogo_fix_outputs = []
+
+    # The vet analyzers only run on the test packages, besides nogo, which may
+    # not include them.
+    vet_nogo = ctx.files._go_test_vet[0] if ctx.files._go_test_vet else None
 
     # Compile the library to test with internal white box tests
     internal_go_info = new_go_info(
@@ -76,9 +90,13 @@ def _go_test_impl(ctx):
         ctx.attr,
         testfilter = "exclude",
     )
-    internal_archive = go.archive(go, internal_go_info)
+    internal_archive = go.archive(go, internal_go_info, _vet_nogo = vet_nogo)
     if internal_archive.data._validation_output:
         validation_outputs.append(internal_archive.data._validation_output)
+    if internal_archive.data._vet_validation_output:
+        validation_outputs.append(internal_archive.data._vet_validation_output)
+    if internal_archive.data._nogo_fix_output:
+        nogo_fix_outputs.append(internal_archive.data._nogo_fix_output)
     go_srcs = [src for src in internal_go_info.srcs if src.extension == "go"]
 
     # Compile the library with the external black box tests
@@ -96,9 +114,13 @@ def _go_test_impl(ctx):
         testfilter = "only",
     )
     external_go_info, internal_archive = _recompile_external_deps(go, external_go_info, internal_archive, [t.label for t in ctx.attr.embed])
-    external_archive = go.archive(go, external_go_info, is_external_pkg = True)
+    external_archive = go.archive(go, external_go_info, is_external_pkg = True, _vet_nogo = vet_nogo)
     if external_archive.data._validation_output:
         validation_outputs.append(external_archive.data._validation_output)
+    if external_archive.data._vet_validation_output:
+        validation_outputs.append(external_archive.data._vet_validation_output)
+    if external_archive.data._nogo_fix_output:
+        nogo_fix_outputs.append(external_archive.data._nogo_fix_output)
 
     # now generate the main function
     repo_relative_rundir = ctx.attr.rundir or ctx.label.package or "."
@@ -114,12 +136,15 @@ def _go_test_impl(ctx):
     main_go = go.declare_file(go, path = "testmain.go")
     arguments = go.builder_args(go, "gentestmain", use_path_mapping = True)
     arguments.add("-output", main_go)
-    if go.coverage_enabled:
+    if go.coverage_enabled and not go.mode.native_coverage:
         if go.mode.race:
             arguments.add("-cover_mode", "atomic")
         else:
             arguments.add("-cover_mode", "set")
         arguments.add("-cover_format", go.mode.cover_format)
+    if go.mode.fuzz:
+        # Crashers are written to the source tree when fuzzing with bazel run.
+        arguments.add("-fuzz")
     arguments.add(
         # the l is the alias for the package under test, the l_test must be the
         # same with the test suffix
@@ -161,9 +186,21 @@ def _go_test_impl(ctx):
     # for more details.
     test_gc_linkopts.extend(["-X", "testing.testBinary=1"])
 
+    # Link in the shard strategy for bzltestutil.
+    if ctx.file.shard_timings and ctx.attr.shard_strategy != "duration":
+        fail("shard_timings requires shard_strategy = \"duration\"")
+    test_gc_linkopts.extend(["-X", "github.com/bazelbuild/rules_go/go/tools/bzltestutil.shardStrategy=" + ctx.attr.shard_strategy])
+    if ctx.file.shard_timings:
+        test_gc_linkopts.extend(["-X", "github.com/bazelbuild/rules_go/go/tools/bzltestutil.shardTimings=" + ctx.file.shard_timings.short_path])
+
+    # With native coverage, the covered packages, including those of binaries
+    # run by the test, write covdata files, which bzltestutil converts to lcov.
+    if go.coverage_enabled and go.mode.native_coverage:
+        test_gc_linkopts.extend(["-X", "github.com/bazelbuild/rules_go/go/tools/bzltestutil.nativeCoverage=1"])
+
     # Now compile the test binary itself
     test_deps = external_archive.direct + [external_archive] + ctx.attr._testmain_additional_deps
-    if go.coverage_enabled:
+    if go.coverage_enabled and not go.mode.native_coverage:
         test_deps.append(go.coverdata)
     test_go_info = new_go_info(
         go,
@@ -187,6 +224,18 @@ def _go_test_impl(ctx):
         info_file = ctx.info_file,
     )
 
+    if ctx.file.shard_timings:
+        runfiles = runfiles.merge(ctx.runfiles([ctx.file.shard_timings]))
+
+    # The lcov converter in bzltestutil parses the covered sources to find
+    # their functions, including those of binaries run by the test.
+    if go.coverage_enabled and go.mode.cover_format == "lcov":
+        covered_archives = [test_archive] + [d[GoArchive] for d in ctx.attr.data if GoArchive in d]
+        runfiles = runfiles.merge(ctx.runfiles(transitive_files = depset(transitive = [
+            archive._cover
+            for archive in covered_archives
+        ])))
+
     env = {}
     for k, v in ctx.attr.env.items():
         env[k] = ctx.expand_location(v, ctx.attr.data)
@@ -208,6 +257,14 @@ def _go_test_impl(ctx):
         OutputGroupInfo(
             compilation_outputs = [internal_archive.data.file],
             _validation = validation_outputs,
+            nogo_fix = nogo_fix_outputs,
+            nogo_findings = list(internal_archive.data._nogo_findings_outputs) +
+                            list(external_archive.data._nogo_findings_outputs),
+            nogo_profile = [
+                archive.data._nogo_profile_output
+                for archive in (internal_archive, external_archive)
+                if archive.data._nogo_profile_output
+            ],
         ),
         coverage_common.instrumented_files_info(
             ctx,
@@ -315,6 +372,28 @@ _go_test_kwargs = {
             the main repository.
             """,
         ),
+        "shard_strategy": attr.string(
+            default = "index",
+            values = ["index", "hash", "duration"],
+            doc = """Determines how tests, benchmarks, fuzz targets, and examples are
+            distributed when the test is sharded with `shard_count`.
+            <br><br>
+            <ul>
+            <li>`index` (default): Distributes them round-robin in the order they are defined.</li>
+            <li>`hash`: Distributes them by a hash of their name, so that adding or removing
+            a test does not move other tests to a different shard.</li>
+            <li>`duration`: Balances the shards by the durations in `shard_timings`.</li>
+            </ul>
+            """,
+        ),
+        "shard_timings": attr.label(
+            allow_single_file = True,
+            doc = """The `test.xml` of a previous run of this test, which is used to balance
+            the shards if `shard_strategy` is `duration`. For a sharded test, the
+            `test.xml` files of all shards may be concatenated into a single file.
+            Tests not contained in the file are assumed to take the average time.
+            """,
+        ),
         "x_defs": attr.string_dict(
             doc = """Map of defines to add to the go link command.
             See [Defines and stamping] for examples of how to use these.
@@ -441,7 +520,23 @@ _go_test_kwargs = {
             See [Cross compilation] for more information.
             """,
         ),
+        "vet": attr.string(
+            default = "auto",
+            values = ["on", "off", "auto"],
+            doc = """Controls whether the analyzers that `go test` runs with `go vet` (atomic,
+            bools, buildtag, directive, errorsas, ifaceassert, nilfunc, printf,
+            stringintconv and tests) are run on the test packages as a validation action.
+            May be one of `on`, `off`, or `auto`. If `auto`, they are run when
+            `--@io_bazel_rules_go//go/config:test_vet` is set. They run in addition
+            to [nogo], whether or not it includes them.
+            """,
+        ),
         "_go_context_data": attr.label(default = "//:go_context_data", cfg = go_transition),
+        # The nogo binary running the vet analyzers, or a no-op, depending on vet.
+        "_go_test_vet": attr.label(
+            default = _go_test_vet,
+            cfg = "exec",
+        ),
         "_testmain_additional_deps": attr.label_list(
             providers = [GoInfo],
             default = ["//go/tools/bzltestutil"],
@@ -493,6 +588,38 @@ _go_test_kwargs = {
     the testbinary can be invoked with `-test.v` by setting
     `GO_TEST_WRAP_TESTV=1` in the test environment; this will result in the
     `XML_OUTPUT_FILE` containing more granular data.<br><br>
+    For test impact analysis, `bazel coverage` can record the lines covered by
+    each top-level test function by setting `GO_TEST_COVERAGE_PER_TEST=1` in
+    the test environment. The test then writes `go_test_coverage.jsonl` to its
+    undeclared outputs, with one JSON object per test of the form
+    `{"Test": "TestFoo", "Files": {"path/to/file.go": [3, 4, 5]}}`. Tests that
+    ran at the same time as others, like parallel tests, also have
+    `"Overlapped": true`, since their lines include those of the other tests.
+    This is not supported with native coverage.<br><br>
+    Instead of rerunning the whole test binary with `--flaky_test_attempts`,
+    the failed top-level tests can be rerun in a new process up to N times by
+    setting `GO_TEST_RETRIES=N` in the test environment. Tests that pass when
+    retried are reported with a `flakyFailure` for each failed attempt in the
+    `XML_OUTPUT_FILE`, and tests that fail every attempt with a `rerunFailure`.<br><br>
+    Profiles can be collected by setting `GO_TEST_PROFILES` in the test
+    environment to a comma-separated list of `cpu`, `mem`, `block`, `mutex`
+    and `trace`, e.g. `--test_env=GO_TEST_PROFILES=cpu,mem`. The profiles are
+    written to the undeclared outputs of the test together with a copy of the
+    test binary, so `go tool pprof` can be run directly on the extracted
+    `outputs.zip`.<br><br>
+    When a test times out, the goroutines of the test binary are dumped to the
+    test log and to `goroutines.txt` in the undeclared outputs of the test,
+    and the tests that were still running are reported as timed out with their
+    partial output in the `XML_OUTPUT_FILE`.<br><br>
+    The events of the test in the format of `go test -json` are streamed to
+    `test2json.json` in the undeclared outputs of the test, from which the
+    `XML_OUTPUT_FILE` is generated. The file is synced after every event, so
+    it also holds the events of a test that is killed. The events of retried
+    tests are appended to the same file.<br><br>
+    In race mode, the reports of the race detector are attributed to the test
+    during which the race was detected, which is reported with an error of type
+    `race` in the `XML_OUTPUT_FILE`. Each report is also written to a file in
+    the `races` directory of the undeclared outputs of the test.<br><br>
     ***Note:*** To interoperate cleanly with old targets generated by [Gazelle], `name`
     should be `go_default_test` for internal tests and
     `go_default_xtest` for external tests. Gazelle now generates
@@ -720,6 +847,7 @@ def _recompile_external_deps(go, external_go_info, internal_archive, library_lab
                 cgo_exports = depset(transitive = [a.cgo_exports for a in deps]),
                 runfiles = go_info.runfiles,
                 mode = go.mode,
+                _cover = depset(transitive = [arc_data._cover] + [a._cover for a in deps]),
             )
         label_to_archive[label] = archive
 
@@ -189,6 +189,8 @@ _common_reset_transition_dict = dict({
     "//go/config:static": False,
     "//go/config:msan": False,
     "//go/config:race": False,
+    "//go/config:fuzz": False,
+    "//go/config:test_vet": False,
     "//go/config:pure": False,
     "//go/config:debug": False,
     "//go/config:linkmode": LINKMODE_NORMAL,
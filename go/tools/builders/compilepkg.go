@@ -43,6 +43,7 @@ func compilePkg(args []string) error {
 	var testFilter string
 	var gcFlags, asmFlags, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags quoteMultiFlag
 	var coverFormat string
+	var coverNative bool
 	var pgoprofile string
 	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and compiled")
 	fs.Var(&coverSrcs, "cover", ".go file that should be instrumented for coverage (must also be a -src)")
@@ -68,6 +69,7 @@ func compilePkg(args []string) error {
 	fs.StringVar(&cgoGoSrcsPath, "cgo_go_srcs", "", "The directory to emit cgo-generated Go sources for nogo consumption to")
 	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
 	fs.StringVar(&coverFormat, "cover_format", "", "Emit source file paths in coverage instrumentation suitable for the specified coverage format")
+	fs.BoolVar(&coverNative, "cover_native", false, "Instrument for the coverage runtime of Go 1.20+, which writes covdata files to GOCOVERDIR, instead of registering with the coverdata package")
 	fs.Var(&recompileInternalDeps, "recompile_internal_deps", "The import path of the direct dependencies that needs to be recompiled.")
 	fs.StringVar(&pgoprofile, "pgoprofile", "", "The pprof profile to consider for profile guided optimization.")
 	if err := fs.Parse(args); err != nil {
@@ -130,6 +132,7 @@ func compilePkg(args []string) error {
 		cgoExportHPath,
 		cgoGoSrcsPath,
 		coverFormat,
+		coverNative,
 		recompileInternalDeps,
 		pgoprofile)
 }
@@ -161,6 +164,7 @@ func compileArchive(
 	cgoExportHPath string,
 	cgoGoSrcsForNogoPath string,
 	coverFormat string,
+	coverNative bool,
 	recompileInternalDeps []string,
 	pgoprofile string,
 ) error {
@@ -244,7 +248,53 @@ func compileArchive(
 	cgoSrcsNogo := append([]string{}, cgoSrcs...)
 
 	// Instrument source files for coverage.
-	if coverMode != "" {
+	if coverMode != "" && coverNative {
+		relCoverPath := make(map[string]string)
+		for _, s := range coverSrcs {
+			relCoverPath[abs(s)] = s
+		}
+
+		combined := append([]string{}, goSrcs...)
+		if cgoEnabled {
+			combined = append(combined, cgoSrcs...)
+		}
+		mode := coverMode
+		var indices []int
+		var srcNames []string
+		for i, origSrc := range combined {
+			// Bazel merges lcov reports across languages and thus assumes
+			// that the source file paths are relative to the exec root.
+			if relPath, ok := relCoverPath[origSrc]; ok {
+				indices = append(indices, i)
+				srcNames = append(srcNames, relPath)
+			}
+		}
+		if len(indices) == 0 && packageName == "main" {
+			// The coverage runtime is only initialized by the main package, so
+			// it has to be registered even if none of its files are covered.
+			mode = "regonly"
+			for i, origSrc := range combined {
+				indices = append(indices, i)
+				srcNames = append(srcNames, origSrc)
+			}
+		}
+
+		if len(indices) > 0 {
+			coverSrcs, coverVarsSrc, coverCfg, err := instrumentPackageForCoverage(goenv, importPath, packageName, srcNames, mode, workDir)
+			if err != nil {
+				return err
+			}
+			for j, i := range indices {
+				if i < len(goSrcs) {
+					goSrcs[i] = coverSrcs[j]
+				} else {
+					cgoSrcs[i-len(goSrcs)] = coverSrcs[j]
+				}
+			}
+			goSrcs = append(goSrcs, coverVarsSrc)
+			gcFlags = append(gcFlags, "-coveragecfg="+coverCfg)
+		}
+	} else if coverMode != "" {
 		relCoverPath := make(map[string]string)
 		for _, s := range coverSrcs {
 			relCoverPath[abs(s)] = s
@@ -331,7 +381,7 @@ func compileArchive(
 		gcFlags = append(gcFlags, createTrimPath(gcFlags, "."))
 	}
 
-	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, workDir)
+	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, coverNative, workDir)
 	if err != nil {
 		return err
 	}
@@ -436,7 +486,7 @@ func compileArchive(
 	return nil
 }
 
-func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, deps []archive, packageListPath string, recompileInternalDeps []string, compilingWithCgo bool, coverMode string, workDir string) (string, error) {
+func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, deps []archive, packageListPath string, recompileInternalDeps []string, compilingWithCgo bool, coverMode string, coverNative bool, workDir string) (string, error) {
 	// Check that the filtered sources don't import anything outside of
 	// the standard library and the direct dependencies.
 	imports, err := checkImports(srcs.goSrcs, deps, packageListPath, importPath, recompileInternalDeps)
@@ -453,18 +503,24 @@ func checkImportsAndBuildCfg(goenv *env, importPath string, srcs archiveSrcs, de
 		if coverMode == "atomic" {
 			imports["sync/atomic"] = nil
 		}
-		const coverdataPath = "github.com/bazelbuild/rules_go/go/tools/coverdata"
-		var coverdata *archive
-		for i := range deps {
-			if deps[i].importPath == coverdataPath {
-				coverdata = &deps[i]
-				break
+		if coverNative {
+			// Instrumented main packages import the coverage runtime, which
+			// writes the covdata files on exit.
+			imports["runtime/coverage"] = nil
+		} else {
+			const coverdataPath = "github.com/bazelbuild/rules_go/go/tools/coverdata"
+			var coverdata *archive
+			for i := range deps {
+				if deps[i].importPath == coverdataPath {
+					coverdata = &deps[i]
+					break
+				}
 			}
+			if coverdata == nil {
+				return "", errors.New("coverage requested but coverdata dependency not provided")
+			}
+			imports[coverdataPath] = coverdata
 		}
-		if coverdata == nil {
-			return "", errors.New("coverage requested but coverdata dependency not provided")
-		}
-		imports[coverdataPath] = coverdata
 	}
 
 	// Build an importcfg file for the compiler.
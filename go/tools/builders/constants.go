@@ -23,4 +23,18 @@ const (
 	nogoSuccess int = iota
 	nogoError
 	nogoViolation
+	// nogoWarning indicates that all diagnostics were reported by analyzers
+	// with a severity other than severityError, which doesn't fail the build.
+	nogoWarning
 )
+
+// The severities of nogo analyzers that can be set in the config.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// nogoWarningsHeader is the first line of the nogo output if it exits with
+// nogoWarning.
+const nogoWarningsHeader = "warnings found by nogo during build-time code analysis:"
@@ -16,12 +16,16 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"go/parser"
 	"go/token"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // instrumentForCoverage runs "go tool cover" on a source file to produce
@@ -36,6 +40,71 @@ func instrumentForCoverage(goenv *env, srcPath, srcName, coverVar, mode, outPath
 	return registerCoverage(outPath, coverVar, srcName)
 }
 
+// coverPkgConfig is the package configuration read by "go tool cover -pkgcfg",
+// see cmd/internal/cov/covcmd.CoverPkgConfig.
+type coverPkgConfig struct {
+	OutConfig   string
+	PkgPath     string
+	PkgName     string
+	Granularity string
+	ModulePath  string
+	Local       bool
+}
+
+// instrumentPackageForCoverage runs "go tool cover" on all files of a package
+// that should be covered to instrument them for the coverage runtime of
+// Go 1.20+, which writes covdata files to the directory named by GOCOVERDIR.
+// The source files are recorded in the coverage meta-data under the paths
+// passed in srcs, which must be valid relative to the working directory.
+//
+// instrumentPackageForCoverage returns the instrumented files in the order of
+// srcs, an additional file defining the coverage variables, which must be
+// compiled into the package, and the configuration file to be passed to the
+// compiler with -coveragecfg.
+func instrumentPackageForCoverage(goenv *env, importPath, packageName string, srcs []string, mode, workDir string) (coverSrcs []string, coverVarsSrc, coverCfg string, err error) {
+	coverCfg = filepath.Join(workDir, "coveragecfg")
+	pkgCfg, err := json.Marshal(coverPkgConfig{
+		OutConfig:   coverCfg,
+		PkgPath:     importPath,
+		PkgName:     packageName,
+		Granularity: "perblock",
+		// Record the paths of the source files as given rather than
+		// <importpath>/<basename>.
+		Local: true,
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	pkgCfgPath := filepath.Join(workDir, "pkgcfg.json")
+	if err := ioutil.WriteFile(pkgCfgPath, pkgCfg, 0666); err != nil {
+		return nil, "", "", err
+	}
+
+	// The first output file receives the coverage variables, the remaining
+	// ones the instrumented sources.
+	coverVarsSrc = filepath.Join(workDir, "cover_vars.go")
+	outFiles := []string{coverVarsSrc}
+	for i := range srcs {
+		coverSrcs = append(coverSrcs, filepath.Join(workDir, fmt.Sprintf("cover_%d.go", i)))
+	}
+	outFiles = append(outFiles, coverSrcs...)
+	outFileList := filepath.Join(workDir, "cover_outfiles.txt")
+	if err := ioutil.WriteFile(outFileList, []byte(strings.Join(outFiles, "\n")+"\n"), 0666); err != nil {
+		return nil, "", "", err
+	}
+
+	// The prefix of the coverage variables has to be unique among the
+	// packages of a binary, as in "go build -cover".
+	h := sha256.Sum256([]byte(importPath))
+	coverVar := fmt.Sprintf("goCover_%x_", h[:6])
+	goargs := goenv.goTool("cover", "-pkgcfg", pkgCfgPath, "-mode", mode, "-var", coverVar, "-outfilelist", outFileList)
+	goargs = append(goargs, srcs...)
+	if err := goenv.runCommand(goargs); err != nil {
+		return nil, "", "", err
+	}
+	return coverSrcs, coverVarsSrc, coverCfg, nil
+}
+
 // registerCoverage modifies coverSrcFilename, the output file from go tool cover.
 // It adds a call to coverdata.RegisterCoverage, which ensures the coverage
 // data from each file is reported. The name by which the file is registered
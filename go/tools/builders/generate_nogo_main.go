@@ -54,6 +54,12 @@ var analyzers = []*analysis.Analyzer{
 var configs = map[string]config{
 {{- range $name, $config := .Configs}}
 	{{printf "%q" $name}}: config{
+		{{- if $config.Severity}}
+		severity: {{printf "%q" $config.Severity}},
+		{{- end -}}
+		{{- if $config.ReportGenerated}}
+		reportGenerated: boolPtr({{$config.ReportGenerated}}),
+		{{- end -}}
 		{{- if $config.AnalyzerFlags }}
 		analyzerFlags: map[string]string {
 			{{- range $flagKey, $flagValue := $config.AnalyzerFlags}}
@@ -80,12 +86,21 @@ var configs = map[string]config{
 			{{printf "regexp.MustCompile(%q)" $path}},
 			{{- end}}
 		},
+		{{- end -}}
+		{{- if $config.Baseline}}
+		baseline: []baselineEntry{
+			{{- range $entry := $config.Baseline}}
+			{Analyzer: {{printf "%q" $entry.Analyzer}}, File: {{printf "%q" $entry.File}}, Fingerprint: {{printf "%q" $entry.Fingerprint}}, Message: {{printf "%q" $entry.Message}}, Count: {{$entry.Count}}},
+			{{- end}}
+		},
 		{{- end}}
 	},
 {{- end}}
 }
 
 const debugMode = {{ .Debug }}
+
+const strictNolint = {{ .StrictNolint }}
 `
 
 func genNogoMain(args []string) error {
@@ -94,7 +109,9 @@ func genNogoMain(args []string) error {
 	out := flags.String("output", "", "output file to write (defaults to stdout)")
 	flags.Var(&analyzerImportPaths, "analyzer_importpath", "import path of an analyzer library")
 	configFile := flags.String("config", "", "nogo config file")
+	baselineFile := flags.String("baseline", "", "nogo baseline file")
 	debug := flags.Bool("debug", false, "enable debug mode")
+	strictNolint := flags.Bool("strict_nolint", false, "report problems with nolint directives")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -118,6 +135,17 @@ func genNogoMain(args []string) error {
 	if err != nil {
 		return err
 	}
+	if *baselineFile != "" {
+		baseline, err := readBaseline(*baselineFile)
+		if err != nil {
+			return err
+		}
+		for _, e := range baseline {
+			c := config[e.Analyzer]
+			c.Baseline = append(c.Baseline, e)
+			config[e.Analyzer] = c
+		}
+	}
 
 	type Import struct {
 		Path, Name string
@@ -135,14 +163,16 @@ func genNogoMain(args []string) error {
 		suffix++
 	}
 	data := struct {
-		Imports    []Import
-		Configs    Configs
-		NeedRegexp bool
-		Debug      bool
+		Imports      []Import
+		Configs      Configs
+		NeedRegexp   bool
+		Debug        bool
+		StrictNolint bool
 	}{
-		Imports: imports,
-		Configs: config,
-		Debug:   *debug,
+		Imports:      imports,
+		Configs:      config,
+		Debug:        *debug,
+		StrictNolint: *strictNolint,
 	}
 	for _, c := range config {
 		if len(c.OnlyFiles) > 0 || len(c.ExcludeFiles) > 0 {
@@ -181,11 +211,19 @@ func buildConfig(path string) (Configs, error) {
 				return Configs{}, fmt.Errorf("invalid pattern for analysis %q: %v", name, err)
 			}
 		}
+		switch config.Severity {
+		case "", severityError, severityWarning, severityInfo:
+		default:
+			return Configs{}, fmt.Errorf("invalid severity for analysis %q: %q, must be one of %q, %q or %q",
+				name, config.Severity, severityError, severityWarning, severityInfo)
+		}
 		configs[name] = Config{
 			// Description is currently unused.
-			OnlyFiles:     config.OnlyFiles,
-			ExcludeFiles:  config.ExcludeFiles,
-			AnalyzerFlags: config.AnalyzerFlags,
+			Severity:        config.Severity,
+			OnlyFiles:       config.OnlyFiles,
+			ExcludeFiles:    config.ExcludeFiles,
+			AnalyzerFlags:   config.AnalyzerFlags,
+			ReportGenerated: config.ReportGenerated,
 		}
 	}
 	return configs, nil
@@ -194,8 +232,12 @@ func buildConfig(path string) (Configs, error) {
 type Configs map[string]Config
 
 type Config struct {
-	Description   string
-	OnlyFiles     map[string]string `json:"only_files"`
-	ExcludeFiles  map[string]string `json:"exclude_files"`
-	AnalyzerFlags map[string]string `json:"analyzer_flags"`
+	Description     string
+	Severity        string            `json:"severity"`
+	OnlyFiles       map[string]string `json:"only_files"`
+	ExcludeFiles    map[string]string `json:"exclude_files"`
+	AnalyzerFlags   map[string]string `json:"analyzer_flags"`
+	ReportGenerated *bool             `json:"report_generated"`
+	// Baseline is read from a separate file.
+	Baseline []baselineEntry `json:"-"`
 }
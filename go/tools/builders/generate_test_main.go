@@ -31,6 +31,7 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
@@ -42,6 +43,8 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Import struct {
@@ -72,6 +75,7 @@ type Cases struct {
 	CoverMode   string
 	CoverFormat string
 	Pkgname     string
+	Fuzz        bool
 }
 
 // Version returns whether v is a supported Go version (like "go1.18").
@@ -101,7 +105,6 @@ import (
 {{if .TestMain}}
 	"reflect"
 {{end}}
-	"strconv"
 	"strings"
 	"testing"
 	"testing/internal/testdeps"
@@ -141,27 +144,59 @@ var examples = []testing.InternalExample{
 {{end}}
 }
 
-func testsInShard() []testing.InternalTest {
-	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
-	if err != nil || totalShards <= 1 {
-		return allTests
+// shard removes the tests, benchmarks, fuzz targets and examples that do not
+// belong to the current shard if the test is sharded.
+func shard() {
+	var names []string
+	for _, t := range allTests {
+		names = append(names, t.Name)
 	}
-	file, err := os.Create(os.Getenv("TEST_SHARD_STATUS_FILE"))
-	if err != nil {
-		log.Fatalf("Failed to touch TEST_SHARD_STATUS_FILE: %v", err)
+	for _, b := range benchmarks {
+		names = append(names, b.Name)
+	}
+{{if .Version "go1.18"}}
+	for _, f := range fuzzTargets {
+		names = append(names, f.Name)
+	}
+{{end}}
+	for _, e := range examples {
+		names = append(names, e.Name)
 	}
-	_ = file.Close()
-	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
-	if err != nil || shardIndex < 0 {
-		return allTests
+	inShard := bzltestutil.ShardNames(names)
+	if inShard == nil {
+		return
 	}
-	tests := []testing.InternalTest{}
-	for i, t := range allTests {
-		if i % totalShards == shardIndex {
-			tests = append(tests, t)
+
+	var shardTests []testing.InternalTest
+	for _, t := range allTests {
+		if inShard[t.Name] {
+			shardTests = append(shardTests, t)
+		}
+	}
+	allTests = shardTests
+	var shardBenchmarks []testing.InternalBenchmark
+	for _, b := range benchmarks {
+		if inShard[b.Name] {
+			shardBenchmarks = append(shardBenchmarks, b)
 		}
 	}
-	return tests
+	benchmarks = shardBenchmarks
+{{if .Version "go1.18"}}
+	var shardFuzzTargets []testing.InternalFuzzTarget
+	for _, f := range fuzzTargets {
+		if inShard[f.Name] {
+			shardFuzzTargets = append(shardFuzzTargets, f)
+		}
+	}
+	fuzzTargets = shardFuzzTargets
+{{end}}
+	var shardExamples []testing.InternalExample
+	for _, e := range examples {
+		if inShard[e.Name] {
+			shardExamples = append(shardExamples, e)
+		}
+	}
+	examples = shardExamples
 }
 
 func main() {
@@ -178,15 +213,22 @@ func main() {
 	}
 
 	testDeps :=
-  {{if eq .CoverFormat "lcov"}}
+  {{if .Fuzz}}
+		bzltestutil.FuzzTestDeps{LcovTestDeps: bzltestutil.LcovTestDeps{TestDeps: testdeps.TestDeps{}}, Lcov: {{eq .CoverFormat "lcov"}}}
+  {{else if eq .CoverFormat "lcov"}}
 		bzltestutil.LcovTestDeps{TestDeps: testdeps.TestDeps{}}
   {{else}}
 		testdeps.TestDeps{}
   {{end}}
+	shard()
+	tests := allTests
+{{if ne .CoverMode ""}}
+	tests = bzltestutil.AttributeCoverage(tests, "{{ .CoverMode }}", coverdata.Counters, coverdata.Blocks)
+{{end}}
   {{if .Version "go1.18"}}
-	m := testing.MainStart(testDeps, testsInShard(), benchmarks, fuzzTargets, examples)
+	m := testing.MainStart(testDeps, tests, benchmarks, fuzzTargets, examples)
   {{else}}
-	m := testing.MainStart(testDeps, testsInShard(), benchmarks, examples)
+	m := testing.MainStart(testDeps, tests, benchmarks, examples)
   {{end}}
 
 	if filter := os.Getenv("TESTBRIDGE_TEST_ONLY"); filter != "" {
@@ -230,12 +272,20 @@ func main() {
 			{{if eq .CoverFormat "lcov"}}
 			flag.Lookup("test.coverprofile").Value.Set(coverageDat+".cover")
 			{{else}}
-			flag.Lookup("test.coverprofile").Value.Set(coverageDat)
+			// Retries of failed tests must not overwrite the profile of all tests.
+			if bzltestutil.RetryAttempt() == 0 {
+				flag.Lookup("test.coverprofile").Value.Set(coverageDat)
+			}
 			{{end}}
 		}
 	}
 	{{end}}
 
+	bzltestutil.RegisterProfiles()
+{{if .Fuzz}}
+	bzltestutil.RegisterFuzzCacheDir("{{.Pkgname}}")
+{{end}}
+
 	testTimeout := os.Getenv("TEST_TIMEOUT")
 	if testTimeout != "" {
 		flag.Lookup("test.timeout").Value.Set(testTimeout+"s")
@@ -267,6 +317,7 @@ func genTestMain(args []string) error {
 	coverMode := flags.String("cover_mode", "", "the coverage mode to use")
 	coverFormat := flags.String("cover_format", "", "the coverage report type to generate (go_cover or lcov)")
 	pkgname := flags.String("pkgname", "", "package name of test")
+	fuzz := flags.Bool("fuzz", false, "whether the test is built for fuzzing")
 	flags.Var(&imports, "import", "Packages to import")
 	flags.Var(&sources, "src", "Sources to process for tests")
 	if err := flags.Parse(args); err != nil {
@@ -318,10 +369,11 @@ func genTestMain(args []string) error {
 		CoverFormat: *coverFormat,
 		CoverMode:   *coverMode,
 		Pkgname:     *pkgname,
+		Fuzz:        *fuzz,
 	}
 
 	testFileSet := token.NewFileSet()
-	pkgs := map[string]bool{}
+	var files []testFile
 	for _, f := range goSrcs {
 		parse, err := parser.ParseFile(testFileSet, f.filename, nil, parser.ParseComments)
 		if err != nil {
@@ -331,11 +383,77 @@ func genTestMain(args []string) error {
 		if strings.HasSuffix(parse.Name.String(), "_test") {
 			pkg += "_test"
 		}
-		for _, e := range doc.Examples(parse) {
+		files = append(files, testFile{pkg: pkg, filename: f.filename, ast: parse})
+	}
+
+	pkgs, err := cases.load(testFileSet, files)
+	if err != nil {
+		return err
+	}
+
+	for name := range importMap {
+		// Set the names for all unused imports to "_"
+		if !pkgs[name] {
+			importMap[name].Name = "_"
+		}
+		cases.Imports = append(cases.Imports, importMap[name])
+	}
+	sort.Slice(cases.Imports, func(i, j int) bool {
+		return cases.Imports[i].Name < cases.Imports[j].Name
+	})
+	tpl := template.Must(template.New("source").Parse(testMainTpl))
+	if err := tpl.Execute(outFile, &cases); err != nil {
+		return fmt.Errorf("template.Execute(%v): %v", cases, err)
+	}
+	return nil
+}
+
+// load adds the tests, benchmarks, fuzz targets, examples and TestMain found in
+// files to c and returns the names of the packages that declare any of them.
+func (c *Cases) load(fset *token.FileSet, files []testFile) (map[string]bool, error) {
+	// Examples are named after identifiers of their own package, or in the case
+	// of the external test package, of the package under test. The identifiers
+	// of an external test package are only known if the package under test is
+	// embedded, not when it is a dependency.
+	scopes := map[string]*exampleScope{}
+	for _, f := range files {
+		inScope := []string{f.pkg}
+		if !strings.HasSuffix(f.pkg, "_test") {
+			inScope = append(inScope, f.pkg+"_test")
+		}
+		for _, pkg := range inScope {
+			if scopes[pkg] == nil {
+				scopes[pkg] = newExampleScope()
+			}
+			scopes[pkg].addFile(f.ast)
+			if !strings.HasSuffix(pkg, "_test") || pkg != f.pkg {
+				scopes[pkg].known = true
+			}
+		}
+	}
+
+	testFuncKinds := []struct {
+		prefix, arg string
+		cases       *[]TestCase
+	}{
+		{"Test", "T", &c.Tests},
+		{"Benchmark", "B", &c.Benchmarks},
+		{"Fuzz", "F", &c.FuzzTargets},
+	}
+
+	// Like 'go test' and 'go vet', report functions in _test.go files that look
+	// like tests, but would not be run. Other sources, like those of the library
+	// under test, may declare such functions without them being tests.
+	var errs []string
+	pkgs := map[string]bool{}
+	for _, f := range files {
+		pkg := f.pkg
+		isTestFile := strings.HasSuffix(f.filename, "_test.go")
+		for _, e := range doc.Examples(f.ast) {
 			if e.Output == "" && !e.EmptyOutput {
 				continue
 			}
-			cases.Examples = append(cases.Examples, Example{
+			c.Examples = append(c.Examples, Example{
 				Name:      "Example" + e.Name,
 				Package:   pkg,
 				Output:    e.Output,
@@ -343,7 +461,7 @@ func genTestMain(args []string) error {
 			})
 			pkgs[pkg] = true
 		}
-		for _, d := range parse.Decls {
+		for _, d := range f.ast.Decls {
 			fn, ok := d.(*ast.FuncDecl)
 			if !ok {
 				continue
@@ -351,88 +469,244 @@ func genTestMain(args []string) error {
 			if fn.Recv != nil {
 				continue
 			}
-			if fn.Name.Name == "TestMain" {
+			name := fn.Name.Name
+			pos := fset.Position(fn.Pos())
+			if name == "TestMain" && !isTestFunc(fn, "T") {
 				// TestMain is not, itself, a test
+				if isTestFile {
+					if !isTestFunc(fn, "M") {
+						errs = append(errs, wrongSignature(pos, fn, "M"))
+						continue
+					}
+					if c.TestMain != "" {
+						errs = append(errs, fmt.Sprintf("%s: multiple definitions of TestMain", pos))
+						continue
+					}
+				}
 				pkgs[pkg] = true
-				cases.TestMain = fmt.Sprintf("%s.%s", pkg, fn.Name.Name)
-				continue
-			}
-
-			// Here we check the signature of the Test* function. To
-			// be considered a test:
-
-			// 1. The function should have a single argument.
-			if len(fn.Type.Params.List) != 1 {
-				continue
-			}
-
-			// 2. The function should return nothing.
-			if fn.Type.Results != nil {
-				continue
-			}
-
-			// 3. The only parameter should have a type identified as
-			//    *<something>.T
-			starExpr, ok := fn.Type.Params.List[0].Type.(*ast.StarExpr)
-			if !ok {
+				c.TestMain = fmt.Sprintf("%s.%s", pkg, name)
 				continue
 			}
-			selExpr, ok := starExpr.X.(*ast.SelectorExpr)
-			if !ok {
+			if isTestFile && strings.HasPrefix(name, "Example") {
+				errs = append(errs, scopes[pkg].checkExample(pos, fn)...)
 				continue
 			}
 
-			// We do not descriminate on the referenced type of the
-			// parameter being *testing.T. Instead we assert that it
-			// should be *<something>.T. This is because the import
-			// could have been aliased as a different identifier.
-
-			if strings.HasPrefix(fn.Name.Name, "Test") {
-				if selExpr.Sel.Name != "T" {
+			for _, kind := range testFuncKinds {
+				if !strings.HasPrefix(name, kind.prefix) {
 					continue
 				}
+				// We do not descriminate on the referenced type of the
+				// parameter being *testing.T. Instead we assert that it
+				// should be *<something>.T. This is because the import
+				// could have been aliased as a different identifier.
+				if !isTestFile {
+					if !isTestFunc(fn, kind.arg) {
+						break
+					}
+				} else if !isTest(name, kind.prefix) {
+					if isTestFunc(fn, kind.arg) {
+						errs = append(errs, fmt.Sprintf("%s: %s has malformed name: first letter after '%s' must not be lowercase", pos, name, kind.prefix))
+					}
+					break
+				} else if !isTestFunc(fn, kind.arg) {
+					errs = append(errs, wrongSignature(pos, fn, kind.arg))
+					break
+				}
 				pkgs[pkg] = true
-				cases.Tests = append(cases.Tests, TestCase{
+				*kind.cases = append(*kind.cases, TestCase{
 					Package: pkg,
-					Name:    fn.Name.Name,
+					Name:    name,
 				})
+				break
 			}
-			if strings.HasPrefix(fn.Name.Name, "Benchmark") {
-				if selExpr.Sel.Name != "B" {
-					continue
-				}
-				pkgs[pkg] = true
-				cases.Benchmarks = append(cases.Benchmarks, TestCase{
-					Package: pkg,
-					Name:    fn.Name.Name,
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return pkgs, nil
+}
+
+type testFile struct {
+	pkg, filename string
+	ast           *ast.File
+}
+
+// isTestFunc tells whether fn has the type of a testing function. arg
+// specifies the parameter type we look for: B, F, M or T.
+func isTestFunc(fn *ast.FuncDecl, arg string) bool {
+	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 ||
+		fn.Type.Params.List == nil ||
+		len(fn.Type.Params.List) != 1 ||
+		len(fn.Type.Params.List[0].Names) > 1 {
+		return false
+	}
+	ptr, ok := fn.Type.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	// We can't easily check that the type is *testing.M
+	// because we don't know how testing has been imported,
+	// but at least check that it's *M or *something.M.
+	// Same applies for B, F and T.
+	if name, ok := ptr.X.(*ast.Ident); ok && name.Name == arg {
+		return true
+	}
+	if sel, ok := ptr.X.(*ast.SelectorExpr); ok && sel.Sel.Name == arg {
+		return true
+	}
+	return false
+}
+
+// isTest tells whether name looks like a test (or benchmark, according to prefix).
+// It is a Test (say) if there is a character after Test that is not a lower-case letter.
+// We don't want TesticularCancer.
+func isTest(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) { // "Test" is ok
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+func wrongSignature(pos token.Position, fn *ast.FuncDecl, arg string) string {
+	return fmt.Sprintf("%s: wrong signature for %s, must be: func %s(%s *testing.%s)", pos, fn.Name.Name, fn.Name.Name, strings.ToLower(arg), arg)
+}
+
+// exampleScope holds the identifiers an example may be named after, which is
+// checked like 'go vet' does, but from the syntax of the package alone.
+type exampleScope struct {
+	idents map[string]bool
+	// members holds the fields and methods of the declared identifiers.
+	members map[string]map[string]bool
+	// open holds identifiers whose fields and methods can't be told from their
+	// declaration, like variables and types with embedded fields.
+	open map[string]bool
+	// known is set if the sources of the package that examples are named
+	// after are all available. Otherwise, only their form is checked.
+	known bool
+}
+
+func newExampleScope() *exampleScope {
+	return &exampleScope{
+		idents:  map[string]bool{},
+		members: map[string]map[string]bool{},
+		open:    map[string]bool{},
+	}
+}
+
+func (s *exampleScope) addMember(ident, member string) {
+	if s.members[ident] == nil {
+		s.members[ident] = map[string]bool{}
+	}
+	s.members[ident][member] = true
+}
+
+func (s *exampleScope) addFile(f *ast.File) {
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				s.idents[d.Name.Name] = true
+			} else if len(d.Recv.List) == 1 {
+				// The receiver type is the first identifier of *T, T or T[P].
+				var recv string
+				ast.Inspect(d.Recv.List[0].Type, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok && recv == "" {
+						recv = id.Name
+					}
+					return recv == ""
 				})
+				s.addMember(recv, d.Name.Name)
 			}
-			if strings.HasPrefix(fn.Name.Name, "Fuzz") {
-				if selExpr.Sel.Name != "F" {
-					continue
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						s.idents[name.Name] = true
+						s.open[name.Name] = true
+					}
+				case *ast.TypeSpec:
+					s.addType(spec)
 				}
-				pkgs[pkg] = true
-				cases.FuzzTargets = append(cases.FuzzTargets, TestCase{
-					Package: pkg,
-					Name:    fn.Name.Name,
-				})
 			}
 		}
 	}
+}
 
-	for name := range importMap {
-		// Set the names for all unused imports to "_"
-		if !pkgs[name] {
-			importMap[name].Name = "_"
+func (s *exampleScope) addType(spec *ast.TypeSpec) {
+	name := spec.Name.Name
+	s.idents[name] = true
+	var fields *ast.FieldList
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields = t.Methods
+	default:
+		// Other named types may have the fields of their underlying type.
+		s.open[name] = true
+		return
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			s.open[name] = true
+		}
+		for _, fieldName := range field.Names {
+			s.addMember(name, fieldName.Name)
 		}
-		cases.Imports = append(cases.Imports, importMap[name])
 	}
-	sort.Slice(cases.Imports, func(i, j int) bool {
-		return cases.Imports[i].Name < cases.Imports[j].Name
-	})
-	tpl := template.Must(template.New("source").Parse(testMainTpl))
-	if err := tpl.Execute(outFile, &cases); err != nil {
-		return fmt.Errorf("template.Execute(%v): %v", cases, err)
+}
+
+// checkExample reports examples that would not be run or that aren't named
+// after an identifier, and optionally a field or method, of their package.
+func (s *exampleScope) checkExample(pos token.Position, fn *ast.FuncDecl) []string {
+	var errs []string
+	fnName := fn.Name.Name
+	if params := fn.Type.Params; len(params.List) != 0 {
+		errs = append(errs, fmt.Sprintf("%s: %s should be niladic", pos, fnName))
 	}
-	return nil
+	if results := fn.Type.Results; results != nil && len(results.List) != 0 {
+		errs = append(errs, fmt.Sprintf("%s: %s should return nothing", pos, fnName))
+	}
+	if fnName == "Example" {
+		return errs
+	}
+
+	exName := strings.TrimPrefix(fnName, "Example")
+	elems := strings.SplitN(exName, "_", 3)
+	ident := elems[0]
+	if ident != "" && s.known && !s.idents[ident] {
+		// Check ExampleFoo and ExampleBadFoo.
+		return append(errs, fmt.Sprintf("%s: %s refers to unknown identifier: %s", pos, fnName, ident))
+	}
+	if len(elems) < 2 {
+		return errs
+	}
+	if ident == "" {
+		// Check Example_suffix and Example_BadSuffix.
+		if residual := strings.TrimPrefix(exName, "_"); !isExampleSuffix(residual) {
+			errs = append(errs, fmt.Sprintf("%s: %s has malformed example suffix: %s", pos, fnName, residual))
+		}
+		return errs
+	}
+	if mmbr := elems[1]; s.known && !isExampleSuffix(mmbr) && !s.open[ident] && !s.members[ident][mmbr] {
+		// Check ExampleFoo_Method and ExampleFoo_BadMethod.
+		errs = append(errs, fmt.Sprintf("%s: %s refers to unknown field or method: %s.%s", pos, fnName, ident, mmbr))
+	}
+	if len(elems) == 3 && !isExampleSuffix(elems[2]) {
+		// Check ExampleFoo_Method_suffix and ExampleFoo_Method_Badsuffix.
+		errs = append(errs, fmt.Sprintf("%s: %s has malformed example suffix: %s", pos, fnName, elems[2]))
+	}
+	return errs
+}
+
+func isExampleSuffix(s string) bool {
+	r, size := utf8.DecodeRuneInString(s)
+	return size > 0 && unicode.IsLower(r)
 }
@@ -0,0 +1,190 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadCases(t *testing.T, srcs map[string]string) (*Cases, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	var files []testFile
+	for _, filename := range []string{"lib.go", "lib_test.go", "external_test.go"} {
+		src, ok := srcs[filename]
+		if !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg := "l"
+		if strings.HasSuffix(f.Name.Name, "_test") {
+			pkg += "_test"
+		}
+		files = append(files, testFile{pkg: pkg, filename: filename, ast: f})
+	}
+	cases := &Cases{}
+	_, err := cases.load(fset, files)
+	return cases, err
+}
+
+func TestLoadCases(t *testing.T) {
+	cases, err := loadCases(t, map[string]string{
+		"lib.go": `package lib
+
+import "testing"
+
+// Not a test, since it isn't in a _test.go file.
+func Testable(x int) {}
+
+func TestHelper(t *testing.T) {}
+`,
+		"lib_test.go": `package lib
+
+import (
+	"testing"
+	. "testing"
+)
+
+func Test(t *testing.T) {}
+func TestA(t *T) {}
+func Test_b(t *testing.T) {}
+func Testing(x int) int { return x }
+func BenchmarkA(b *testing.B) {}
+func FuzzA(f *testing.F) {}
+func TestMain(m *testing.M) {}
+`,
+		"external_test.go": `package lib_test
+
+import "testing"
+
+func TestB(t *testing.T) {}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests []string
+	for _, tc := range cases.Tests {
+		tests = append(tests, tc.Package+"."+tc.Name)
+	}
+	if want := []string{"l.TestHelper", "l.Test", "l.TestA", "l.Test_b", "l_test.TestB"}; !reflect.DeepEqual(tests, want) {
+		t.Errorf("got tests %v, want %v", tests, want)
+	}
+	if len(cases.Benchmarks) != 1 || len(cases.FuzzTargets) != 1 {
+		t.Errorf("got benchmarks %v and fuzz targets %v, want one of each", cases.Benchmarks, cases.FuzzTargets)
+	}
+	if cases.TestMain != "l.TestMain" {
+		t.Errorf("got TestMain %q, want l.TestMain", cases.TestMain)
+	}
+}
+
+func TestLoadCasesErrors(t *testing.T) {
+	_, err := loadCases(t, map[string]string{
+		"lib.go": `package lib
+
+type Thing struct{ Name string }
+
+func (t *Thing) Do() {}
+
+type Wrapper struct{ Thing }
+
+var Default Thing
+
+func Helper() {}
+`,
+		"lib_test.go": `package lib
+
+import "testing"
+
+func TestWrongType(t *testing.B) {}
+func TestResult(t *testing.T) error { return nil }
+func Testfoo(t *testing.T) {}
+func BenchmarkWrongType(b *testing.T) {}
+func Fuzzy(f *testing.F) {}
+func TestMain(t *testing.M) {}
+
+func ExampleThing_Do() {}
+func ExampleThing_Name() {}
+func ExampleThing_Missing() {}
+func ExampleWrapper_Promoted() {}
+func ExampleDefault_Anything() {}
+func ExampleHelper_Method() {}
+func ExampleMissing() {}
+func Example_suffix() {}
+func Example_Suffix() {}
+func ExampleThing_Do_Suffix() {}
+func ExampleHelper(x int) {}
+`,
+		"external_test.go": `package lib_test
+
+import "testing"
+
+func TestMain(m *testing.M) {}
+
+func ExampleThing() {}
+func ExampleLocal() {}
+
+type Local int
+`,
+	})
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	want := []string{
+		"lib_test.go:5:1: wrong signature for TestWrongType, must be: func TestWrongType(t *testing.T)",
+		"lib_test.go:6:1: wrong signature for TestResult, must be: func TestResult(t *testing.T)",
+		"lib_test.go:7:1: Testfoo has malformed name: first letter after 'Test' must not be lowercase",
+		"lib_test.go:8:1: wrong signature for BenchmarkWrongType, must be: func BenchmarkWrongType(b *testing.B)",
+		"lib_test.go:9:1: Fuzzy has malformed name: first letter after 'Fuzz' must not be lowercase",
+		"lib_test.go:14:1: ExampleThing_Missing refers to unknown field or method: Thing.Missing",
+		"lib_test.go:17:1: ExampleHelper_Method refers to unknown field or method: Helper.Method",
+		"lib_test.go:18:1: ExampleMissing refers to unknown identifier: Missing",
+		"lib_test.go:20:1: Example_Suffix has malformed example suffix: Suffix",
+		"lib_test.go:21:1: ExampleThing_Do_Suffix has malformed example suffix: Suffix",
+		"lib_test.go:22:1: ExampleHelper should be niladic",
+		"external_test.go:5:1: multiple definitions of TestMain",
+	}
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadCasesExternalDeps(t *testing.T) {
+	// The package under test is a dependency of the external test package,
+	// so the identifiers examples are named after are not known.
+	_, err := loadCases(t, map[string]string{
+		"external_test.go": `package lib_test
+
+func ExampleBar() {}
+func ExampleNew_copy() {}
+func ExampleBar_Method() {}
+func ExampleBar_Method_Suffix() {}
+`,
+	})
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	want := "external_test.go:6:1: ExampleBar_Method_Suffix has malformed example suffix: Suffix"
+	if got := err.Error(); got != want {
+		t.Errorf("got errors:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -20,14 +20,14 @@ func nogo(args []string) error {
 
 	fs := flag.NewFlagSet("GoNogo", flag.ExitOnError)
 	goenv := envFlags(fs)
-	var unfilteredSrcs, ignoreSrcs, recompileInternalDeps multiFlag
+	var unfilteredSrcs, generatedSrcs, recompileInternalDeps multiFlag
 	var deps, facts archiveMultiFlag
 	var importPath, packagePath, nogoPath, packageListPath string
 	var testFilter string
-	var outFactsPath, outLogPath string
+	var outFactsPath, outLogPath, outFixPath, outJSONPath, outSARIFPath, outProfilePath string
 	var coverMode string
 	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and checked")
-	fs.Var(&ignoreSrcs, "ignore_src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and checked, but with its diagnostics ignored")
+	fs.Var(&generatedSrcs, "generated_src", ".go file generated from the other sources, such as by cgo, to be filtered and checked, but with its diagnostics only reported where //line directives map them back to the original files")
 	fs.Var(&deps, "arc", "Import path, package path, and file name of a direct dependency, separated by '='")
 	fs.Var(&facts, "facts", "Import path, package path, and file name of a direct dependency's nogo facts file, separated by '='")
 	fs.StringVar(&importPath, "importpath", "", "The import path of the package being compiled. Not passed to the compiler, but may be displayed in debug data.")
@@ -39,6 +39,10 @@ func nogo(args []string) error {
 	fs.StringVar(&nogoPath, "nogo", "", "The nogo binary")
 	fs.StringVar(&outFactsPath, "out_facts", "", "The file to emit serialized nogo facts to")
 	fs.StringVar(&outLogPath, "out_log", "", "The file to emit nogo logs into")
+	fs.StringVar(&outFixPath, "out_fix", "", "The file to emit a patch with the suggested fixes into")
+	fs.StringVar(&outJSONPath, "out_json", "", "The file to emit nogo findings in JSON format into")
+	fs.StringVar(&outSARIFPath, "out_sarif", "", "The file to emit nogo findings in SARIF format into")
+	fs.StringVar(&outProfilePath, "out_profile", "", "The file to emit the nogo timing profile into, if any")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -50,7 +54,7 @@ func nogo(args []string) error {
 	}
 
 	// Filter sources.
-	srcs, err := filterAndSplitFiles(append(unfilteredSrcs, ignoreSrcs...))
+	srcs, err := filterAndSplitFiles(append(unfilteredSrcs, generatedSrcs...))
 	if err != nil {
 		return err
 	}
@@ -77,15 +81,15 @@ func nogo(args []string) error {
 	defer cleanup()
 
 	compilingWithCgo := os.Getenv("CGO_ENABLED") == "1" && haveCgo
-	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, workDir)
+	importcfgPath, err := checkImportsAndBuildCfg(goenv, importPath, srcs, deps, packageListPath, recompileInternalDeps, compilingWithCgo, coverMode, false, workDir)
 	if err != nil {
 		return err
 	}
 
-	return runNogo(workDir, nogoPath, goSrcs, ignoreSrcs, facts, importPath, importcfgPath, outFactsPath, outLogPath)
+	return runNogo(workDir, nogoPath, goSrcs, generatedSrcs, facts, importPath, importcfgPath, outFactsPath, outLogPath, outFixPath, outJSONPath, outSARIFPath, outProfilePath)
 }
 
-func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []archive, packagePath, importcfgPath, outFactsPath string, outLogPath string) error {
+func runNogo(workDir string, nogoPath string, srcs, generated []string, facts []archive, packagePath, importcfgPath, outFactsPath string, outLogPath string, outFixPath string, outJSONPath, outSARIFPath, outProfilePath string) error {
 	if len(srcs) == 0 {
 		// emit_compilepkg expects a nogo facts file, even if it's empty.
 		// We also need to write the validation output log.
@@ -97,6 +101,24 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 		if err != nil {
 			return fmt.Errorf("error writing empty nogo log file: %v", err)
 		}
+		err = os.WriteFile(outFixPath, nil, 0o666)
+		if err != nil {
+			return fmt.Errorf("error writing empty nogo fix file: %v", err)
+		}
+		err = writeFindingsJSON(outJSONPath, findingsFile{Package: packagePath})
+		if err != nil {
+			return fmt.Errorf("error writing empty nogo JSON findings file: %v", err)
+		}
+		err = writeFindingsSARIF(outSARIFPath, packagePath, nil, nil)
+		if err != nil {
+			return fmt.Errorf("error writing empty nogo SARIF findings file: %v", err)
+		}
+		if outProfilePath != "" {
+			err = writeProfile(outProfilePath, nogoProfile{Package: packagePath})
+			if err != nil {
+				return fmt.Errorf("error writing empty nogo profile: %v", err)
+			}
+		}
 		return nil
 	}
 	args := []string{nogoPath}
@@ -106,8 +128,14 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 		args = append(args, "-fact", fmt.Sprintf("%s=%s", fact.importPath, fact.file))
 	}
 	args = append(args, "-x", outFactsPath)
-	for _, ignore := range ignores {
-		args = append(args, "-ignore", ignore)
+	args = append(args, "-fixpath", outFixPath)
+	args = append(args, "-json", outJSONPath)
+	args = append(args, "-sarif", outSARIFPath)
+	if outProfilePath != "" {
+		args = append(args, "-profile", outProfilePath)
+	}
+	for _, src := range generated {
+		args = append(args, "-generated", src)
 	}
 	args = append(args, srcs...)
 
@@ -136,11 +164,12 @@ func runNogo(workDir string, nogoPath string, srcs, ignores []string, facts []ar
 			return fmt.Errorf("nogo command '%s' exited unexpectedly: %s", cmdLine, exitErr.String())
 		}
 		prettyOut := relativizePaths(out.Bytes())
-		if exitErr.ExitCode() != nogoViolation {
+		if exitErr.ExitCode() != nogoViolation && exitErr.ExitCode() != nogoWarning {
 			return errors.New(string(prettyOut))
 		}
 		// Do not fail the action if nogo has findings so that facts are
-		// still available for downstream targets.
+		// still available for downstream targets. The validation action
+		// decides whether the findings fail the build.
 		_, err := outLog.Write(prettyOut)
 		if err != nil {
 			return fmt.Errorf("error writing nogo log file: %v", err)
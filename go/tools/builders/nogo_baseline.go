@@ -0,0 +1,87 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the baseline of known nogo findings.
+// Note that this file is shared between the nogo binary and the builder, which
+// embeds the baseline into the configs of the generated nogo main file.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// baselineFile is the top-level object of a baseline file, which can be
+// generated from the JSON findings with //go/tools/nogo_baseline.
+type baselineFile struct {
+	Entries []baselineEntry `json:"entries"`
+}
+
+// baselineEntry suppresses up to Count findings of an analyzer in a file with
+// the given message fingerprint.
+type baselineEntry struct {
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Fingerprint string `json:"fingerprint"`
+	// Message is the message of the first matching finding. It only serves
+	// as documentation.
+	Message string `json:"message,omitempty"`
+	Count   int    `json:"count"`
+}
+
+func (e baselineEntry) key() string {
+	return baselineKey(e.File, e.Fingerprint)
+}
+
+func baselineKey(file, fingerprint string) string {
+	return file + ":" + fingerprint
+}
+
+// positionPattern matches positions that analyzers commonly embed in their
+// messages, such as "foo.go:12:3" or "line 12".
+var positionPattern = regexp.MustCompile(`(\.go):\d+(:\d+)?|\b(line) \d+`)
+
+// findingFingerprint identifies a finding in a file independently of its
+// position, so that baseline entries keep matching when code is added or
+// removed above the finding.
+func findingFingerprint(message string) string {
+	normalized := positionPattern.ReplaceAllString(message, "$1$3")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// readBaseline reads and validates a baseline file.
+func readBaseline(path string) ([]baselineEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %v", err)
+	}
+	var baseline baselineFile
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal baseline file: %v", err)
+	}
+	for i, e := range baseline.Entries {
+		if e.Analyzer == "" || e.File == "" || e.Fingerprint == "" {
+			return nil, fmt.Errorf("baseline entry %d: analyzer, file and fingerprint must be set", i)
+		}
+		if e.Count < 1 {
+			return nil, fmt.Errorf("baseline entry %d: count must be positive, got %d", i, e.Count)
+		}
+	}
+	return baseline.Entries, nil
+}
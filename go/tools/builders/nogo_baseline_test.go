@@ -0,0 +1,88 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindingFingerprint(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		same bool
+	}{
+		{"redundant or: x || x", "redundant or: x || x", true},
+		{"redundant or: x || x", "redundant or: y || y", false},
+		{"x declared at a.go:12:3", "x declared at a.go:20:1", true},
+		{"x declared at a.go:12", "x declared at a.go:20", true},
+		{"x declared at a.go:12", "x declared at b.go:12", false},
+		{"unreachable since line 12", "unreachable since line 3", true},
+		{"want 12 arguments", "want 3 arguments", false},
+	} {
+		if got := findingFingerprint(tc.a) == findingFingerprint(tc.b); got != tc.same {
+			t.Errorf("fingerprints of %q and %q equal: got %v, want %v", tc.a, tc.b, got, tc.same)
+		}
+	}
+}
+
+func TestReadBaseline(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, content, wantErr string
+	}{
+		{
+			name:    "valid",
+			content: `{"entries": [{"analyzer": "bools", "file": "a.go", "fingerprint": "0123", "count": 2}]}`,
+		},
+		{
+			name:    "missing fingerprint",
+			content: `{"entries": [{"analyzer": "bools", "file": "a.go", "count": 1}]}`,
+			wantErr: "must be set",
+		},
+		{
+			name:    "zero count",
+			content: `{"entries": [{"analyzer": "bools", "file": "a.go", "fingerprint": "0123"}]}`,
+			wantErr: "count must be positive",
+		},
+		{
+			name:    "invalid JSON",
+			content: `[`,
+			wantErr: "failed to unmarshal",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".json")
+			if err := os.WriteFile(path, []byte(tc.content), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := readBaseline(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].key() != "a.go:0123" || entries[0].Count != 2 {
+				t.Errorf("unexpected entries: %#v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the machine-readable formats of nogo findings.
+// Note that this file is shared between the nogo binary and the builder, which
+// writes empty findings files for packages without Go sources.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// findingsFile is the top-level object of a JSON findings file.
+type findingsFile struct {
+	// Package is the package path of the analyzed package.
+	Package string `json:"package"`
+	// Findings are the diagnostics reported for the package, sorted by position.
+	Findings []finding `json:"findings"`
+	// StaleBaseline are the baseline entries for files in the package that no
+	// longer match a finding, with their count reduced to the number of
+	// unmatched findings.
+	StaleBaseline []baselineEntry `json:"stale_baseline,omitempty"`
+	// Failed is true if any of the findings fail the build, as opposed to
+	// findings of analyzers that are only configured to warn.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// finding is a diagnostic reported by an analyzer.
+type finding struct {
+	Analyzer       string           `json:"analyzer"`
+	Severity       string           `json:"severity"`
+	Category       string           `json:"category,omitempty"`
+	Range          findingRange     `json:"range"`
+	Message        string           `json:"message"`
+	Related        []relatedFinding `json:"related,omitempty"`
+	SuggestedFixes []findingFix     `json:"suggested_fixes,omitempty"`
+	// Fingerprint identifies the message of the finding in baseline files.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Baselined is true if the finding is suppressed by the baseline.
+	Baselined bool `json:"baselined,omitempty"`
+}
+
+// findingRange is a range of source code. File is relative to the execution
+// root, lines and columns are 1-based and columns are measured in bytes.
+// The range is empty if the analyzer didn't report a valid position.
+type findingRange struct {
+	File        string `json:"file,omitempty"`
+	StartLine   int    `json:"start_line,omitempty"`
+	StartColumn int    `json:"start_column,omitempty"`
+	EndLine     int    `json:"end_line,omitempty"`
+	EndColumn   int    `json:"end_column,omitempty"`
+}
+
+type relatedFinding struct {
+	Range   findingRange `json:"range"`
+	Message string       `json:"message"`
+}
+
+type findingFix struct {
+	Message string        `json:"message"`
+	Edits   []findingEdit `json:"edits"`
+}
+
+type findingEdit struct {
+	Range   findingRange `json:"range"`
+	NewText string       `json:"new_text"`
+}
+
+// findingRule describes an analyzer in SARIF output.
+type findingRule struct {
+	Name, Doc, URL string
+}
+
+func writeFindingsJSON(path string, file findingsFile) error {
+	if file.Findings == nil {
+		file.Findings = []finding{}
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o666)
+}
+
+func readFindingsJSON(path string) (findingsFile, error) {
+	var file findingsFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	err = json.Unmarshal(data, &file)
+	return file, err
+}
+
+// The subset of SARIF 2.1.0 used by nogo, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolURI = "https://github.com/bazelbuild/rules_go/blob/master/go/nogo.rst"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+	Properties sarifProps    `json:"properties,omitempty"`
+}
+
+type sarifProps map[string]string
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription *sarifMessage `json:"shortDescription,omitempty"`
+	FullDescription  *sarifMessage `json:"fullDescription,omitempty"`
+	HelpURI          string        `json:"helpUri,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string             `json:"ruleId"`
+	RuleIndex        int                `json:"ruleIndex"`
+	Level            string             `json:"level"`
+	Message          sarifMessage       `json:"message"`
+	Locations        []sarifLocation    `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation    `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix         `json:"fixes,omitempty"`
+	Suppressions     []sarifSuppression `json:"suppressions,omitempty"`
+	Properties       sarifProps         `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                   `json:"id,omitempty"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	Message          *sarifMessage          `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion   `json:"deletedRegion"`
+	InsertedContent *sarifMessage `json:"insertedContent,omitempty"`
+}
+
+func writeFindingsSARIF(path, packagePath string, rules []findingRule, findings []finding) error {
+	columns := &sarifColumns{lines: make(map[string][]string)}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "nogo",
+			InformationURI: sarifToolURI,
+			Rules:          []sarifRule{},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+		Properties: sarifProps{"package": packagePath},
+	}
+	ruleIndex := make(map[string]int)
+	for _, rule := range rules {
+		ruleIndex[rule.Name] = len(run.Tool.Driver.Rules)
+		r := sarifRule{ID: rule.Name, HelpURI: rule.URL}
+		if rule.Doc != "" {
+			short := strings.TrimSpace(strings.SplitN(rule.Doc, "\n\n", 2)[0])
+			r.ShortDescription = &sarifMessage{Text: short}
+			r.FullDescription = &sarifMessage{Text: rule.Doc}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, r)
+	}
+	for _, f := range findings {
+		result := sarifResult{
+			RuleID:    f.Analyzer,
+			RuleIndex: ruleIndex[f.Analyzer],
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+		}
+		if loc := columns.physicalLocation(f.Range); loc != nil {
+			result.Locations = []sarifLocation{{PhysicalLocation: loc}}
+		}
+		for i, related := range f.Related {
+			id := i
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               &id,
+				PhysicalLocation: columns.physicalLocation(related.Range),
+				Message:          &sarifMessage{Text: related.Message},
+			})
+		}
+		for _, fix := range f.SuggestedFixes {
+			result.Fixes = append(result.Fixes, columns.fix(fix))
+		}
+		if f.Baselined {
+			result.Suppressions = []sarifSuppression{{Kind: "external", Justification: "nogo baseline"}}
+		}
+		if f.Category != "" {
+			result.Properties = sarifProps{"category": f.Category}
+		}
+		run.Results = append(run.Results, result)
+	}
+	data, err := json.MarshalIndent(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o666)
+}
+
+// sarifLevel returns the SARIF level of a finding with the given severity.
+func sarifLevel(severity string) string {
+	switch severity {
+	case severityWarning:
+		return "warning"
+	case severityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// sarifColumns converts the byte columns of findings to the Unicode code point
+// columns used by SARIF, reading each source file at most once.
+type sarifColumns struct {
+	lines map[string][]string
+}
+
+func (c *sarifColumns) column(file string, line, byteColumn int) int {
+	lines, ok := c.lines[file]
+	if !ok {
+		if data, err := os.ReadFile(file); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		c.lines[file] = lines
+	}
+	if line < 1 || line > len(lines) || byteColumn < 1 {
+		return byteColumn
+	}
+	text := lines[line-1]
+	if byteColumn-1 > len(text) {
+		return byteColumn
+	}
+	return utf8.RuneCountInString(text[:byteColumn-1]) + 1
+}
+
+func (c *sarifColumns) region(r findingRange) *sarifRegion {
+	if r.StartLine == 0 {
+		return nil
+	}
+	region := &sarifRegion{
+		StartLine:   r.StartLine,
+		StartColumn: c.column(r.File, r.StartLine, r.StartColumn),
+	}
+	if r.EndLine != 0 {
+		region.EndLine = r.EndLine
+		region.EndColumn = c.column(r.File, r.EndLine, r.EndColumn)
+	}
+	return region
+}
+
+func (c *sarifColumns) physicalLocation(r findingRange) *sarifPhysicalLocation {
+	if r.File == "" {
+		return nil
+	}
+	return &sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: r.File},
+		Region:           c.region(r),
+	}
+}
+
+func (c *sarifColumns) fix(fix findingFix) sarifFix {
+	result := sarifFix{Description: sarifMessage{Text: fix.Message}}
+	changeIndex := make(map[string]int)
+	for _, edit := range fix.Edits {
+		i, ok := changeIndex[edit.Range.File]
+		if !ok {
+			i = len(result.ArtifactChanges)
+			changeIndex[edit.Range.File] = i
+			result.ArtifactChanges = append(result.ArtifactChanges, sarifArtifactChange{
+				ArtifactLocation: sarifArtifactLocation{URI: edit.Range.File},
+			})
+		}
+		region := c.region(edit.Range)
+		if region == nil {
+			continue
+		}
+		replacement := sarifReplacement{DeletedRegion: *region}
+		if edit.NewText != "" {
+			replacement.InsertedContent = &sarifMessage{Text: edit.NewText}
+		}
+		result.ArtifactChanges[i].Replacements = append(result.ArtifactChanges[i].Replacements, replacement)
+	}
+	return result
+}
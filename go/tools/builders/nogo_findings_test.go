@@ -0,0 +1,141 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testFindings(t *testing.T) (string, []finding) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.go")
+	if err := os.WriteFile(src, []byte("package src\n\nvar s = \"äöü\" + x\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	return dir, []finding{
+		{
+			Analyzer:  "check",
+			Severity:  "error",
+			Category:  "cat",
+			Range:     findingRange{File: src, StartLine: 3, StartColumn: 20, EndLine: 3, EndColumn: 21},
+			Message:   "undesired x",
+			Baselined: true,
+			Related: []relatedFinding{{
+				Range:   findingRange{File: src, StartLine: 1, StartColumn: 1},
+				Message: "in this package",
+			}},
+			SuggestedFixes: []findingFix{{
+				Message: "replace with y",
+				Edits: []findingEdit{{
+					Range:   findingRange{File: src, StartLine: 3, StartColumn: 20, EndLine: 3, EndColumn: 21},
+					NewText: "y",
+				}},
+			}},
+		},
+		{
+			Analyzer: "nopos",
+			Severity: "warning",
+			Message:  "no position",
+		},
+	}
+}
+
+func TestWriteFindingsJSON(t *testing.T) {
+	dir, findings := testFindings(t)
+	path := filepath.Join(dir, "findings.json")
+	want := findingsFile{
+		Package:  "example.com/src",
+		Findings: findings,
+		StaleBaseline: []baselineEntry{
+			{Analyzer: "check", File: "src.go", Fingerprint: "0123456789abcdef", Count: 1},
+		},
+		Failed: true,
+	}
+	if err := writeFindingsJSON(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFindingsJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestWriteFindingsSARIF(t *testing.T) {
+	dir, findings := testFindings(t)
+	path := filepath.Join(dir, "findings.sarif")
+	rules := []findingRule{
+		{Name: "check", Doc: "check reports x\n\nLonger description.", URL: "https://example.com/check"},
+		{Name: "nopos"},
+	}
+	if err := writeFindingsSARIF(path, "example.com/src", rules, findings); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs, want version 2.1.0 with 1 run", got.Version, len(got.Runs))
+	}
+	run := got.Runs[0]
+	if rule := run.Tool.Driver.Rules[0]; rule.ID != "check" || rule.ShortDescription.Text != "check reports x" || rule.HelpURI != "https://example.com/check" {
+		t.Errorf("unexpected rule: %#v", rule)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(run.Results))
+	}
+
+	result := run.Results[0]
+	// The finding starts at byte column 20, which is column 17 in code points
+	// due to the three two-byte characters before it.
+	wantRegion := &sarifRegion{StartLine: 3, StartColumn: 17, EndLine: 3, EndColumn: 18}
+	if result.RuleID != "check" || result.RuleIndex != 0 || result.Level != "error" {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if loc := result.Locations[0].PhysicalLocation; !reflect.DeepEqual(loc.Region, wantRegion) {
+		t.Errorf("got region %#v, want %#v", loc.Region, wantRegion)
+	}
+	if len(result.RelatedLocations) != 1 || result.RelatedLocations[0].Message.Text != "in this package" {
+		t.Errorf("unexpected related locations: %#v", result.RelatedLocations)
+	}
+	if len(result.Fixes) != 1 {
+		t.Fatalf("got %d fixes, want 1", len(result.Fixes))
+	}
+	replacement := result.Fixes[0].ArtifactChanges[0].Replacements[0]
+	if !reflect.DeepEqual(&replacement.DeletedRegion, wantRegion) || replacement.InsertedContent.Text != "y" {
+		t.Errorf("unexpected replacement: %#v", replacement)
+	}
+	if len(result.Suppressions) != 1 || result.Suppressions[0].Kind != "external" {
+		t.Errorf("got suppressions %#v, want one external suppression", result.Suppressions)
+	}
+	if result.Properties["category"] != "cat" {
+		t.Errorf("got properties %v, want category cat", result.Properties)
+	}
+
+	if result := run.Results[1]; result.RuleIndex != 1 || result.Level != "warning" || result.Locations != nil {
+		t.Errorf("unexpected result without position: %#v", result)
+	}
+}
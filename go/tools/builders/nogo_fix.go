@@ -0,0 +1,272 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// fixContextLines is the number of unchanged lines surrounding each hunk of
+// the generated patch, matching the default of diff -u.
+const fixContextLines = 3
+
+// fileEdit is a single replacement of the bytes [start, end) of a file.
+type fileEdit struct {
+	start, end int
+	newText    string
+}
+
+func (e fileEdit) overlaps(other fileEdit) bool {
+	if e == other {
+		// Several diagnostics may suggest the very same edit.
+		return false
+	}
+	if e.start == e.end && other.start == other.end {
+		// Two different insertions at the same offset have no well-defined order.
+		return e.start == other.start
+	}
+	return e.start < other.end && other.start < e.end
+}
+
+// buildFixPatch merges the given suggested fixes and returns them as a
+// unified diff with paths relative to root, suitable for patch -p1. Fixes are
+// considered in order: a fix is dropped as a whole if any of its edits
+// conflicts with an edit of a fix accepted before it. Edits to files outside
+// of root, such as generated files or files in external repositories, are
+// dropped since they can't be applied to the workspace.
+func buildFixPatch(fset *token.FileSet, root string, fixes []analysis.SuggestedFix) ([]byte, error) {
+	editsByFile := make(map[string][]fileEdit)
+	for _, fix := range fixes {
+		candidate, ok := fixEdits(fset, root, fix)
+		if !ok {
+			continue
+		}
+		if fixConflicts(editsByFile, candidate) {
+			continue
+		}
+		for name, edits := range candidate {
+		nextEdit:
+			for _, e := range edits {
+				for _, prev := range editsByFile[name] {
+					if e == prev {
+						continue nextEdit
+					}
+				}
+				editsByFile[name] = append(editsByFile[name], e)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(editsByFile))
+	for name := range editsByFile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	patch := &bytes.Buffer{}
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file to fix: %v", err)
+		}
+		edits := editsByFile[name]
+		sort.Slice(edits, func(i, j int) bool {
+			if edits[i].start != edits[j].start {
+				return edits[i].start < edits[j].start
+			}
+			return edits[i].end < edits[j].end
+		})
+		rel, _ := filepath.Rel(root, name)
+		writeFileDiff(patch, filepath.ToSlash(rel), string(content), edits)
+	}
+	return patch.Bytes(), nil
+}
+
+// fixEdits converts the edits of a suggested fix to byte offsets grouped by
+// file name. It returns false if the fix can't be applied to the workspace.
+func fixEdits(fset *token.FileSet, root string, fix analysis.SuggestedFix) (map[string][]fileEdit, bool) {
+	edits := make(map[string][]fileEdit)
+	for _, edit := range fix.TextEdits {
+		file := fset.File(edit.Pos)
+		if file == nil {
+			return nil, false
+		}
+		end := edit.End
+		if !end.IsValid() {
+			end = edit.Pos
+		}
+		start, stop := int(edit.Pos)-file.Base(), int(end)-file.Base()
+		if start < 0 || stop < start || stop > file.Size() {
+			return nil, false
+		}
+		name := file.Name()
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(root, name)
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || !isWorkspaceFile(rel) {
+			return nil, false
+		}
+		e := fileEdit{start: start, end: stop, newText: string(edit.NewText)}
+		for _, other := range edits[name] {
+			if e.overlaps(other) {
+				return nil, false
+			}
+		}
+		edits[name] = append(edits[name], e)
+	}
+	return edits, len(edits) > 0
+}
+
+// isWorkspaceFile reports whether the given execroot-relative path refers to
+// a source file of the main repository.
+func isWorkspaceFile(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	return rel != ".." && !strings.HasPrefix(rel, "../") &&
+		!strings.HasPrefix(rel, "bazel-out/") && !strings.HasPrefix(rel, "external/")
+}
+
+func fixConflicts(editsByFile map[string][]fileEdit, candidate map[string][]fileEdit) bool {
+	for name, edits := range candidate {
+		for _, e := range edits {
+			for _, prev := range editsByFile[name] {
+				if e.overlaps(prev) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// writeFileDiff writes a unified diff for content with the given sorted,
+// non-overlapping edits applied.
+func writeFileDiff(w *bytes.Buffer, path, content string, edits []fileEdit) {
+	lines := splitLines(content)
+	lineStarts := make([]int, len(lines)+1)
+	for i, line := range lines {
+		lineStarts[i+1] = lineStarts[i] + len(line)
+	}
+	lineOf := func(offset int) int {
+		return sort.Search(len(lines), func(i int) bool { return lineStarts[i+1] > offset })
+	}
+
+	// Group edits into hunks of whole lines. Edits whose context would overlap
+	// share a hunk.
+	type hunk struct {
+		lo, hi int // affected lines [lo, hi) of the original content
+		edits  []fileEdit
+	}
+	var hunks []*hunk
+	for _, e := range edits {
+		lo := lineOf(e.start)
+		if lo == len(lines) && lo > 0 && !strings.HasSuffix(lines[lo-1], "\n") {
+			// Appending to a file without a trailing newline changes its last line.
+			lo--
+		}
+		hi := lo
+		if e.end > e.start {
+			hi = lineOf(e.end - 1)
+		}
+		if hi++; hi > len(lines) {
+			hi = len(lines)
+		}
+		if n := len(hunks); n > 0 && lo <= hunks[n-1].hi+2*fixContextLines {
+			h := hunks[n-1]
+			if hi > h.hi {
+				h.hi = hi
+			}
+			h.edits = append(h.edits, e)
+			continue
+		}
+		hunks = append(hunks, &hunk{lo: lo, hi: hi, edits: []fileEdit{e}})
+	}
+
+	fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", path, path)
+	delta := 0
+	for _, h := range hunks {
+		regionStart, regionEnd := lineStarts[h.lo], lineStarts[h.hi]
+		var newRegion strings.Builder
+		pos := regionStart
+		for _, e := range h.edits {
+			newRegion.WriteString(content[pos:e.start])
+			newRegion.WriteString(e.newText)
+			pos = e.end
+		}
+		newRegion.WriteString(content[pos:regionEnd])
+		newLines := splitLines(newRegion.String())
+
+		ctxLo, ctxHi := h.lo-fixContextLines, h.hi+fixContextLines
+		if ctxLo < 0 {
+			ctxLo = 0
+		}
+		if ctxHi > len(lines) {
+			ctxHi = len(lines)
+		}
+		oldCount := ctxHi - ctxLo
+		newCount := oldCount - (h.hi - h.lo) + len(newLines)
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(ctxLo, oldCount), hunkRange(ctxLo+delta, newCount))
+		delta += newCount - oldCount
+		for _, line := range lines[ctxLo:h.lo] {
+			writeDiffLine(w, ' ', line)
+		}
+		for _, line := range lines[h.lo:h.hi] {
+			writeDiffLine(w, '-', line)
+		}
+		for _, line := range newLines {
+			writeDiffLine(w, '+', line)
+		}
+		for _, line := range lines[h.hi:ctxHi] {
+			writeDiffLine(w, ' ', line)
+		}
+	}
+}
+
+// hunkRange formats the range of a hunk header given its zero-based first line
+// and its number of lines.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before it.
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeDiffLine(w *bytes.Buffer, prefix byte, line string) {
+	w.WriteByte(prefix)
+	w.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// splitLines splits s into lines, each of which retains its trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const fixTestSrc = `package fix
+
+func a() {
+	x := 1
+	_ = x
+}
+
+func b() {}
+
+func c() {}
+
+func d() {}
+`
+
+func TestBuildFixPatch(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "pkg", "fix.go")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(fixTestSrc), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile(path, -1, len(fixTestSrc))
+	file.SetLinesForContent([]byte(fixTestSrc))
+	// edit replaces the first occurrence of old after the given prefix.
+	edit := func(after, old, new string) analysis.TextEdit {
+		offset := strings.Index(fixTestSrc, after) + len(after)
+		offset += strings.Index(fixTestSrc[offset:], old)
+		return analysis.TextEdit{
+			Pos:     file.Pos(offset),
+			End:     file.Pos(offset + len(old)),
+			NewText: []byte(new),
+		}
+	}
+	fix := func(edits ...analysis.TextEdit) analysis.SuggestedFix {
+		return analysis.SuggestedFix{TextEdits: edits}
+	}
+
+	tests := []struct {
+		name  string
+		fixes []analysis.SuggestedFix
+		want  string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "single edit",
+			fixes: []analysis.SuggestedFix{fix(edit("", "x := 1", "x := 2"))},
+			want: `--- a/pkg/fix.go
++++ b/pkg/fix.go
+@@ -1,7 +1,7 @@
+ package fix
+ 
+ func a() {
+-	x := 1
++	x := 2
+ 	_ = x
+ }
+ 
+`,
+		},
+		{
+			name: "duplicate and conflicting fixes",
+			fixes: []analysis.SuggestedFix{
+				fix(edit("", "x := 1", "x := 2")),
+				fix(edit("", "x := 1", "x := 2")),
+				fix(edit("", "1", "3"), edit("func d", "()", "(int)")),
+			},
+			want: `--- a/pkg/fix.go
++++ b/pkg/fix.go
+@@ -1,7 +1,7 @@
+ package fix
+ 
+ func a() {
+-	x := 1
++	x := 2
+ 	_ = x
+ }
+ 
+`,
+		},
+		{
+			name: "separate hunks",
+			fixes: []analysis.SuggestedFix{
+				fix(edit("", "package fix\n", "// Package fix is a test.\npackage fix\n")),
+				fix(edit("func d", "{}\n", "{\n}\n")),
+			},
+			want: `--- a/pkg/fix.go
++++ b/pkg/fix.go
+@@ -1,4 +1,5 @@
+-package fix
++// Package fix is a test.
++package fix
+ 
+ func a() {
+ 	x := 1
+@@ -9,4 +10,5 @@
+ 
+ func c() {}
+ 
+-func d() {}
++func d() {
++}
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := buildFixPatch(fset, root, tc.fixes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildFixPatchSkipsExternalFiles(t *testing.T) {
+	root := t.TempDir()
+	fset := token.NewFileSet()
+	file := fset.AddFile(filepath.Join(root, "bazel-out", "gen.go"), -1, len(fixTestSrc))
+	fixes := []analysis.SuggestedFix{{
+		TextEdits: []analysis.TextEdit{{Pos: file.Pos(0), End: file.Pos(1), NewText: []byte("P")}},
+	}}
+	got, err := buildFixPatch(fset, root, fixes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got patch for generated file:\n%s", got)
+	}
+}
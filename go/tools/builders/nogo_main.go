@@ -35,9 +35,11 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/gcexportdata"
@@ -77,8 +79,12 @@ func run(args []string) (error, int) {
 	importcfg := flags.String("importcfg", "", "The import configuration file")
 	packagePath := flags.String("p", "", "The package path (importmap) of the package being compiled")
 	xPath := flags.String("x", "", "The archive file where serialized facts should be written")
-	var ignores multiFlag
-	flags.Var(&ignores, "ignore", "Names of files to ignore")
+	fixPath := flags.String("fixpath", "", "The file where a patch with the suggested fixes should be written")
+	jsonPath := flags.String("json", "", "The file where the findings should be written in JSON format")
+	sarifPath := flags.String("sarif", "", "The file where the findings should be written in SARIF format")
+	profilePath := flags.String("profile", "", "The file where the timing profile should be written in JSON format")
+	var generated multiFlag
+	flags.Var(&generated, "generated", "Names of files generated from the package's sources, such as by cgo")
 	flags.Parse(args)
 	srcs := flags.Args()
 
@@ -87,7 +93,7 @@ func run(args []string) (error, int) {
 		return fmt.Errorf("error parsing importcfg: %v", err), nogoError
 	}
 
-	diagnostics, facts, err := checkPackage(analyzers, *packagePath, packageFile, importMap, factMap, srcs, ignores)
+	diagnostics, facts, results, err := checkPackage(analyzers, *packagePath, packageFile, importMap, factMap, srcs, generated)
 	if err != nil {
 		return fmt.Errorf("error running analyzers: %v", err), nogoError
 	}
@@ -97,6 +103,38 @@ func run(args []string) (error, int) {
 			return fmt.Errorf("error writing facts: %v", err), nogoError
 		}
 	}
+	// Likewise, always write the patch and the findings so that they are
+	// available even if the diagnostics fail the build.
+	if *fixPath != "" {
+		if err := ioutil.WriteFile(abs(*fixPath), results.fixes, 0o666); err != nil {
+			return fmt.Errorf("error writing fixes: %v", err), nogoError
+		}
+	}
+	if *jsonPath != "" {
+		if err := writeFindingsJSON(abs(*jsonPath), findingsFile{
+			Package:       *packagePath,
+			Findings:      results.findings,
+			StaleBaseline: results.stale,
+			Failed:        diagnostics != "",
+		}); err != nil {
+			return fmt.Errorf("error writing JSON findings: %v", err), nogoError
+		}
+	}
+	if *sarifPath != "" {
+		reported := analyzers
+		if strictNolint {
+			reported = append(append([]*analysis.Analyzer{}, analyzers...), nolintAnalyzer)
+		}
+		if err := writeFindingsSARIF(abs(*sarifPath), *packagePath, findingRules(reported), results.findings); err != nil {
+			return fmt.Errorf("error writing SARIF findings: %v", err), nogoError
+		}
+	}
+	if *profilePath != "" {
+		results.profile.Package = *packagePath
+		if err := writeProfile(abs(*profilePath), results.profile); err != nil {
+			return fmt.Errorf("error writing profile: %v", err), nogoError
+		}
+	}
 	if diagnostics != "" {
 		// debugMode is defined by the template in generate_nogo_main.go.
 		exitCode := nogoViolation
@@ -104,8 +142,14 @@ func run(args []string) (error, int) {
 			// Force actions running nogo to fail to help debug issues.
 			exitCode = nogoError
 		}
+		if results.warnings != "" {
+			diagnostics += "\n\n" + nogoWarningsHeader + "\n" + results.warnings
+		}
 		return fmt.Errorf("errors found by nogo during build-time code analysis:\n%s\n", diagnostics), exitCode
 	}
+	if results.warnings != "" {
+		return fmt.Errorf("%s\n%s\n", nogoWarningsHeader, results.warnings), nogoWarning
+	}
 
 	return nil, nogoSuccess
 }
@@ -154,11 +198,21 @@ func readImportCfg(file string) (packageFile map[string]string, importMap map[st
 }
 
 // checkPackage runs all the given analyzers on the specified package and
-// returns the source code diagnostics that the must be printed in the build log.
-// It returns an empty string if no source code diagnostics need to be printed.
+// returns the source code diagnostics that the must be printed in the build log
+// and fail the build.
+// It returns an empty string if no such source code diagnostics need to be printed.
+// Diagnostics in generatedFiles and in files marked as generated are only
+// reported where //line directives map them back to other files, unless the
+// configuration of the analyzer says otherwise.
+// It also returns the serialized facts as well as the printed diagnostics in
+// machine-readable form, a patch that applies their suggested fixes and the
+// timing profile of the analysis.
 //
 // This implementation was adapted from that of golang.org/x/tools/go/checker/internal/checker.
-func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames, ignoreFiles []string) (string, []byte, error) {
+func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames, generatedFiles []string) (string, []byte, packageResults, error) {
+	start := time.Now()
+	var profile nogoProfile
+
 	// Register fact types and establish dependencies between analyzers.
 	actions := make(map[*analysis.Analyzer]*action)
 	var visit func(a *analysis.Analyzer) *action
@@ -188,14 +242,14 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 		if cfg, ok := configs[a.Name]; ok {
 			for flagKey, flagVal := range cfg.analyzerFlags {
 				if strings.HasPrefix(flagKey, "-") {
-					return "", nil, fmt.Errorf(
+					return "", nil, packageResults{}, fmt.Errorf(
 						"%s: flag should not begin with '-': %s", a.Name, flagKey)
 				}
 				if flag := a.Flags.Lookup(flagKey); flag == nil {
-					return "", nil, fmt.Errorf("%s: unrecognized flag: %s", a.Name, flagKey)
+					return "", nil, packageResults{}, fmt.Errorf("%s: unrecognized flag: %s", a.Name, flagKey)
 				}
 				if err := a.Flags.Set(flagKey, flagVal); err != nil {
-					return "", nil, fmt.Errorf(
+					return "", nil, packageResults{}, fmt.Errorf(
 						"%s: invalid value for flag: %s=%s: %w", a.Name, flagKey, flagVal, err)
 				}
 			}
@@ -205,45 +259,50 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 
 	// Load the package, including AST, types, and facts.
 	imp := newImporter(importMap, packageFile, factMap)
-	pkg, err := load(packagePath, imp, filenames)
+	pkg, err := load(packagePath, imp, filenames, &profile)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading package: %v", err)
+		return "", nil, packageResults{}, fmt.Errorf("error loading package: %v", err)
 	}
 	for _, act := range actions {
 		act.pkg = pkg
 	}
 
-	ignoreFilesSet := map[string]struct{}{}
-	for _, ignore := range ignoreFiles {
-		ignoreFilesSet[ignore] = struct{}{}
+	pkg.generated = make(map[string]bool)
+	for _, filename := range generatedFiles {
+		pkg.generated[filename] = true
 	}
-	// Process nolint directives similar to golangci-lint.
-	// Also skip over fully ignored files.
 	for _, f := range pkg.syntax {
-		if _, ok := ignoreFilesSet[pkg.fset.Position(f.Pos()).Filename]; ok {
-			for _, act := range actions {
-				act.nolint = append(act.nolint, &Range{
-					from: pkg.fset.Position(f.Pos()),
-					to:   pkg.fset.Position(f.End()).Line,
-				})
-			}
-			continue
+		if isGenerated(f) {
+			pkg.generated[pkg.fset.File(f.Pos()).Name()] = true
 		}
+	}
+
+	var directives []*nolintDirective
+	// Process nolint directives similar to golangci-lint.
+	for _, f := range pkg.syntax {
 		// CommentMap will correctly associate comments to the largest node group
 		// applicable. This handles inline comments that might trail a large
 		// assignment and will apply the comment to the entire assignment.
 		commentMap := ast.NewCommentMap(pkg.fset, f, f.Comments)
 		for node, groups := range commentMap {
-			rng := &Range{
-				from: pkg.fset.Position(node.Pos()),
-				to:   pkg.fset.Position(node.End()).Line,
-			}
 			for _, group := range groups {
 				for _, comm := range group.List {
-					linters, ok := parseNolint(comm.Text)
+					linters, reason, ok := parseNolint(comm.Text)
 					if !ok {
 						continue
 					}
+					directive := &nolintDirective{
+						pos:     comm.Pos(),
+						end:     comm.End(),
+						linters: linters,
+						reason:  reason,
+					}
+					directives = append(directives, directive)
+					rng := &Range{
+						from:      pkg.fset.Position(node.Pos()),
+						to:        pkg.fset.Position(node.End()).Line,
+						directive: directive,
+					}
 					for analyzer, act := range actions {
 						if linters == nil || linters[analyzer.Name] {
 							act.nolint = append(act.nolint, rng)
@@ -257,15 +316,106 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	// Execute the analyzers.
 	execAll(roots)
 
+	// strictNolint is defined by the template in generate_nogo_main.go.
+	if strictNolint {
+		// Report problems with nolint directives like the diagnostics of an
+		// analyzer so that they can be configured in the same way.
+		roots = append(roots, checkNolint(roots, pkg, directives))
+	}
+
 	// Process diagnostics and encode facts for importers of this package.
-	diagnostics := checkAnalysisResults(roots, pkg)
+	diagnostics, warnings, entries, stale := checkAnalysisResults(roots, pkg)
+	encodeStart := time.Now()
 	facts := pkg.facts.Encode()
-	return diagnostics, facts, nil
+	profile.FactEncode = time.Since(encodeStart)
+
+	// Suggested fixes are alternatives, so only the first one of each
+	// diagnostic is applied.
+	var suggestedFixes []analysis.SuggestedFix
+	for _, d := range entries {
+		if !d.baselined && len(d.SuggestedFixes) > 0 {
+			suggestedFixes = append(suggestedFixes, d.SuggestedFixes[0])
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, packageResults{}, fmt.Errorf("error getting CWD: %v", err)
+	}
+	results := packageResults{
+		warnings: warnings,
+		findings: newFindings(pkg.fset, cwd, entries),
+		stale:    stale,
+	}
+	if len(suggestedFixes) > 0 {
+		if results.fixes, err = buildFixPatch(pkg.fset, cwd, suggestedFixes); err != nil {
+			return "", nil, packageResults{}, fmt.Errorf("error building suggested fixes: %v", err)
+		}
+	}
+
+	for a, act := range actions {
+		profile.Analyzers = append(profile.Analyzers, analyzerProfile{Name: a.Name, Time: act.duration})
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	profile.TotalAlloc, profile.Sys = mem.TotalAlloc, mem.Sys
+	profile.Total = time.Since(start)
+	results.profile = profile
+	return diagnostics, facts, results, nil
+}
+
+// packageResults holds the outputs of analyzing a package besides the errors
+// and the facts.
+type packageResults struct {
+	// warnings are the diagnostics that should be printed to the build log
+	// without failing the build.
+	warnings string
+	// fixes is a patch that applies the suggested fixes.
+	fixes []byte
+	// findings are the diagnostics in machine-readable form.
+	findings []finding
+	// stale are the baseline entries that no longer match any diagnostic.
+	stale []baselineEntry
+	// profile is the timing profile of the analysis.
+	profile nogoProfile
 }
 
 type Range struct {
 	from token.Position
 	to   int
+	// directive is the nolint directive that the range was created for, if any.
+	directive *nolintDirective
+}
+
+// nolintAnalyzer is the pseudo analyzer that reports problems with nolint
+// directives if strictNolint is set.
+var nolintAnalyzer = &analysis.Analyzer{
+	Name:             "nolint",
+	Doc:              "reports nolint directives without a reason, for unknown analyzers or that suppress nothing",
+	RunDespiteErrors: true,
+}
+
+// checkNolint returns an already executed action of nolintAnalyzer with the
+// problems of the given directives as its diagnostics.
+func checkNolint(roots []*action, pkg *goPackage, directives []*nolintDirective) *action {
+	known := make(map[string]bool)
+	ran := make(map[string]bool)
+	for _, act := range roots {
+		known[act.a.Name] = true
+		if act.err == nil && (!pkg.illTyped || act.a.RunDespiteErrors) {
+			ran[act.a.Name] = true
+		}
+	}
+	act := &action{a: nolintAnalyzer, pkg: pkg}
+	for _, d := range directives {
+		for _, problem := range d.problems(known, ran) {
+			act.diagnostics = append(act.diagnostics, analysis.Diagnostic{
+				Pos:     d.pos,
+				End:     d.end,
+				Message: problem,
+			})
+		}
+	}
+	return act
 }
 
 // An action represents one unit of analysis work: the application of
@@ -284,6 +434,9 @@ type action struct {
 	usesFacts   bool
 	err         error
 	nolint      []*Range
+	// duration is the time spent running the analyzer, excluding its
+	// prerequisites.
+	duration time.Duration
 }
 
 func (act *action) String() string {
@@ -343,6 +496,9 @@ func (act *action) execOnce() {
 				continue
 			}
 			// Found a nolint range. Ignore the issue.
+			if rng.directive != nil {
+				rng.directive.markUsed(act.a.Name)
+			}
 			return
 		}
 		act.diagnostics = append(act.diagnostics, d)
@@ -373,7 +529,9 @@ func (act *action) execOnce() {
 
 	var err error
 	if !act.pkg.illTyped || pass.Analyzer.RunDespiteErrors {
+		start := time.Now()
 		act.result, err = pass.Analyzer.Run(pass)
+		act.duration = time.Since(start)
 		if err == nil {
 			if got, want := reflect.TypeOf(act.result), pass.Analyzer.ResultType; got != want {
 				err = fmt.Errorf(
@@ -386,11 +544,13 @@ func (act *action) execOnce() {
 }
 
 // load parses and type checks the source code in each file in filenames.
-// load also deserializes facts stored for imported packages.
-func load(packagePath string, imp *importer, filenames []string) (*goPackage, error) {
+// load also deserializes facts stored for imported packages. The time spent in
+// each of these phases is recorded in profile.
+func load(packagePath string, imp *importer, filenames []string, profile *nogoProfile) (*goPackage, error) {
 	if len(filenames) == 0 {
 		return nil, errors.New("no filenames")
 	}
+	start := time.Now()
 	var syntax []*ast.File
 	for _, file := range filenames {
 		s, err := parser.ParseFile(imp.fset, file, nil, parser.ParseComments)
@@ -400,6 +560,7 @@ func load(packagePath string, imp *importer, filenames []string) (*goPackage, er
 		syntax = append(syntax, s)
 	}
 	pkg := &goPackage{fset: imp.fset, syntax: syntax}
+	profile.Parse = time.Since(start)
 
 	config := types.Config{Importer: imp}
 	info := &types.Info{
@@ -413,16 +574,20 @@ func load(packagePath string, imp *importer, filenames []string) (*goPackage, er
 
 	initInstanceInfo(info)
 
+	start = time.Now()
 	types, err := config.Check(packagePath, pkg.fset, syntax, info)
 	if err != nil {
 		pkg.illTyped, pkg.typeCheckError = true, err
 	}
 	pkg.types, pkg.typesInfo = types, info
+	profile.TypeCheck = time.Since(start)
 
+	start = time.Now()
 	pkg.facts, err = facts.NewDecoder(pkg.types).Decode(imp.readFacts)
 	if err != nil {
 		return nil, fmt.Errorf("internal error decoding facts: %v", err)
 	}
+	profile.FactDecode = time.Since(start)
 
 	return pkg, nil
 }
@@ -449,26 +614,87 @@ type goPackage struct {
 	// typesInfo provides type information about the package's syntax trees.
 	// It is set only when syntax is set.
 	typesInfo *types.Info
+	// generated contains the names of the files in syntax that are generated,
+	// either from the package's sources, such as by cgo, or by a tool that
+	// marks them as generated.
+	generated map[string]bool
 }
 
 func (g *goPackage) String() string {
 	return g.types.Path()
 }
 
+// inGeneratedCode reports whether pos is in a generated file and not mapped
+// to another file by a //line directive. The code generated by cgo for the
+// package's own code is mapped back to the original file in this way.
+func (g *goPackage) inGeneratedCode(pos token.Pos) bool {
+	if !pos.IsValid() {
+		return false
+	}
+	f := g.fset.File(pos)
+	if f == nil || !g.generated[f.Name()] {
+		return false
+	}
+	return g.fset.Position(pos).Filename == f.Name()
+}
+
+// generatedPattern matches the comment that marks a file as generated, see
+// https://go.dev/s/generatedcode.
+var generatedPattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether f has a comment before its package clause that
+// marks it as generated.
+func isGenerated(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedPattern.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// diagnosticEntry is a diagnostic together with the analyzer that reported it.
+type diagnosticEntry struct {
+	analysis.Diagnostic
+	*analysis.Analyzer
+	// severity is the configured severity of the analyzer.
+	severity string
+	// baselined is true if the diagnostic matches an entry in the baseline and
+	// is thus not printed.
+	baselined bool
+}
+
 // checkAnalysisResults checks the analysis diagnostics in the given actions
-// and returns a string containing all the diagnostics that should be printed
-// to the build log.
-func checkAnalysisResults(actions []*action, pkg *goPackage) string {
-	type entry struct {
-		analysis.Diagnostic
-		*analysis.Analyzer
-	}
-	var diagnostics []entry
+// and returns strings containing all the errors and all the warnings that
+// should be printed to the build log, as well as the diagnostics themselves
+// sorted by position, including those suppressed by the baseline. It also
+// returns the baseline entries for files in the package that no longer match
+// any diagnostic.
+func checkAnalysisResults(actions []*action, pkg *goPackage) (string, string, []diagnosticEntry, []baselineEntry) {
+	var diagnostics []diagnosticEntry
+	var stale []baselineEntry
 	var errs []error
 	cwd, err := os.Getwd()
 	if cwd == "" || err != nil {
 		errs = append(errs, fmt.Errorf("nogo failed to get CWD: %w", err))
 	}
+	relName := func(filename string) string {
+		if cwd != "" {
+			if relname, err := filepath.Rel(cwd, filename); err == nil {
+				return relname
+			}
+		}
+		return filename
+	}
+	pkgFiles := make(map[string]bool)
+	for _, f := range pkg.syntax {
+		pkgFiles[filepath.ToSlash(relName(pkg.fset.Position(f.Pos()).Filename))] = true
+	}
 	numSkipped := 0
 	for _, act := range actions {
 		if act.pkg.illTyped && !act.a.RunDespiteErrors {
@@ -481,9 +707,6 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 			errs = append(errs, fmt.Errorf("analyzer %q failed: %v", act.a.Name, act.err))
 			continue
 		}
-		if len(act.diagnostics) == 0 {
-			continue
-		}
 		var currentConfig config
 		// Use the base config if it exists.
 		if baseConfig, ok := configs[nogoBaseConfigName]; ok {
@@ -492,6 +715,9 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		// Overwrite the config with the desired config. Any unset fields
 		// in the config will default to the base config.
 		if actionConfig, ok := configs[act.a.Name]; ok {
+			if actionConfig.severity != "" {
+				currentConfig.severity = actionConfig.severity
+			}
 			if actionConfig.analyzerFlags != nil {
 				currentConfig.analyzerFlags = actionConfig.analyzerFlags
 			}
@@ -501,27 +727,50 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 			if actionConfig.excludeFiles != nil {
 				currentConfig.excludeFiles = actionConfig.excludeFiles
 			}
+			if actionConfig.reportGenerated != nil {
+				currentConfig.reportGenerated = actionConfig.reportGenerated
+			}
+			currentConfig.baseline = actionConfig.baseline
+		}
+		if len(act.diagnostics) == 0 && currentConfig.baseline == nil {
+			continue
+		}
+		severity := currentConfig.severity
+		if severity == "" {
+			severity = severityError
 		}
 
-		if currentConfig.onlyFiles == nil && currentConfig.excludeFiles == nil {
+		reportGenerated := currentConfig.reportGenerated != nil && *currentConfig.reportGenerated
+
+		if currentConfig.onlyFiles == nil && currentConfig.excludeFiles == nil && currentConfig.baseline == nil {
 			for _, diag := range act.diagnostics {
-				diagnostics = append(diagnostics, entry{Diagnostic: diag, Analyzer: act.a})
+				if !reportGenerated && pkg.inGeneratedCode(diag.Pos) {
+					continue
+				}
+				diagnostics = append(diagnostics, diagnosticEntry{Diagnostic: diag, Analyzer: act.a, severity: severity})
 			}
 			continue
 		}
+		// Match the baseline against diagnostics in order of position so that
+		// the same ones are suppressed on every run.
+		sort.SliceStable(act.diagnostics, func(i, j int) bool {
+			return act.diagnostics[i].Pos < act.diagnostics[j].Pos
+		})
+		remaining := make(map[string]int)
+		for _, e := range currentConfig.baseline {
+			remaining[e.key()] += e.Count
+		}
 		// Discard diagnostics based on the analyzer configuration.
 		for _, d := range act.diagnostics {
+			if !reportGenerated && pkg.inGeneratedCode(d.Pos) {
+				continue
+			}
 			// NOTE(golang.org/issue/31008): nilness does not set positions,
 			// so don't assume the position is valid.
 			p := pkg.fset.Position(d.Pos)
 			filename := "-"
 			if p.IsValid() {
-				filename = p.Filename
-			}
-			if cwd != "" {
-				if relname, err := filepath.Rel(cwd, filename); err == nil {
-					filename = relname
-				}
+				filename = relName(p.Filename)
 			}
 			include := true
 			if len(currentConfig.onlyFiles) > 0 {
@@ -542,8 +791,23 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 					}
 				}
 			}
-			if include {
-				diagnostics = append(diagnostics, entry{Diagnostic: d, Analyzer: act.a})
+			if !include {
+				continue
+			}
+			entry := diagnosticEntry{Diagnostic: d, Analyzer: act.a, severity: severity}
+			key := baselineKey(filepath.ToSlash(filename), findingFingerprint(d.Message))
+			if remaining[key] > 0 {
+				remaining[key]--
+				entry.baselined = true
+			}
+			diagnostics = append(diagnostics, entry)
+		}
+		// Entries for files in other packages can't be stale in this one.
+		for _, e := range currentConfig.baseline {
+			if n := remaining[e.key()]; n > 0 && pkgFiles[e.File] {
+				e.Count = n
+				stale = append(stale, e)
+				delete(remaining, e.key())
 			}
 		}
 	}
@@ -551,7 +815,7 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		errs = append(errs, fmt.Errorf("%d analyzers skipped due to type-checking error: %v", numSkipped, pkg.typeCheckError))
 	}
 	if len(diagnostics) == 0 && len(errs) == 0 {
-		return ""
+		return "", "", nil, stale
 	}
 
 	sort.Slice(diagnostics, func(i, j int) bool {
@@ -564,18 +828,103 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		sep = "\n"
 		errMsg.WriteString(err.Error())
 	}
+	warnMsg := &bytes.Buffer{}
+	warnSep := ""
 	for _, d := range diagnostics {
+		if d.baselined {
+			continue
+		}
+		if d.severity != severityError {
+			warnMsg.WriteString(warnSep)
+			warnSep = "\n"
+			fmt.Fprintf(warnMsg, "%s: %s: %s (%s)", pkg.fset.Position(d.Pos), d.severity, d.Message, d.Name)
+			continue
+		}
 		errMsg.WriteString(sep)
 		sep = "\n"
 		fmt.Fprintf(errMsg, "%s: %s (%s)", pkg.fset.Position(d.Pos), d.Message, d.Name)
 	}
-	return errMsg.String()
+	return errMsg.String(), warnMsg.String(), diagnostics, stale
+}
+
+// newFindings converts diagnostics to their machine-readable form with file
+// names relative to cwd.
+func newFindings(fset *token.FileSet, cwd string, diagnostics []diagnosticEntry) []finding {
+	toRange := func(pos, end token.Pos) findingRange {
+		// NOTE(golang.org/issue/31008): nilness does not set positions,
+		// so don't assume the position is valid.
+		start := fset.Position(pos)
+		if !start.IsValid() {
+			return findingRange{}
+		}
+		r := findingRange{
+			File:        start.Filename,
+			StartLine:   start.Line,
+			StartColumn: start.Column,
+		}
+		if rel, err := filepath.Rel(cwd, r.File); err == nil {
+			r.File = filepath.ToSlash(rel)
+		}
+		if stop := fset.Position(end); stop.IsValid() {
+			r.EndLine, r.EndColumn = stop.Line, stop.Column
+		}
+		return r
+	}
+
+	findings := make([]finding, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		f := finding{
+			Analyzer:    d.Analyzer.Name,
+			Category:    d.Category,
+			Severity:    d.severity,
+			Range:       toRange(d.Pos, d.End),
+			Message:     d.Message,
+			Fingerprint: findingFingerprint(d.Message),
+			Baselined:   d.baselined,
+		}
+		for _, related := range d.Related {
+			f.Related = append(f.Related, relatedFinding{
+				Range:   toRange(related.Pos, related.End),
+				Message: related.Message,
+			})
+		}
+		for _, fix := range d.SuggestedFixes {
+			ff := findingFix{Message: fix.Message, Edits: []findingEdit{}}
+			for _, edit := range fix.TextEdits {
+				end := edit.End
+				if !end.IsValid() {
+					end = edit.Pos
+				}
+				ff.Edits = append(ff.Edits, findingEdit{
+					Range:   toRange(edit.Pos, end),
+					NewText: string(edit.NewText),
+				})
+			}
+			f.SuggestedFixes = append(f.SuggestedFixes, ff)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// findingRules describes the given analyzers for SARIF output.
+func findingRules(analyzers []*analysis.Analyzer) []findingRule {
+	rules := make([]findingRule, 0, len(analyzers))
+	for _, a := range analyzers {
+		rules = append(rules, findingRule{Name: a.Name, Doc: a.Doc, URL: a.URL})
+	}
+	return rules
 }
 
 // config determines which source files an analyzer will emit diagnostics for.
 // config values are generated in another file that is compiled with
 // nogo_main.go by the nogo rule.
 type config struct {
+	// severity is one of severityError, severityWarning or severityInfo.
+	// Only diagnostics of analyzers with severityError fail the build. When
+	// empty, it defaults to severityError.
+	severity string
+
 	// onlyFiles is a list of regular expressions that match files an analyzer
 	// will emit diagnostics for. When empty, the analyzer will emit diagnostics
 	// for all files.
@@ -589,6 +938,21 @@ type config struct {
 	// to Analyzer.Flags. Note that no leading '-' should be present in a flag
 	// name
 	analyzerFlags map[string]string
+
+	// reportGenerated determines whether the analyzer will emit diagnostics for
+	// generated code that isn't mapped to another file by a //line directive.
+	// When nil, it defaults to false.
+	reportGenerated *bool
+
+	// baseline is a list of known findings of the analyzer that are not
+	// reported. Unlike the other fields, it is never inherited from the base
+	// config.
+	baseline []baselineEntry
+}
+
+// boolPtr is used by the generated configs to set optional boolean fields.
+func boolPtr(b bool) *bool {
+	return &b
 }
 
 // importer is an implementation of go/types.Importer that imports type
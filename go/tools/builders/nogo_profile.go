@@ -0,0 +1,71 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the timing profile of a nogo run.
+// Note that this file is shared between the nogo binary and the builder, which
+// writes an empty profile for packages without Go sources.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// nogoProfile is the top-level object of the profile written for a single
+// package. All durations are wall times in nanoseconds.
+type nogoProfile struct {
+	Package string `json:"package"`
+	// Total is the time spent in checkPackage, which includes all phases
+	// below as well as processing the diagnostics.
+	Total time.Duration `json:"total_ns"`
+	// Parse and TypeCheck are the phases of loading the package. TypeCheck
+	// includes reading the export data of the dependencies.
+	Parse     time.Duration `json:"parse_ns"`
+	TypeCheck time.Duration `json:"type_check_ns"`
+	// FactDecode and FactEncode are the times spent decoding the facts of the
+	// dependencies and encoding the facts of this package, respectively.
+	FactDecode time.Duration `json:"fact_decode_ns"`
+	FactEncode time.Duration `json:"fact_encode_ns"`
+	// Analyzers are sorted by name and include analyzers that only run as
+	// prerequisites of other analyzers. Since actions run concurrently, their
+	// times may add up to more than Total.
+	Analyzers []analyzerProfile `json:"analyzers"`
+	// TotalAlloc and Sys are the cumulative bytes allocated for heap objects
+	// and the bytes obtained from the OS by the nogo process, respectively.
+	TotalAlloc uint64 `json:"total_alloc_bytes"`
+	Sys        uint64 `json:"sys_bytes"`
+}
+
+// analyzerProfile is the time spent running a single analyzer, excluding the
+// time spent waiting for its prerequisites.
+type analyzerProfile struct {
+	Name string        `json:"name"`
+	Time time.Duration `json:"time_ns"`
+}
+
+func writeProfile(path string, profile nogoProfile) error {
+	if profile.Analyzers == nil {
+		profile.Analyzers = []analyzerProfile{}
+	}
+	sort.Slice(profile.Analyzers, func(i, j int) bool {
+		return profile.Analyzers[i].Name < profile.Analyzers[j].Name
+	})
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o666)
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.json")
+	if err := writeProfile(path, nogoProfile{
+		Package:   "example.com/src",
+		Total:     5 * time.Millisecond,
+		TypeCheck: 2 * time.Millisecond,
+		Analyzers: []analyzerProfile{
+			{Name: "printf", Time: 3 * time.Millisecond},
+			{Name: "inspect", Time: time.Millisecond},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"type_check_ns": 2000000`) {
+		t.Errorf("profile doesn't contain the type check time in nanoseconds:\n%s", data)
+	}
+	var got nogoProfile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []analyzerProfile{
+		{Name: "inspect", Time: time.Millisecond},
+		{Name: "printf", Time: 3 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(got.Analyzers, want) {
+		t.Errorf("got analyzers %v, want %v", got.Analyzers, want)
+	}
+}
+
+func TestWriteEmptyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := writeProfile(path, nogoProfile{Package: "example.com/empty"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"analyzers": []`) {
+		t.Errorf("empty profile doesn't contain an empty list of analyzers:\n%s", data)
+	}
+}
@@ -8,6 +8,8 @@ import (
 func nogoValidation(args []string) error {
 	validationOutput := args[0]
 	logFile := args[1]
+	fixFile := args[2]
+	jsonFile := args[3]
 	// Always create the output file and only fail if the log file is non-empty to
 	// avoid an "action failed to create outputs" error.
 	logContent, err := os.ReadFile(logFile);
@@ -19,10 +21,30 @@ func nogoValidation(args []string) error {
 		return err
 	}
 	if len(logContent) > 0 {
+		findings, err := readFindingsJSON(jsonFile)
+		if err != nil {
+			return err
+		}
+		// Only print the diagnostics of analyzers that aren't configured to
+		// fail the build.
+		if !findings.Failed {
+			_, _ = fmt.Fprintf(os.Stderr, "\n%s", logContent)
+			return nil
+		}
+		fixContent, err := os.ReadFile(fixFile)
+		if err != nil {
+			return err
+		}
+		var fixMsg string
+		if len(fixContent) > 0 {
+			fixMsg = "\nSome of these findings have suggested fixes. To apply them, run:\n" +
+				"bazel build --norun_validations --output_groups=nogo_fix <targets> && " +
+				"bazel run @io_bazel_rules_go//go/tools/nogo_fix -- $(bazel info bazel-bin)\n"
+		}
 		// Separate nogo output from Bazel's --sandbox_debug message via an
 		// empty line.
 		// Don't return to avoid printing the "nogovalidation:" prefix.
-		_, _ = fmt.Fprintf(os.Stderr, "\n%s\n", logContent)
+		_, _ = fmt.Fprintf(os.Stderr, "\n%s\n%s", logContent, fixMsg)
 		os.Exit(1)
 	}
 	return nil
@@ -14,31 +14,94 @@
 
 package main
 
-import "strings"
+import (
+	"go/token"
+	"sort"
+	"strings"
+	"sync"
+)
 
-// Parse nolint directives and return the applicable linters. If all linters
-// apply, returns (nil, true).
-func parseNolint(text string) (map[string]bool, bool) {
+// Parse nolint directives and return the applicable linters as well as the
+// explanation following the directive. If all linters apply, the returned map
+// is nil.
+func parseNolint(text string) (map[string]bool, string, bool) {
 	text = strings.TrimLeft(text, "/ ")
 	if !strings.HasPrefix(text, "nolint") {
-		return nil, false
+		return nil, "", false
 	}
 
-	// strip explanation comments
-	split := strings.Split(text, "//")
+	// split off explanation comments
+	split := strings.SplitN(text, "//", 2)
 	text = strings.TrimSpace(split[0])
+	var reason string
+	if len(split) == 2 {
+		reason = strings.TrimSpace(split[1])
+	}
 
 	parts := strings.Split(text, ":")
 	if len(parts) == 1 {
-		return nil, true
+		return nil, reason, true
 	}
 	linters := strings.Split(parts[1], ",")
 	result := map[string]bool{}
 	for _, linter := range linters {
 		if strings.EqualFold(linter, "all") {
-			return nil, true
+			return nil, reason, true
 		}
 		result[linter] = true
 	}
-	return result, true
+	return result, reason, true
+}
+
+// nolintDirective is a nolint comment in the analyzed package. It records the
+// linters whose diagnostics it suppressed, which may happen concurrently.
+type nolintDirective struct {
+	pos, end token.Pos
+	// linters are the linters the directive applies to, or nil for all.
+	linters map[string]bool
+	reason  string
+
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func (d *nolintDirective) markUsed(linter string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.used == nil {
+		d.used = make(map[string]bool)
+	}
+	d.used[linter] = true
+}
+
+// problems returns the messages describing why the directive is invalid or
+// unnecessary. known contains the names of all registered linters and ran
+// those that were run successfully, so that the directive is only reported as
+// unused if all linters it applies to had a chance to report diagnostics.
+func (d *nolintDirective) problems(known, ran map[string]bool) []string {
+	var problems []string
+	if d.reason == "" {
+		problems = append(problems, "nolint directive must explain why the diagnostics are suppressed, e.g. //nolint:name // reason")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.linters == nil {
+		if len(d.used) == 0 && len(ran) == len(known) {
+			problems = append(problems, "nolint directive is unused")
+		}
+		return problems
+	}
+	linters := make([]string, 0, len(d.linters))
+	for linter := range d.linters {
+		linters = append(linters, linter)
+	}
+	sort.Strings(linters)
+	for _, linter := range linters {
+		if !known[linter] {
+			problems = append(problems, "nolint directive names unknown analyzer "+linter)
+		} else if ran[linter] && !d.used[linter] {
+			problems = append(problems, "nolint directive is unused for "+linter)
+		}
+	}
+	return problems
 }
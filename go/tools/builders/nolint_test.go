@@ -25,6 +25,7 @@ func TestParseNolint(t *testing.T) {
 		Comment string
 		Valid   bool
 		Linters []string
+		Reason  string
 	}{
 		{
 			Name:    "Invalid",
@@ -55,6 +56,7 @@ func TestParseNolint(t *testing.T) {
 			Comment: "//nolint:foo // the foo lint is invalid for this line",
 			Valid:   true,
 			Linters: []string{"foo"},
+			Reason:  "the foo lint is invalid for this line",
 		},
 		{
 			Name:    "Multiple linters",
@@ -67,12 +69,25 @@ func TestParseNolint(t *testing.T) {
 			Comment: "// nolint:a,b,c // some reason",
 			Valid:   true,
 			Linters: []string{"a", "b", "c"},
+			Reason:  "some reason",
+		},
+		{
+			Name:    "Explanation containing slashes",
+			Comment: "//nolint // see https://example.com",
+			Valid:   true,
+			Reason:  "see https://example.com",
+		},
+		{
+			Name:    "Empty explanation",
+			Comment: "//nolint:foo // ",
+			Valid:   true,
+			Linters: []string{"foo"},
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.Name, func(t *testing.T) {
-			result, ok := parseNolint(tc.Comment)
+			result, reason, ok := parseNolint(tc.Comment)
 			if tc.Valid != ok {
 				t.Fatalf("parseNolint expect %t got %t", tc.Valid, ok)
 			}
@@ -86,6 +101,85 @@ func TestParseNolint(t *testing.T) {
 			if !reflect.DeepEqual(result, linters) {
 				t.Fatalf("parseNolint expect %v got %v", linters, result)
 			}
+			if reason != tc.Reason {
+				t.Fatalf("parseNolint expect reason %q got %q", tc.Reason, reason)
+			}
+		})
+	}
+}
+
+func TestNolintDirectiveProblems(t *testing.T) {
+	known := map[string]bool{"a": true, "b": true, "c": true}
+	ran := map[string]bool{"a": true, "b": true}
+	tests := []struct {
+		Name     string
+		Comment  string
+		Used     []string
+		Ran      map[string]bool
+		Problems []string
+	}{
+		{
+			Name:    "Used",
+			Comment: "//nolint:a // reason",
+			Used:    []string{"a"},
+		},
+		{
+			Name:     "Without reason",
+			Comment:  "//nolint:a",
+			Used:     []string{"a"},
+			Problems: []string{"nolint directive must explain why the diagnostics are suppressed, e.g. //nolint:name // reason"},
+		},
+		{
+			Name:     "Unknown analyzer",
+			Comment:  "//nolint:a,unknown // reason",
+			Used:     []string{"a"},
+			Problems: []string{"nolint directive names unknown analyzer unknown"},
+		},
+		{
+			Name:     "Partially unused",
+			Comment:  "//nolint:a,b // reason",
+			Used:     []string{"a"},
+			Problems: []string{"nolint directive is unused for b"},
+		},
+		{
+			Name:    "Analyzer that didn't run",
+			Comment: "//nolint:c // reason",
+		},
+		{
+			Name:     "Unused for all analyzers",
+			Comment:  "//nolint // reason",
+			Ran:      known,
+			Problems: []string{"nolint directive is unused"},
+		},
+		{
+			Name:    "Not all analyzers ran",
+			Comment: "//nolint // reason",
+		},
+		{
+			Name:    "Used by any analyzer",
+			Comment: "//nolint // reason",
+			Used:    []string{"b"},
+			Ran:     known,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			linters, reason, ok := parseNolint(tc.Comment)
+			if !ok {
+				t.Fatalf("parseNolint(%q) failed", tc.Comment)
+			}
+			d := &nolintDirective{linters: linters, reason: reason}
+			for _, linter := range tc.Used {
+				d.markUsed(linter)
+			}
+			r := ran
+			if tc.Ran != nil {
+				r = tc.Ran
+			}
+			if problems := d.problems(known, r); !reflect.DeepEqual(problems, tc.Problems) {
+				t.Fatalf("got problems %q, want %q", problems, tc.Problems)
+			}
 		})
 	}
 }
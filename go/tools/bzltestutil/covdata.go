@@ -0,0 +1,434 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// nativeCoverage is set to "1" by the linker if the test has been built with
+// native coverage instrumentation
+// (--@io_bazel_rules_go//go/config:native_coverage).
+var nativeCoverage string
+
+// goCoverDir is the directory to which binaries built with native coverage
+// instrumentation write their covdata files. It is exported as GOCOVERDIR
+// before the coverage runtime of the test binary is initialized, so that
+// the test as well as all binaries it runs write to the same directory.
+var goCoverDir = setUpGoCoverDir()
+
+func setUpGoCoverDir() string {
+	if nativeCoverage == "" || coverageDir == "" {
+		return ""
+	}
+	// The test wrapper has already created the directory for the test.
+	if dir := os.Getenv("GOCOVERDIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.MkdirTemp(os.Getenv("TEST_TMPDIR"), "gocoverdir")
+	if err != nil {
+		log.Printf("Not collecting coverage: %s", err)
+		return ""
+	}
+	os.Setenv("GOCOVERDIR", dir)
+	return dir
+}
+
+// ConvertCovdataToLcov converts the covdata files written to GOCOVERDIR to
+// the lcov format and stores them in COVERAGE_DIR, where they are picked up
+// by Bazel. It has to be called after the test process has exited, since
+// the counters are only written on exit.
+func ConvertCovdataToLcov() error {
+	if goCoverDir == "" {
+		return nil
+	}
+	var profile bytes.Buffer
+	found, err := writeCoverProfile(&profile, goCoverDir)
+	if err != nil {
+		return err
+	}
+	if !found {
+		log.Printf("Not collecting coverage: no covdata files have been written to %s", goCoverDir)
+		return nil
+	}
+
+	// All *.dat files in $COVERAGE_DIR will be merged by Bazel's lcov_merger tool.
+	out, err := os.CreateTemp(coverageDir, "go_coverage.*.dat")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return convertCoverToLcov(&profile, out)
+}
+
+// The covdata file format is defined in internal/coverage/defs.go of the Go
+// distribution. Only the parts needed to recover the coverage profile are
+// decoded here.
+var (
+	covMetaMagic    = [4]byte{0x00, 0x63, 0x76, 0x6d}
+	covCounterMagic = [4]byte{0x00, 0x63, 0x77, 0x6d}
+)
+
+const (
+	covMetaFileVersion       = 1
+	covMetaFileHeaderSize    = 56
+	covMetaSymbolHeaderSize  = 44
+	covCounterFileVersion    = 1
+	covCounterFileHeaderSize = 32
+	covCounterFileFooterSize = 16
+	covCounterFlavorRaw      = 1
+	covCounterFlavorULEB128  = 2
+	covCounterModeSet        = 1
+	covCounterModeCount      = 2
+	covCounterModeAtomic     = 3
+	covMetaFileNamePrefix    = "covmeta."
+	covCounterFileNamePrefix = "covcounters."
+)
+
+// coverBlock is a sequence of statements that share a counter, as recorded in
+// the coverage profile written by "go test -coverprofile".
+type coverBlock struct {
+	file                                 string
+	startLine, startCol, endLine, endCol uint32
+	numStmts                             uint32
+}
+
+// writeCoverProfile merges the covdata files in dir into a coverage profile in
+// the text format of "go test -coverprofile". It returns false if dir does not
+// contain any meta-data files.
+func writeCoverProfile(w io.Writer, dir string) (bool, error) {
+	metaFiles, err := filepath.Glob(filepath.Join(dir, covMetaFileNamePrefix+"*"))
+	if err != nil {
+		return false, err
+	}
+	if len(metaFiles) == 0 {
+		return false, nil
+	}
+
+	mode := ""
+	counts := make(map[coverBlock]uint32)
+	for _, metaFile := range metaFiles {
+		pkgs, cmode, err := readCovMetaFile(metaFile)
+		if err != nil {
+			return false, err
+		}
+		if mode == "" {
+			switch cmode {
+			case covCounterModeSet:
+				mode = "set"
+			case covCounterModeCount:
+				mode = "count"
+			case covCounterModeAtomic:
+				mode = "atomic"
+			}
+		}
+		// Blocks of functions that have not been executed are not present in
+		// the counter files.
+		for _, funcs := range pkgs {
+			for _, blocks := range funcs {
+				for _, b := range blocks {
+					if _, ok := counts[b]; !ok {
+						counts[b] = 0
+					}
+				}
+			}
+		}
+
+		// Counter files are named after the hash of their meta-data file.
+		hash := strings.TrimPrefix(filepath.Base(metaFile), covMetaFileNamePrefix)
+		counterFiles, err := filepath.Glob(filepath.Join(dir, covCounterFileNamePrefix+hash+".*"))
+		if err != nil {
+			return false, err
+		}
+		for _, counterFile := range counterFiles {
+			err := readCovCounterFile(counterFile, func(pkgIdx, funcIdx uint32, counters []uint32) error {
+				if int(pkgIdx) >= len(pkgs) || int(funcIdx) >= len(pkgs[pkgIdx]) {
+					return fmt.Errorf("%s: counters for unknown function %d of package %d", counterFile, funcIdx, pkgIdx)
+				}
+				for i, b := range pkgs[pkgIdx][funcIdx] {
+					if i >= len(counters) || counters[i] == 0 {
+						continue
+					}
+					if cmode == covCounterModeSet {
+						counts[b] = 1
+					} else {
+						counts[b] += counters[i]
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	blocks := make([]coverBlock, 0, len(counts))
+	for b := range counts {
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		bi, bj := blocks[i], blocks[j]
+		if bi.file != bj.file {
+			return bi.file < bj.file
+		}
+		if bi.startLine != bj.startLine {
+			return bi.startLine < bj.startLine
+		}
+		if bi.startCol != bj.startCol {
+			return bi.startCol < bj.startCol
+		}
+		if bi.endLine != bj.endLine {
+			return bi.endLine < bj.endLine
+		}
+		return bi.endCol < bj.endCol
+	})
+	if mode == "" {
+		mode = "set"
+	}
+	if _, err := fmt.Fprintf(w, "mode: %s\n", mode); err != nil {
+		return false, err
+	}
+	for _, b := range blocks {
+		if _, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", b.file, b.startLine, b.startCol, b.endLine, b.endCol, b.numStmts, counts[b]); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// readCovMetaFile returns the blocks of each function of each package in a
+// meta-data file as well as the counter mode of the program.
+func readCovMetaFile(path string) (pkgs [][][]coverBlock, cmode byte, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < covMetaFileHeaderSize || !bytes.Equal(data[:4], covMetaMagic[:]) {
+		return nil, 0, fmt.Errorf("%s: not a coverage meta-data file", path)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v > covMetaFileVersion {
+		return nil, 0, fmt.Errorf("%s: unsupported meta-data file version %d", path, v)
+	}
+	numPkgs := binary.LittleEndian.Uint64(data[16:])
+	cmode = data[48]
+
+	r := &covdataReader{b: data, off: covMetaFileHeaderSize}
+	offsets := make([]uint64, 0, 16)
+	for i := uint64(0); i < numPkgs && r.err == nil; i++ {
+		offsets = append(offsets, r.uint64())
+	}
+	lengths := make([]uint64, 0, len(offsets))
+	for range offsets {
+		lengths = append(lengths, r.uint64())
+	}
+	if r.err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", path, r.err)
+	}
+	for i, off := range offsets {
+		if off > uint64(len(data)) || lengths[i] > uint64(len(data))-off {
+			return nil, 0, fmt.Errorf("%s: invalid offset of package %d", path, i)
+		}
+		funcs, err := readCovMetaPackage(data[off : off+lengths[i]])
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: package %d: %v", path, i, err)
+		}
+		pkgs = append(pkgs, funcs)
+	}
+	return pkgs, cmode, nil
+}
+
+// readCovMetaPackage returns the blocks of each function in the meta-data of
+// a single package.
+func readCovMetaPackage(data []byte) ([][]coverBlock, error) {
+	r := &covdataReader{b: data, off: covMetaSymbolHeaderSize - 4}
+	numFuncs := r.uint32()
+	funcOffsets := make([]uint32, 0, 16)
+	for i := uint32(0); i < numFuncs && r.err == nil; i++ {
+		funcOffsets = append(funcOffsets, r.uint32())
+	}
+	strs := r.stringTable()
+
+	funcs := make([][]coverBlock, 0, len(funcOffsets))
+	for _, off := range funcOffsets {
+		r.seek(int(off))
+		numUnits := r.uleb128()
+		r.uleb128() // function name
+		fileIdx := r.uleb128()
+		if r.err == nil && int(fileIdx) >= len(strs) {
+			return nil, errors.New("invalid file name index")
+		}
+		var blocks []coverBlock
+		for i := uint32(0); i < numUnits && r.err == nil; i++ {
+			blocks = append(blocks, coverBlock{
+				file:      strs[fileIdx],
+				startLine: r.uleb128(),
+				startCol:  r.uleb128(),
+				endLine:   r.uleb128(),
+				endCol:    r.uleb128(),
+				numStmts:  r.uleb128(),
+			})
+		}
+		funcs = append(funcs, blocks)
+	}
+	return funcs, r.err
+}
+
+// readCovCounterFile calls visit with the counters of each function in a
+// counter data file.
+func readCovCounterFile(path string, visit func(pkgIdx, funcIdx uint32, counters []uint32) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) < covCounterFileHeaderSize+covCounterFileFooterSize || !bytes.Equal(data[:4], covCounterMagic[:]) {
+		return fmt.Errorf("%s: not a coverage counter data file", path)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v > covCounterFileVersion {
+		return fmt.Errorf("%s: unsupported counter data file version %d", path, v)
+	}
+	flavor := data[24]
+	bigEndian := data[25] != 0
+	numSegments := binary.LittleEndian.Uint32(data[len(data)-covCounterFileFooterSize+8:])
+
+	r := &covdataReader{b: data, off: covCounterFileHeaderSize}
+	readCounter := func() uint32 {
+		switch {
+		case flavor == covCounterFlavorULEB128:
+			return r.uleb128()
+		case bigEndian:
+			v := r.uint32()
+			return v>>24 | (v>>8)&0xff00 | (v<<8)&0xff0000 | v<<24
+		default:
+			return r.uint32()
+		}
+	}
+	if flavor != covCounterFlavorRaw && flavor != covCounterFlavorULEB128 {
+		return fmt.Errorf("%s: unknown counter flavor %d", path, flavor)
+	}
+	for seg := uint32(0); seg < numSegments && r.err == nil; seg++ {
+		numFuncs := r.uint64()
+		strTabLen := r.uint32()
+		argsLen := r.uint32()
+		// The arguments of the process are padded to a multiple of four bytes.
+		r.seek(r.off + int(strTabLen) + int(argsLen))
+		r.seek((r.off + 3) &^ 3)
+		for i := uint64(0); i < numFuncs && r.err == nil; i++ {
+			numCounters := readCounter()
+			pkgIdx := readCounter()
+			funcIdx := readCounter()
+			counters := make([]uint32, 0, 16)
+			for j := uint32(0); j < numCounters && r.err == nil; j++ {
+				counters = append(counters, readCounter())
+			}
+			if r.err != nil {
+				break
+			}
+			if err := visit(pkgIdx, funcIdx, counters); err != nil {
+				return err
+			}
+		}
+		r.seek(r.off + covCounterFileFooterSize)
+	}
+	if r.err != nil {
+		return fmt.Errorf("%s: %v", path, r.err)
+	}
+	return nil
+}
+
+// covdataReader decodes the little-endian and ULEB128 encoded values of
+// covdata files. Reads beyond the end of the data are reported in err.
+type covdataReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *covdataReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("unexpected end of data")
+	}
+	r.off = len(r.b)
+}
+
+func (r *covdataReader) seek(off int) {
+	if off < 0 || off > len(r.b) {
+		r.fail()
+		return
+	}
+	r.off = off
+}
+
+func (r *covdataReader) uint32() uint32 {
+	if len(r.b)-r.off < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b[r.off:])
+	r.off += 4
+	return v
+}
+
+func (r *covdataReader) uint64() uint64 {
+	if len(r.b)-r.off < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b[r.off:])
+	r.off += 8
+	return v
+}
+
+func (r *covdataReader) uleb128() uint32 {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if r.off >= len(r.b) {
+			break
+		}
+		c := r.b[r.off]
+		r.off++
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return uint32(v)
+		}
+	}
+	r.fail()
+	return 0
+}
+
+func (r *covdataReader) stringTable() []string {
+	n := r.uleb128()
+	var strs []string
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		l := int(r.uleb128())
+		if len(r.b)-r.off < l {
+			r.fail()
+			break
+		}
+		strs = append(strs, string(r.b[r.off:r.off+l]))
+		r.off += l
+	}
+	return strs
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteCoverProfile(t *testing.T) {
+	// The covdata files in testdata have been written by a binary whose main
+	// package and library have been instrumented in atomic mode. The
+	// expected output matches that of "go tool covdata textfmt".
+	var out strings.Builder
+	found, err := writeCoverProfile(&out, "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("no covdata files found")
+	}
+	expected := `mode: atomic
+src/cmd/main.go:10.2,11.1 1 1
+src/lib/lib.go:4.2,4.14 1 1
+src/lib/lib.go:5.3,6.1 1 0
+src/lib/lib.go:7.2,7.23 1 1
+`
+	if got := out.String(); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestWriteCoverProfileEmpty(t *testing.T) {
+	var out strings.Builder
+	found, err := writeCoverProfile(&out, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found || out.Len() != 0 {
+		t.Errorf("got %q for a directory without covdata files", out.String())
+	}
+}
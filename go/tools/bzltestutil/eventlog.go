@@ -0,0 +1,89 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// eventLogFile is the name of the file in TEST_UNDECLARED_OUTPUTS_DIR that
+// holds the test2json events of all runs of the test binary, in the format of
+// 'go test -json'.
+const eventLogFile = "test2json.json"
+
+// eventLog holds the test2json events written by the wrapper. The events are
+// streamed to eventLogFile and synced after each event, so that the events
+// of a test that is killed are kept. Without an undeclared outputs directory,
+// they are only kept in memory.
+type eventLog struct {
+	file *os.File
+	buf  bytes.Buffer
+	size int64
+}
+
+// openEventLog creates the event log of the test.
+func openEventLog() (*eventLog, error) {
+	l := &eventLog{}
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(filepath.Join(outDir, eventLogFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	l.file = f
+	return l, nil
+}
+
+// Write appends events to the log. The test2json converter writes one event
+// per call.
+func (l *eventLog) Write(p []byte) (int, error) {
+	if l.file == nil {
+		n, err := l.buf.Write(p)
+		l.size += int64(n)
+		return n, err
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	return n, err
+}
+
+// offset returns the position in the log at which the next event is written.
+func (l *eventLog) offset() int64 {
+	return l.size
+}
+
+// section returns a reader of the events written between the offsets start
+// and end.
+func (l *eventLog) section(start, end int64) io.Reader {
+	if l.file == nil {
+		return bytes.NewReader(l.buf.Bytes()[start:end])
+	}
+	return io.NewSectionReader(l.file, start, end-start)
+}
+
+func (l *eventLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
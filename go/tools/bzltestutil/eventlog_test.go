@@ -0,0 +1,69 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		outDir bool
+	}{
+		{desc: "file", outDir: true},
+		{desc: "memory"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			outDir := ""
+			if test.outDir {
+				outDir = t.TempDir()
+			}
+			t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+
+			events, err := openEventLog()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer events.Close()
+			first := `{"Action":"run","Test":"TestA"}` + "\n"
+			second := `{"Action":"run","Test":"TestB"}` + "\n"
+			io.WriteString(events, first)
+			start := events.offset()
+			io.WriteString(events, second)
+
+			got, err := ioutil.ReadAll(events.section(start, events.offset()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != second {
+				t.Errorf("got section %q, want %q", got, second)
+			}
+			if !test.outDir {
+				return
+			}
+			data, err := ioutil.ReadFile(filepath.Join(outDir, eventLogFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != first+second {
+				t.Errorf("got %s %q, want %q", eventLogFile, data, first+second)
+			}
+		})
+	}
+}
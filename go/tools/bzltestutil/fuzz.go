@@ -0,0 +1,104 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
+)
+
+// fuzzCorpusEntry is identical to testing.corpusEntry and
+// internal/fuzz.CorpusEntry, which are both aliases of this struct type.
+type fuzzCorpusEntry = struct {
+	Parent     string
+	Path       string
+	Data       []byte
+	Values     []interface{}
+	Generation int
+	IsSeed     bool
+}
+
+// FuzzTestDeps is a patched version of testdeps.TestDeps that writes the
+// inputs that crash a fuzz target to the source tree of the workspace when
+// the test is run with bazel run, while the seed corpus is still read from
+// the runfiles. It wraps LcovTestDeps, which only converts the coverage
+// profile if Lcov is set, since tests can both be fuzzed and collect coverage.
+// Like LcovTestDeps, this relies on the method being identical to the one of
+// the testing.testDeps interface.
+type FuzzTestDeps struct {
+	LcovTestDeps
+	Lcov bool
+}
+
+// SetPanicOnExit0 only converts the coverage profile to lcov if Lcov is set.
+func (ftd FuzzTestDeps) SetPanicOnExit0(panicOnExit bool) {
+	if ftd.Lcov {
+		ftd.LcovTestDeps.SetPanicOnExit0(panicOnExit)
+	} else {
+		ftd.TestDeps.SetPanicOnExit0(panicOnExit)
+	}
+}
+
+// CoordinateFuzzing is called by the fuzzing coordinator after the seed corpus
+// has been read from corpusDir, which is relative to the directory the test
+// runs in.
+func (ftd FuzzTestDeps) CoordinateFuzzing(
+	timeout time.Duration,
+	limit int64,
+	minimizeTimeout time.Duration,
+	minimizeLimit int64,
+	parallel int,
+	seed []fuzzCorpusEntry,
+	types []reflect.Type,
+	corpusDir,
+	cacheDir string) error {
+	return ftd.TestDeps.CoordinateFuzzing(timeout, limit, minimizeTimeout, minimizeLimit, parallel, seed, types, workspaceCorpusDir(corpusDir), cacheDir)
+}
+
+// workspaceCorpusDir returns the directory in the source tree that
+// corresponds to corpusDir if the test is run with bazel run, and corpusDir
+// otherwise. Tests in external repositories have no such directory.
+func workspaceCorpusDir(corpusDir string) string {
+	workspace := os.Getenv("BUILD_WORKSPACE_DIRECTORY")
+	if workspace == "" || filepath.IsAbs(corpusDir) || strings.HasPrefix(chdir.RunDir, "..") {
+		return corpusDir
+	}
+	return filepath.Join(workspace, filepath.FromSlash(chdir.RunDir), corpusDir)
+}
+
+// RegisterFuzzCacheDir sets -test.fuzzcachedir, which is required to fuzz,
+// to the fuzz cache that 'go test' uses for the package, in GOCACHE or in
+// the default Go build cache. Tests run with bazel test, which can't write
+// outside of their sandbox, use TEST_TMPDIR instead. A directory set on the
+// command line takes precedence.
+func RegisterFuzzCacheDir(pkg string) {
+	cacheDir := os.Getenv("GOCACHE")
+	if os.Getenv("BUILD_WORKSPACE_DIRECTORY") == "" && os.Getenv("TEST_TMPDIR") != "" {
+		cacheDir = os.Getenv("TEST_TMPDIR")
+	} else if cacheDir == "" || cacheDir == "off" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return
+		}
+		cacheDir = filepath.Join(userCacheDir, "go-build")
+	}
+	flag.Lookup("test.fuzzcachedir").Value.Set(filepath.Join(cacheDir, "fuzz", filepath.FromSlash(pkg)))
+}
@@ -18,14 +18,20 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"testing/internal/testdeps"
+
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
 )
 
 // Lock in the COVERAGE_DIR during test setup in case the test uses e.g. os.Clearenv.
@@ -34,7 +40,7 @@ var coverageDir = os.Getenv("COVERAGE_DIR")
 // ConvertCoverToLcov converts the go coverprofile file coverage.dat.cover to
 // the expectedLcov format and stores it in coverage.dat, where it is picked up by
 // Bazel.
-// The conversion emits line and branch coverage, but not function coverage.
+// The conversion emits line, branch and function coverage.
 func ConvertCoverToLcov() error {
 	inPath := flag.Lookup("test.coverprofile").Value.String()
 	in, err := os.Open(inPath)
@@ -62,18 +68,26 @@ func ConvertCoverToLcov() error {
 var _coverLinePattern = regexp.MustCompile(`^(?P<path>.+):(?P<startLine>\d+)\.(?P<startColumn>\d+),(?P<endLine>\d+)\.(?P<endColumn>\d+) (?P<numStmt>\d+) (?P<count>\d+)$`)
 
 const (
-	_pathIdx      = 1
-	_startLineIdx = 2
-	_endLineIdx   = 4
-	_countIdx     = 7
+	_pathIdx        = 1
+	_startLineIdx   = 2
+	_startColumnIdx = 3
+	_endLineIdx     = 4
+	_endColumnIdx   = 5
+	_countIdx       = 7
 )
 
+// lcovBlock is a block of a go coverprofile with its execution count.
+type lcovBlock struct {
+	startLine, startColumn, endLine, endColumn uint32
+	count                                      uint32
+}
+
 func convertCoverToLcov(coverReader io.Reader, lcovWriter io.Writer) error {
 	cover := bufio.NewScanner(coverReader)
 	lcov := bufio.NewWriter(lcovWriter)
 	defer lcov.Flush()
 	currentPath := ""
-	var lineCounts map[uint32]uint32
+	var blocks []lcovBlock
 	for cover.Scan() {
 		l := cover.Text()
 		m := _coverLinePattern.FindStringSubmatch(l)
@@ -86,45 +100,224 @@ func convertCoverToLcov(coverReader io.Reader, lcovWriter io.Writer) error {
 
 		if m[_pathIdx] != currentPath {
 			if currentPath != "" {
-				if err := emitLcovLines(lcov, currentPath, lineCounts); err != nil {
+				if err := emitLcovFile(lcov, currentPath, blocks); err != nil {
 					return err
 				}
 			}
 			currentPath = m[_pathIdx]
-			lineCounts = make(map[uint32]uint32)
+			blocks = nil
 		}
 
-		startLine, err := strconv.ParseUint(m[_startLineIdx], 10, 32)
-		if err != nil {
+		var values [_countIdx + 1]uint32
+		for _, idx := range []int{_startLineIdx, _startColumnIdx, _endLineIdx, _endColumnIdx, _countIdx} {
+			v, err := strconv.ParseUint(m[idx], 10, 32)
+			if err != nil {
+				return err
+			}
+			values[idx] = uint32(v)
+		}
+		blocks = append(blocks, lcovBlock{
+			startLine:   values[_startLineIdx],
+			startColumn: values[_startColumnIdx],
+			endLine:     values[_endLineIdx],
+			endColumn:   values[_endColumnIdx],
+			count:       values[_countIdx],
+		})
+	}
+	if currentPath != "" {
+		if err := emitLcovFile(lcov, currentPath, blocks); err != nil {
 			return err
 		}
-		endLine, err := strconv.ParseUint(m[_endLineIdx], 10, 32)
+	}
+	return nil
+}
+
+// emitLcovFile emits the lcov records of a single source file. Function
+// records are only emitted if the source file can be found relative to the
+// directory the test was started in, which is the case for the covered
+// sources of a test. Branch records are emitted for every line with more
+// than one block, such as the line of an if statement.
+func emitLcovFile(lcov io.StringWriter, path string, blocks []lcovBlock) error {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].before(blocks[j].startLine, blocks[j].startColumn)
+	})
+	// Merge duplicate blocks, which would otherwise be reported as branches.
+	merged := blocks[:0]
+	for _, b := range blocks {
+		if n := len(merged); n > 0 && merged[n-1].samePosition(b) {
+			if b.count > merged[n-1].count {
+				merged[n-1].count = b.count
+			}
+			continue
+		}
+		merged = append(merged, b)
+	}
+	blocks = merged
+
+	_, err := lcov.WriteString(fmt.Sprintf("SF:%s\n", path))
+	if err != nil {
+		return err
+	}
+	if funcs, ok := findLcovFuncs(path); ok {
+		if err := emitLcovFuncs(lcov, funcs, blocks); err != nil {
+			return err
+		}
+	}
+	if err := emitLcovBranches(lcov, blocks); err != nil {
+		return err
+	}
+	return emitLcovLines(lcov, blocks)
+}
+
+// lcovFunc is a function declaration in a covered source file.
+type lcovFunc struct {
+	name                        string
+	line                        uint32
+	bodyStartLine, bodyStartCol uint32
+	bodyEndLine, bodyEndCol     uint32
+}
+
+// findLcovFuncs parses the source file at path, which is relative to the
+// execution root, and returns its function declarations.
+func findLcovFuncs(path string) ([]lcovFunc, bool) {
+	// The test is started in the runfiles directory of the main repository,
+	// which is next to those of external repositories.
+	srcPath := filepath.Join(chdir.TestExecDir, filepath.FromSlash(path))
+	if rest := strings.TrimPrefix(path, "external/"); rest != path {
+		srcPath = filepath.Join(chdir.TestExecDir, "..", filepath.FromSlash(rest))
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, srcPath, nil, 0)
+	if err != nil {
+		return nil, false
+	}
+	var funcs []lcovFunc
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		name := fd.Name.Name
+		if fd.Recv != nil && len(fd.Recv.List) == 1 {
+			name = recvTypeName(fd.Recv.List[0].Type) + "." + name
+		}
+		pos := fset.Position(fd.Pos())
+		lbrace := fset.Position(fd.Body.Lbrace)
+		rbrace := fset.Position(fd.Body.Rbrace)
+		funcs = append(funcs, lcovFunc{
+			name:          name,
+			line:          uint32(pos.Line),
+			bodyStartLine: uint32(lbrace.Line),
+			bodyStartCol:  uint32(lbrace.Column),
+			bodyEndLine:   uint32(rbrace.Line),
+			bodyEndCol:    uint32(rbrace.Column),
+		})
+	}
+	return funcs, true
+}
+
+// recvTypeName returns the name of the receiver type of a method without
+// pointer and type parameters, which is the first identifier in the type.
+func recvTypeName(expr ast.Expr) string {
+	name := ""
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && name == "" {
+			name = id.Name
+		}
+		return name == ""
+	})
+	return name
+}
+
+func (b lcovBlock) samePosition(o lcovBlock) bool {
+	return b.startLine == o.startLine && b.startColumn == o.startColumn &&
+		b.endLine == o.endLine && b.endColumn == o.endColumn
+}
+
+func (b lcovBlock) before(line, column uint32) bool {
+	return b.startLine < line || b.startLine == line && b.startColumn < column
+}
+
+func emitLcovFuncs(lcov io.StringWriter, funcs []lcovFunc, blocks []lcovBlock) error {
+	// A function has been executed as often as the first block of its body.
+	counts := make([]uint32, len(funcs))
+	for i, fn := range funcs {
+		for _, b := range blocks {
+			if b.before(fn.bodyStartLine, fn.bodyStartCol) {
+				continue
+			}
+			if !b.before(fn.bodyEndLine, fn.bodyEndCol) {
+				break
+			}
+			counts[i] = b.count
+			break
+		}
+	}
+	for _, fn := range funcs {
+		_, err := lcov.WriteString(fmt.Sprintf("FN:%d,%s\n", fn.line, fn.name))
 		if err != nil {
 			return err
 		}
-		count, err := strconv.ParseUint(m[_countIdx], 10, 32)
+	}
+	numCovered := 0
+	for i, fn := range funcs {
+		if counts[i] > 0 {
+			numCovered++
+		}
+		_, err := lcov.WriteString(fmt.Sprintf("FNDA:%d,%s\n", counts[i], fn.name))
 		if err != nil {
 			return err
 		}
-		for line := uint32(startLine); line <= uint32(endLine); line++ {
-			prevCount, ok := lineCounts[line]
-			if !ok || uint32(count) > prevCount {
-				lineCounts[line] = uint32(count)
-			}
+	}
+	_, err := lcov.WriteString(fmt.Sprintf("FNF:%d\nFNH:%d\n", len(funcs), numCovered))
+	return err
+}
+
+func emitLcovBranches(lcov io.StringWriter, blocks []lcovBlock) error {
+	// Every block on a line shared with other blocks is a branch of that
+	// line, for example the condition and the body of an if statement.
+	lineBlocks := make(map[uint32][]lcovBlock)
+	for _, b := range blocks {
+		for line := b.startLine; line <= b.endLine; line++ {
+			lineBlocks[line] = append(lineBlocks[line], b)
 		}
 	}
-	if currentPath != "" {
-		if err := emitLcovLines(lcov, currentPath, lineCounts); err != nil {
-			return err
+	var branchLines []uint32
+	for line, bs := range lineBlocks {
+		if len(bs) > 1 {
+			branchLines = append(branchLines, line)
 		}
 	}
-	return nil
+	if len(branchLines) == 0 {
+		return nil
+	}
+	sort.Slice(branchLines, func(i, j int) bool { return branchLines[i] < branchLines[j] })
+	numBranches, numCovered := 0, 0
+	for _, line := range branchLines {
+		for i, b := range lineBlocks[line] {
+			numBranches++
+			if b.count > 0 {
+				numCovered++
+			}
+			_, err := lcov.WriteString(fmt.Sprintf("BRDA:%d,0,%d,%d\n", line, i, b.count))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err := lcov.WriteString(fmt.Sprintf("BRF:%d\nBRH:%d\n", numBranches, numCovered))
+	return err
 }
 
-func emitLcovLines(lcov io.StringWriter, path string, lineCounts map[uint32]uint32) error {
-	_, err := lcov.WriteString(fmt.Sprintf("SF:%s\n", path))
-	if err != nil {
-		return err
+func emitLcovLines(lcov io.StringWriter, blocks []lcovBlock) error {
+	lineCounts := make(map[uint32]uint32)
+	for _, b := range blocks {
+		for line := b.startLine; line <= b.endLine; line++ {
+			prevCount, ok := lineCounts[line]
+			if !ok || b.count > prevCount {
+				lineCounts[line] = b.count
+			}
+		}
 	}
 
 	// Emit the coverage counters for the individual source lines.
@@ -145,7 +338,7 @@ func emitLcovLines(lcov io.StringWriter, path string, lineCounts map[uint32]uint
 		}
 	}
 	// Emit a summary containing the number of all/covered lines and end the info for the current source file.
-	_, err = lcov.WriteString(fmt.Sprintf("LH:%d\nLF:%d\nend_of_record\n", numCovered, len(sortedLines)))
+	_, err := lcov.WriteString(fmt.Sprintf("LH:%d\nLF:%d\nend_of_record\n", numCovered, len(sortedLines)))
 	if err != nil {
 		return err
 	}
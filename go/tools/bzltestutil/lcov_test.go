@@ -1,11 +1,23 @@
 package bzltestutil
 
 import (
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
 )
 
 func TestConvertCoverToLcov(t *testing.T) {
+	// Source files are looked up relative to the directory the test has been
+	// started in, which is the runfiles directory when run by Bazel.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(dir string) { chdir.TestExecDir = dir }(chdir.TestExecDir)
+	chdir.TestExecDir = wd
+
 	var tests = []struct {
 		name         string
 		goCover      string
@@ -51,6 +63,61 @@ DA:1,2
 LH:1
 LF:1
 end_of_record
+`,
+		},
+		{
+			"branches",
+			`mode: set
+file.go:3.30,4.12 1 1
+file.go:4.12,6.3 1 0
+file.go:4.12,6.3 1 1
+file.go:7.2,7.14 1 1
+`,
+			`SF:file.go
+BRDA:4,0,0,1
+BRDA:4,0,1,1
+BRF:2
+BRH:2
+DA:3,1
+DA:4,1
+DA:5,1
+DA:6,1
+DA:7,1
+LH:5
+LF:5
+end_of_record
+`,
+		},
+		{
+			"functions",
+			`mode: count
+testdata/lcov_funcs.go:5.45,6.14 1 2
+testdata/lcov_funcs.go:6.14,8.3 1 0
+testdata/lcov_funcs.go:9.2,9.23 1 2
+testdata/lcov_funcs.go:12.20,14.2 1 0
+`,
+			`SF:testdata/lcov_funcs.go
+FN:5,greeter.Hello
+FN:12,Bye
+FNDA:2,greeter.Hello
+FNDA:0,Bye
+FNF:2
+FNH:1
+BRDA:6,0,0,2
+BRDA:6,0,1,0
+BRF:2
+BRH:1
+DA:5,2
+DA:6,2
+DA:7,0
+DA:8,0
+DA:9,2
+DA:12,0
+DA:13,0
+DA:14,0
+LH:3
+LF:8
+end_of_record
 `,
 		},
 	}
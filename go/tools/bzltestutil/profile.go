@@ -0,0 +1,82 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// profileFlags maps the profiles that can be requested with GO_TEST_PROFILES
+// to the testing flag that enables them and the file they are written to.
+var profileFlags = map[string][2]string{
+	"cpu":   {"test.cpuprofile", "cpu.pprof"},
+	"mem":   {"test.memprofile", "mem.pprof"},
+	"block": {"test.blockprofile", "block.pprof"},
+	"mutex": {"test.mutexprofile", "mutex.pprof"},
+	"trace": {"test.trace", "trace.out"},
+}
+
+// RegisterProfiles sets the testing flags that write the profiles listed in
+// GO_TEST_PROFILES, a comma-separated list of cpu, mem, block, mutex and
+// trace, to TEST_UNDECLARED_OUTPUTS_DIR. The test binary is copied next to
+// them so that `go tool pprof` can be run on the extracted outputs.zip.
+// Profiles set on the command line take precedence.
+func RegisterProfiles() {
+	profiles := os.Getenv("GO_TEST_PROFILES")
+	if profiles == "" || RetryAttempt() > 0 {
+		return
+	}
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		log.Printf("Not collecting profiles: TEST_UNDECLARED_OUTPUTS_DIR is not set")
+		return
+	}
+	for _, profile := range strings.Split(profiles, ",") {
+		profileFlag, ok := profileFlags[strings.TrimSpace(profile)]
+		if !ok {
+			log.Fatalf("invalid profile in GO_TEST_PROFILES: %q", profile)
+		}
+		flag.Lookup(profileFlag[0]).Value.Set(filepath.Join(outDir, profileFlag[1]))
+	}
+	if err := copyTestBinary(outDir); err != nil {
+		log.Printf("Failed to copy the test binary to TEST_UNDECLARED_OUTPUTS_DIR: %v", err)
+	}
+}
+
+func copyTestBinary(outDir string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(exePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filepath.Join(outDir, filepath.Base(exePath)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
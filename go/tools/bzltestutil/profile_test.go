@@ -0,0 +1,54 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisterProfiles(t *testing.T) {
+	outDir := t.TempDir()
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+	t.Setenv("GO_TEST_PROFILES", "mem, trace")
+	t.Setenv("GO_TEST_RETRY_ATTEMPT", "")
+
+	memProfile := flag.Lookup("test.memprofile").Value
+	trace := flag.Lookup("test.trace").Value
+	cpuProfile := flag.Lookup("test.cpuprofile").Value
+	defer memProfile.Set(memProfile.String())
+	defer trace.Set(trace.String())
+
+	RegisterProfiles()
+
+	if got, want := memProfile.String(), filepath.Join(outDir, "mem.pprof"); got != want {
+		t.Errorf("test.memprofile = %q, want %q", got, want)
+	}
+	if got, want := trace.String(), filepath.Join(outDir, "trace.out"); got != want {
+		t.Errorf("test.trace = %q, want %q", got, want)
+	}
+	if got := cpuProfile.String(); got != "" {
+		t.Errorf("test.cpuprofile = %q, want it unset", got)
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, filepath.Base(exePath))); err != nil {
+		t.Errorf("test binary was not copied: %v", err)
+	}
+}
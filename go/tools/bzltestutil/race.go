@@ -0,0 +1,159 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// raceReportDir is the directory in TEST_UNDECLARED_OUTPUTS_DIR to which the
+// reports of the race detector are written, one file per report.
+const raceReportDir = "races"
+
+var (
+	// raceSeparator starts and ends a report of the race detector.
+	raceSeparator = []byte("==================")
+	raceWarning   = []byte("WARNING: DATA RACE")
+	// raceDetected is the error of a test during which the race detector
+	// reported a race.
+	raceDetected = []byte("race detected during execution of test")
+)
+
+// handleRaceLine holds back the lines of race reports, which the race
+// detector writes to stderr while the test that caused the race runs
+// concurrently with others. It returns whether the line was held back.
+func (c *Converter) handleRaceLine(line, trim []byte) bool {
+	if c.raceReport == nil {
+		if !bytes.Equal(trim, raceSeparator) {
+			return false
+		}
+		c.raceReport = append([]byte{}, line...)
+		return true
+	}
+	if !c.inRaceReport {
+		if !bytes.Equal(trim, raceWarning) {
+			// Only the separator looked like the start of a race report.
+			c.output.write(c.raceReport)
+			c.raceReport = nil
+			return c.handleRaceLine(line, trim)
+		}
+		c.inRaceReport = true
+	}
+	c.raceReport = append(c.raceReport, line...)
+	if bytes.Equal(trim, raceSeparator) {
+		c.pendingRaces = append(c.pendingRaces, c.raceReport...)
+		c.raceReport = nil
+		c.inRaceReport = false
+	}
+	return true
+}
+
+// flushRaces writes the race reports held back so far as output of the
+// current test. Once the test binary exits, incomplete reports are written
+// as well.
+func (c *Converter) flushRaces(exited bool) {
+	if exited && c.raceReport != nil {
+		c.pendingRaces = append(c.pendingRaces, c.raceReport...)
+		c.raceReport = nil
+		c.inRaceReport = false
+	}
+	if len(c.pendingRaces) > 0 {
+		c.output.write(c.pendingRaces)
+		c.pendingRaces = nil
+	}
+}
+
+// raceReports returns the race reports in the output of a test.
+func raceReports(output string) []string {
+	var reports []string
+	var report strings.Builder
+	inReport := false
+	lines := strings.SplitAfter(output, "\n")
+	for i, line := range lines {
+		trim := strings.TrimRight(line, "\r\n")
+		if !inReport {
+			if trim == string(raceSeparator) && i+1 < len(lines) && strings.TrimRight(lines[i+1], "\r\n") == string(raceWarning) {
+				inReport = true
+				report.WriteString(line)
+			}
+			continue
+		}
+		report.WriteString(line)
+		if trim == string(raceSeparator) {
+			reports = append(reports, report.String())
+			report.Reset()
+			inReport = false
+		}
+	}
+	if inReport {
+		reports = append(reports, report.String())
+	}
+	return reports
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// saveRaceReports writes the race reports of all attempts to raceReportDir,
+// each to a file named after the test it was detected in. Reports that
+// weren't attributed to a test are named after the package.
+func saveRaceReports(attempts []*testAttempt) error {
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		return nil
+	}
+	n := 0
+	save := func(name, output string) error {
+		for _, report := range raceReports(output) {
+			if n == 0 {
+				if err := os.MkdirAll(filepath.Join(outDir, raceReportDir), 0777); err != nil {
+					return err
+				}
+			}
+			n++
+			file := fmt.Sprintf("%s_%d.txt", unsafeFileChars.ReplaceAllString(name, "_"), n)
+			if err := ioutil.WriteFile(filepath.Join(outDir, raceReportDir, file), []byte(report), 0666); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, attempt := range attempts {
+		r, err := parseReport(attempt.events())
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(r.testcases))
+		for name := range r.testcases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := save(name, r.testcases[name].output.String()); err != nil {
+				return err
+			}
+		}
+		if err := save("package", r.output.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const raceReport = `==================
+WARNING: DATA RACE
+Write at 0x00c000014108 by goroutine 8:
+  example.com/race.TestRace.func1()
+      race_test.go:10 +0x44
+
+Previous read at 0x00c000014108 by goroutine 7:
+  example.com/race.TestRace()
+      race_test.go:12 +0x9c
+==================
+`
+
+// raceOutput is the output of a test binary in which TestRace races while
+// TestOther runs in parallel.
+const raceOutput = `=== RUN   TestRace
+=== PAUSE TestRace
+=== RUN   TestOther
+=== PAUSE TestOther
+=== CONT  TestRace
+=== CONT  TestOther
+` + raceReport + `==================
+not a race report
+--- PASS: TestOther (0.00s)
+--- FAIL: TestRace (0.00s)
+    testing.go:1465: race detected during execution of test
+FAIL
+`
+
+// convert returns the test2json events of the given test binary output.
+func convert(t *testing.T, output string) *eventLog {
+	t.Helper()
+	events := &eventLog{}
+	c := NewConverter(events, "example.com/race", 0)
+	io.WriteString(c, output)
+	c.Close()
+	return events
+}
+
+func TestConverterRace(t *testing.T) {
+	events := convert(t, raceOutput)
+	report, err := parseReport(events.section(0, events.offset()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := raceReports(report.testcases["TestRace"].output.String()); len(got) != 1 || got[0] != raceReport {
+		t.Errorf("got race reports of TestRace %q, want %q", got, raceReport)
+	}
+	if got := report.testcases["TestOther"].output.String(); strings.Contains(got, "DATA RACE") {
+		t.Errorf("race report attributed to TestOther:\n%s", got)
+	}
+	if got := report.testcases["TestOther"].output.String(); !strings.Contains(got, "==================\nnot a race report\n") {
+		t.Errorf("output of TestOther is missing lines that aren't a race report:\n%s", got)
+	}
+
+	xml, err := report.xml("example.com/race", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<testsuite errors="1" failures="0" skipped="0" tests="2"`,
+		`<error message="Race detected" type="race">`,
+	} {
+		if !strings.Contains(string(xml), want) {
+			t.Errorf("xml does not contain %q:\n%s", want, xml)
+		}
+	}
+}
+
+func TestConverterIncompleteRace(t *testing.T) {
+	// The race is reported after the test binary was killed.
+	events := convert(t, "=== RUN   TestRace\n==================\nWARNING: DATA RACE\nWrite at 0x00c000014108 by goroutine 8:\n")
+	report, err := parseReport(events.section(0, events.offset()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.testcases["TestRace"].output.String(); !strings.Contains(got, "WARNING: DATA RACE\nWrite at") {
+		t.Errorf("incomplete race report is missing from the output:\n%s", got)
+	}
+}
+
+func TestSaveRaceReports(t *testing.T) {
+	outDir := t.TempDir()
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+	events := convert(t, raceOutput)
+	attempt := &testAttempt{log: events, end: events.offset()}
+	if err := saveRaceReports([]*testAttempt{attempt}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(outDir, raceReportDir, "TestRace_1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != raceReport {
+		t.Errorf("got race report %q, want %q", got, raceReport)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"encoding/xml"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
+)
+
+// Initialized by linker from the shard_strategy and shard_timings attributes
+// of go_test. shardTimings is the runfiles path of the timings file relative
+// to the runfiles directory of the main repository.
+var (
+	shardStrategy string
+	shardTimings  string
+)
+
+// ShardNames returns the set of names that belong to the current shard if the
+// test is sharded, and nil otherwise. The names of all tests, benchmarks,
+// fuzz targets and examples of the test are distributed together according
+// to the shard strategy:
+//
+//   - "index" (default): the i-th name goes to shard i modulo the number of
+//     shards.
+//   - "hash": the name goes to the shard given by its hash, so that adding
+//     or removing a test does not move other tests between shards.
+//   - "duration": the names are distributed by their duration in the timings
+//     file, longest first, to the shard with the lowest total duration.
+func ShardNames(names []string) map[string]bool {
+	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
+	if err != nil || totalShards <= 1 {
+		return nil
+	}
+	file, err := os.Create(os.Getenv("TEST_SHARD_STATUS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to touch TEST_SHARD_STATUS_FILE: %v", err)
+	}
+	_ = file.Close()
+	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
+	if err != nil || shardIndex < 0 {
+		return nil
+	}
+
+	var shards []int
+	switch shardStrategy {
+	case "hash":
+		shards = shardByHash(names, totalShards)
+	case "duration":
+		var timings map[string]float64
+		if shardTimings != "" {
+			timings, err = readShardTimings(filepath.Join(chdir.TestExecDir, filepath.FromSlash(shardTimings)))
+			if err != nil {
+				// Every shard fails the same way, so tests are still run exactly once.
+				log.Printf("Failed to read shard timings, assuming equal durations: %v", err)
+			}
+		}
+		shards = shardByDuration(names, totalShards, timings)
+	default:
+		shards = shardByIndex(names, totalShards)
+	}
+	inShard := make(map[string]bool)
+	for i, name := range names {
+		if shards[i] == shardIndex {
+			inShard[name] = true
+		}
+	}
+	return inShard
+}
+
+func shardByIndex(names []string, totalShards int) []int {
+	shards := make([]int, len(names))
+	for i := range names {
+		shards[i] = i % totalShards
+	}
+	return shards
+}
+
+func shardByHash(names []string, totalShards int) []int {
+	shards := make([]int, len(names))
+	for i, name := range names {
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		shards[i] = int(h.Sum32() % uint32(totalShards))
+	}
+	return shards
+}
+
+// shardByDuration assigns the names with the longest durations first, each to
+// the shard with the lowest total duration so far. Names without a known
+// duration are assumed to take the average time of those with one.
+func shardByDuration(names []string, totalShards int, timings map[string]float64) []int {
+	var known, total float64
+	for _, name := range names {
+		if d, ok := timings[name]; ok {
+			known++
+			total += d
+		}
+	}
+	defaultDuration := 1.0
+	if known > 0 {
+		defaultDuration = total / known
+	}
+	durations := make([]float64, len(names))
+	order := make([]int, len(names))
+	for i, name := range names {
+		d, ok := timings[name]
+		if !ok {
+			d = defaultDuration
+		}
+		durations[i] = d
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		di, dj := durations[order[i]], durations[order[j]]
+		if di != dj {
+			return di > dj
+		}
+		return names[order[i]] < names[order[j]]
+	})
+
+	shards := make([]int, len(names))
+	loads := make([]float64, totalShards)
+	for _, i := range order {
+		shard := 0
+		for s := range loads {
+			if loads[s] < loads[shard] {
+				shard = s
+			}
+		}
+		shards[i] = shard
+		loads[shard] += durations[i]
+	}
+	return shards
+}
+
+// readShardTimings reads the durations of top-level tests from the test.xml
+// of a previous run. The file may contain the concatenated test.xml files of
+// all shards.
+func readShardTimings(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	timings := make(map[string]float64)
+	dec := xml.NewDecoder(f)
+	for {
+		var suites xmlTestSuites
+		if err := dec.Decode(&suites); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, suite := range suites.Suites {
+			for _, tc := range suite.TestCases {
+				if strings.Contains(tc.Name, "/") {
+					// Subtests are included in the duration of their parent.
+					continue
+				}
+				d, err := strconv.ParseFloat(tc.Time, 64)
+				if err != nil {
+					continue
+				}
+				if d > timings[tc.Name] {
+					timings[tc.Name] = d
+				}
+			}
+		}
+	}
+	return timings, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShardByIndex(t *testing.T) {
+	got := shardByIndex([]string{"TestA", "TestB", "TestC", "ExampleD"}, 3)
+	if expected := []int{0, 1, 2, 0}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestShardByHashIsStable(t *testing.T) {
+	names := []string{"TestA", "TestB", "TestC", "TestD", "TestE"}
+	before := shardByHash(names, 4)
+	after := shardByHash(append([]string{"TestNew"}, names...), 4)
+	if !reflect.DeepEqual(before, after[1:]) {
+		t.Errorf("adding a test moved other tests: got %v, expected %v", after[1:], before)
+	}
+}
+
+func TestShardByDuration(t *testing.T) {
+	names := []string{"TestFast1", "TestSlow", "TestFast2", "TestMedium", "TestUnknown"}
+	timings := map[string]float64{
+		"TestFast1":  1,
+		"TestFast2":  1,
+		"TestMedium": 3,
+		"TestSlow":   10,
+	}
+	got := shardByDuration(names, 2, timings)
+	// TestUnknown is assumed to take 3.75s, the average of the known tests.
+	if expected := []int{1, 0, 1, 1, 1}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestReadShardTimings(t *testing.T) {
+	// Concatenated test.xml files of two shards.
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="2" time="2.5" name="pkg/test">
+		<testcase classname="test" name="TestA" time="2.5"></testcase>
+		<testcase classname="test" name="TestA/sub" time="2.0"></testcase>
+	</testsuite>
+</testsuites>
+<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="1" time="0.5" name="pkg/test">
+		<testcase classname="test" name="TestB" time="0.5"></testcase>
+	</testsuite>
+</testsuites>
+`
+	path := filepath.Join(t.TempDir(), "timings.xml")
+	if err := os.WriteFile(path, []byte(xml), 0666); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readShardTimings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]float64{"TestA": 2.5, "TestB": 0.5}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
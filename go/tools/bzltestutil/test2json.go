@@ -67,6 +67,12 @@ type Converter struct {
 	input      lineBuffer // input buffer
 	output     lineBuffer // output buffer
 	needMarker bool       // require ^V marker to introduce test framing line
+
+	// Added for rules_go: race reports are attributed to the test that fails
+	// because of them, see race.go.
+	raceReport   []byte // race report being read
+	inRaceReport bool   // whether raceReport is known to be a race report
+	pendingRaces []byte // race reports not yet attributed to a test
 }
 
 // inBuffer and outBuffer are the input and output buffer sizes.
@@ -212,6 +218,11 @@ func (c *Converter) handleInputLine(line []byte) {
 		}
 	}
 
+	// Added for rules_go.
+	if c.handleRaceLine(line, trim) {
+		return
+	}
+
 	// === CONT followed by an empty test name can lose its trailing spaces.
 	if bytes.Equal(trim, emptyName) {
 		line = emptyNameLine
@@ -223,6 +234,7 @@ func (c *Converter) handleInputLine(line []byte) {
 		c.flushReport(0)
 		c.testName = ""
 		c.needMarker = sawMarker
+		c.flushRaces(false) // Added for rules_go.
 		c.output.write(line)
 		if bytes.Equal(trim, bigPass) {
 			c.result = "pass"
@@ -282,6 +294,10 @@ func (c *Converter) handleInputLine(line []byte) {
 		if indent > 0 && indent <= len(c.report) {
 			c.testName = c.report[indent-1].Test
 		}
+		// Added for rules_go.
+		if bytes.HasSuffix(trim, raceDetected) {
+			c.flushRaces(false)
+		}
 		c.output.write(origLine)
 		return
 	}
@@ -367,6 +383,7 @@ func (c *Converter) flushReport(depth int) {
 // and then emits the final overall package-level pass/fail event.
 func (c *Converter) Close() error {
 	c.input.flush()
+	c.flushRaces(true) // Added for rules_go.
 	c.output.flush()
 	if c.result != "" {
 		e := &event{Action: c.result}
@@ -0,0 +1,200 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// perTestCoverageFile is the name of the file in TEST_UNDECLARED_OUTPUTS_DIR
+// to which the lines covered by each test are written.
+const perTestCoverageFile = "go_test_coverage.jsonl"
+
+// testCoverage is a line of the per-test coverage file. Files maps the
+// covered source files to the covered lines in ascending order. Overlapped is
+// set if other tests ran at the same time, since their lines are included.
+type testCoverage struct {
+	Test       string
+	Files      map[string][]uint32
+	Overlapped bool `json:",omitempty"`
+}
+
+// AttributeCoverage wraps each test so that the coverage counters are
+// snapshotted before and compared after it runs, if GO_TEST_COVERAGE_PER_TEST
+// is set in the test environment. The lines covered by each test are appended
+// to a file in TEST_UNDECLARED_OUTPUTS_DIR, one JSON object per line. The
+// counters are reset while tests run so that lines already covered by earlier
+// tests are seen again, and restored once no test is running, so the coverage
+// report of the whole test binary is not affected.
+//
+// Tests that run at the same time as others, like those that call t.Parallel,
+// are marked as overlapped: their lines include the ones covered by the other
+// tests in the meantime, and may miss the ones these tests covered before.
+func AttributeCoverage(tests []testing.InternalTest, mode string, counters map[string][]uint32, blocks map[string][]testing.CoverBlock) []testing.InternalTest {
+	if os.Getenv("GO_TEST_COVERAGE_PER_TEST") == "" || len(counters) == 0 {
+		return tests
+	}
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		log.Printf("Not collecting per-test coverage: TEST_UNDECLARED_OUTPUTS_DIR is not set")
+		return tests
+	}
+	a := &coverageAttribution{
+		mode:     mode,
+		counters: counters,
+		blocks:   blocks,
+		outPath:  filepath.Join(outDir, perTestCoverageFile),
+		running:  map[*testRun]bool{},
+	}
+	wrapped := make([]testing.InternalTest, 0, len(tests))
+	for _, test := range tests {
+		name, f := test.Name, test.F
+		wrapped = append(wrapped, testing.InternalTest{
+			Name: name,
+			F: func(t *testing.T) {
+				run := a.start()
+				// Deferred so that tests that fail with t.Fatal are covered too.
+				defer a.collect(name, run)
+				f(t)
+			},
+		})
+	}
+	return wrapped
+}
+
+type coverageAttribution struct {
+	mode     string
+	counters map[string][]uint32
+	blocks   map[string][]testing.CoverBlock
+	outPath  string
+
+	mu sync.Mutex
+	// saved holds the counter values from before the running tests started,
+	// which are merged back into the counters once none is running.
+	saved map[string][]uint32
+	// running holds the tests that have started and not finished, including
+	// those paused by t.Parallel.
+	running map[*testRun]bool
+}
+
+// testRun holds the state of a running test.
+type testRun struct {
+	// start holds the counter values when the test started.
+	start map[string][]uint32
+	// overlapped is set if other tests were running at the same time.
+	overlapped bool
+}
+
+// start records the counters for a test that starts. If no other test is
+// running, the counters are saved and set to zero first.
+func (a *coverageAttribution) start() *testRun {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.running) == 0 {
+		a.saved = make(map[string][]uint32, len(a.counters))
+		for file, counts := range a.counters {
+			s := make([]uint32, len(counts))
+			for i := range counts {
+				s[i] = atomic.SwapUint32(&counts[i], 0)
+			}
+			a.saved[file] = s
+		}
+	}
+	run := &testRun{start: make(map[string][]uint32, len(a.counters))}
+	for file, counts := range a.counters {
+		s := make([]uint32, len(counts))
+		for i := range counts {
+			s[i] = atomic.LoadUint32(&counts[i])
+		}
+		run.start[file] = s
+	}
+	for other := range a.running {
+		other.overlapped = true
+		run.overlapped = true
+	}
+	a.running[run] = true
+	return run
+}
+
+// collect records the lines covered since the given test started. Once no
+// test is running, the saved counter values are merged back into the
+// counters.
+func (a *coverageAttribution) collect(test string, run *testRun) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.running, run)
+	files := make(map[string][]uint32)
+	for file, counts := range a.counters {
+		lines := make(map[uint32]bool)
+		for i := range counts {
+			if atomic.LoadUint32(&counts[i]) > run.start[file][i] {
+				b := a.blocks[file][i]
+				for line := b.Line0; line <= b.Line1; line++ {
+					lines[line] = true
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		sortedLines := make([]uint32, 0, len(lines))
+		for line := range lines {
+			sortedLines = append(sortedLines, line)
+		}
+		sort.Slice(sortedLines, func(i, j int) bool { return sortedLines[i] < sortedLines[j] })
+		files[file] = sortedLines
+	}
+	if len(a.running) == 0 {
+		a.restore()
+	}
+
+	data, err := json.Marshal(testCoverage{Test: test, Files: files, Overlapped: run.overlapped})
+	if err != nil {
+		log.Printf("Failed to collect coverage of %s: %s", test, err)
+		return
+	}
+	out, err := os.OpenFile(a.outPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Printf("Failed to collect coverage of %s: %s", test, err)
+		return
+	}
+	defer out.Close()
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to collect coverage of %s: %s", test, err)
+	}
+}
+
+// restore merges the saved counter values back into the counters.
+func (a *coverageAttribution) restore() {
+	for file, counts := range a.counters {
+		for i := range counts {
+			if s := a.saved[file][i]; s > 0 {
+				if a.mode == "set" {
+					atomic.StoreUint32(&counts[i], 1)
+				} else {
+					atomic.AddUint32(&counts[i], s)
+				}
+			}
+		}
+	}
+	a.saved = nil
+}
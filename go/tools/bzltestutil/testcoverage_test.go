@@ -0,0 +1,121 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttributeCoverage(t *testing.T) {
+	outDir := t.TempDir()
+	t.Setenv("GO_TEST_COVERAGE_PER_TEST", "1")
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+
+	counters := map[string][]uint32{"src/lib.go": {1, 0, 0}}
+	blocks := map[string][]testing.CoverBlock{"src/lib.go": {
+		{Line0: 3, Line1: 4},
+		{Line0: 4, Line1: 6},
+		{Line0: 7, Line1: 7},
+	}}
+	tests := AttributeCoverage([]testing.InternalTest{
+		{Name: "TestA", F: func(*testing.T) { counters["src/lib.go"][1]++ }},
+		{Name: "TestB", F: func(*testing.T) {}},
+		{Name: "TestC", F: func(*testing.T) { counters["src/lib.go"][2]++ }},
+	}, "count", counters, blocks)
+	for _, test := range tests {
+		test.F(t)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, perTestCoverageFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Test":"TestA","Files":{"src/lib.go":[4,5,6]}}
+{"Test":"TestB","Files":{}}
+{"Test":"TestC","Files":{"src/lib.go":[7]}}
+`
+	if got := string(data); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+	// The counters of the whole test binary are unaffected.
+	if expected := []uint32{1, 1, 1}; !reflect.DeepEqual(counters["src/lib.go"], expected) {
+		t.Errorf("got counters %v, expected %v", counters["src/lib.go"], expected)
+	}
+}
+
+func TestAttributeCoverageOverlapping(t *testing.T) {
+	outDir := t.TempDir()
+	t.Setenv("GO_TEST_COVERAGE_PER_TEST", "1")
+	t.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+
+	counters := map[string][]uint32{"src/lib.go": {1, 0, 0, 0}}
+	blocks := map[string][]testing.CoverBlock{"src/lib.go": {
+		{Line0: 1, Line1: 1},
+		{Line0: 2, Line1: 2},
+		{Line0: 3, Line1: 3},
+		{Line0: 4, Line1: 4},
+	}}
+	// TestA starts, then TestB runs while TestA is paused, like parallel
+	// tests do.
+	paused, resume := make(chan struct{}), make(chan struct{})
+	tests := AttributeCoverage([]testing.InternalTest{
+		{Name: "TestA", F: func(*testing.T) {
+			counters["src/lib.go"][1]++
+			close(paused)
+			<-resume
+			counters["src/lib.go"][3]++
+		}},
+		{Name: "TestB", F: func(*testing.T) { counters["src/lib.go"][2]++ }},
+		{Name: "TestC", F: func(*testing.T) { counters["src/lib.go"][0]++ }},
+	}, "count", counters, blocks)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tests[0].F(t)
+	}()
+	<-paused
+	tests[1].F(t)
+	close(resume)
+	<-done
+	tests[2].F(t)
+
+	data, err := os.ReadFile(filepath.Join(outDir, perTestCoverageFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Test":"TestB","Files":{"src/lib.go":[3]},"Overlapped":true}
+{"Test":"TestA","Files":{"src/lib.go":[2,3,4]},"Overlapped":true}
+{"Test":"TestC","Files":{"src/lib.go":[1]}}
+`
+	if got := string(data); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+	if expected := []uint32{2, 1, 1, 1}; !reflect.DeepEqual(counters["src/lib.go"], expected) {
+		t.Errorf("got counters %v, expected %v", counters["src/lib.go"], expected)
+	}
+}
+
+func TestAttributeCoverageDisabled(t *testing.T) {
+	t.Setenv("GO_TEST_COVERAGE_PER_TEST", "")
+	tests := []testing.InternalTest{{Name: "TestA", F: func(*testing.T) {}}}
+	counters := map[string][]uint32{"src/lib.go": {0}}
+	blocks := map[string][]testing.CoverBlock{"src/lib.go": {{Line0: 1, Line1: 1}}}
+	if got := AttributeCoverage(tests, "set", counters, blocks); &got[0] != &tests[0] {
+		t.Error("tests have been wrapped although GO_TEST_COVERAGE_PER_TEST is not set")
+	}
+}
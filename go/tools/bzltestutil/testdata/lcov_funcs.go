@@ -0,0 +1,14 @@
+package lib
+
+type greeter struct{}
+
+func (*greeter) Hello(informal bool) string {
+	if informal {
+		return "hey"
+	}
+	return "good morning"
+}
+
+func Bye() string {
+	return "bye"
+}
@@ -15,9 +15,14 @@
 package bzltestutil
 
 import (
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func RegisterTimeoutHandler() {
@@ -40,3 +45,75 @@ func RegisterTimeoutHandler() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM)
 }
+
+// goroutineDumpFile is the file in TEST_UNDECLARED_OUTPUTS_DIR that the
+// goroutine dump of a test binary that timed out is saved to.
+const goroutineDumpFile = "goroutines.txt"
+
+// timeoutGrace is how long the wrapper waits after Bazel's SIGTERM, or after
+// TEST_TIMEOUT expired if Bazel sent none, for the test binary to exit by
+// itself once -test.timeout, which is set to TEST_TIMEOUT too, expires. The
+// binary starts after Bazel's timer does, and retries start much later.
+const timeoutGrace = 5 * time.Second
+
+// timeoutDeadline returns when Bazel stops a test started at start, or the
+// zero time if TEST_TIMEOUT is not set.
+func timeoutDeadline(start time.Time) time.Time {
+	seconds, err := strconv.Atoi(os.Getenv("TEST_TIMEOUT"))
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	return start.Add(time.Duration(seconds) * time.Second)
+}
+
+// quitOnTimeout sends SIGQUIT to the test process p if it's still running
+// timeoutGrace after sigterm receives a signal or after the deadline. This
+// makes the Go runtime dump the stacks of all goroutines and exit, as a last
+// resort if -test.timeout did not stop the test. Once done is closed, the
+// returned channel reports whether SIGQUIT was sent.
+func quitOnTimeout(p *os.Process, sigterm <-chan os.Signal, deadline time.Time, done <-chan struct{}) <-chan bool {
+	var timer <-chan time.Time
+	if !deadline.IsZero() {
+		timer = time.After(time.Until(deadline))
+	}
+	quit := make(chan bool, 1)
+	go func() {
+		select {
+		case <-done:
+			quit <- false
+			return
+		case <-sigterm:
+		case <-timer:
+		}
+		select {
+		case <-done:
+			quit <- false
+			return
+		case <-time.After(timeoutGrace):
+		}
+		// Not supported on Windows, where the test binary times out by itself.
+		quit <- p.Signal(syscall.SIGQUIT) == nil
+	}()
+	return quit
+}
+
+// goroutineDump returns the stacks of the goroutines written to stderr by the
+// Go runtime on SIGQUIT or by the testing package when -test.timeout
+// expires, or "" if there are none.
+func goroutineDump(stderr string) string {
+	for _, header := range []string{"SIGQUIT: quit", "panic: test timed out"} {
+		if i := strings.LastIndex(stderr, header); i >= 0 {
+			return stderr[i:]
+		}
+	}
+	return ""
+}
+
+// saveGoroutineDump writes dump to TEST_UNDECLARED_OUTPUTS_DIR, if set.
+func saveGoroutineDump(dump string) error {
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		return nil
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, goroutineDumpFile), []byte(dump), 0666)
+}
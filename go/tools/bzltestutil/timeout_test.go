@@ -0,0 +1,54 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bzltestutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutDeadline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		timeout string
+		want    time.Duration
+	}{
+		{timeout: "", want: -1},
+		{timeout: "300", want: 300 * time.Second},
+		{timeout: "invalid", want: -1},
+	} {
+		t.Run(tt.timeout, func(t *testing.T) {
+			t.Setenv("TEST_TIMEOUT", tt.timeout)
+			got := timeoutDeadline(start)
+			if tt.want < 0 {
+				if !got.IsZero() {
+					t.Errorf("got deadline %v, want none", got)
+				}
+			} else if got.Sub(start) != tt.want {
+				t.Errorf("got deadline after %v, want %v", got.Sub(start), tt.want)
+			}
+		})
+	}
+}
+
+func TestGoroutineDump(t *testing.T) {
+	stderr := "log from test\nSIGQUIT: quit\nPC=0x0 m=0 sigcode=0\n\ngoroutine 1 [running]:\n"
+	if got, want := goroutineDump(stderr), stderr[len("log from test\n"):]; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := goroutineDump("log from test\n"); got != "" {
+		t.Errorf("got %q, want no dump", got)
+	}
+}
@@ -25,10 +25,13 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/bazelbuild/rules_go/go/tools/bzltestutil/chdir"
 )
@@ -111,11 +114,95 @@ func (m *streamMerger) Wait() {
 	m.wg.Wait()
 }
 
-func Wrap(pkg string) error {
-	var jsonBuffer bytes.Buffer
-	jsonConverter := NewConverter(&jsonBuffer, pkg, Timestamp)
+// testRetries returns how many times the failed tests of the test binary are
+// rerun in a new process, as set by GO_TEST_RETRIES. Retries are disabled when
+// the test runner should stop at the first failure.
+func testRetries() int {
+	retriesEnv, ok := os.LookupEnv("GO_TEST_RETRIES")
+	if !ok || os.Getenv("TESTBRIDGE_TEST_RUNNER_FAIL_FAST") != "" {
+		return 0
+	}
+	retries, err := strconv.Atoi(retriesEnv)
+	if err != nil || retries < 0 {
+		log.Fatalf("invalid value for GO_TEST_RETRIES: %q", retriesEnv)
+	}
+	return retries
+}
+
+// RetryAttempt returns the number of the retry run by the test process, or 0
+// if the process runs all tests for the first time.
+func RetryAttempt() int {
+	attempt, _ := strconv.Atoi(os.Getenv("GO_TEST_RETRY_ATTEMPT"))
+	return attempt
+}
+
+// retryArgs returns the arguments of the test binary that rerun exactly the
+// given top-level tests.
+func retryArgs(args []string, tests []string) []string {
+	quoted := make([]string, 0, len(tests))
+	for _, test := range tests {
+		quoted = append(quoted, regexp.QuoteMeta(test))
+	}
+	retryArgs := append([]string{}, args...)
+	return append(retryArgs, "-test.run=^("+strings.Join(quoted, "|")+")$", "-test.bench=^$")
+}
+
+// isTestFailure reports whether err is the exit status of a test binary whose
+// tests failed.
+func isTestFailure(err error) bool {
+	xerr, ok := err.(*exec.ExitError)
+	return ok && xerr.ExitCode() == 1
+}
+
+// testAttempt is the output of a run of the test binary.
+type testAttempt struct {
+	// The test2json events of the run are between start and end in the log.
+	log        *eventLog
+	start, end int64
+	stderr     bytes.Buffer
+	// timedOut is set if the test binary was stopped by the wrapper or by
+	// -test.timeout.
+	timedOut bool
+	// quit is set if the wrapper sent SIGQUIT to the test binary.
+	quit bool
+}
+
+// events returns a reader of the test2json events of the run.
+func (a *testAttempt) events() io.Reader {
+	return a.log.section(a.start, a.end)
+}
+
+// runTest runs the test binary and appends its test2json events to events.
+// The binary is sent SIGQUIT if it keeps running after the wrapper receives a
+// signal from sigterm or the deadline passes.
+func runTest(pkg string, exePath string, args []string, env []string, events *eventLog, sigterm <-chan os.Signal, deadline time.Time) (*testAttempt, error) {
+	attempt := &testAttempt{log: events, start: events.offset()}
+	jsonConverter := NewConverter(events, pkg, Timestamp)
 	streamMerger := NewStreamMerger(jsonConverter)
 
+	cmd := exec.Command(exePath, args...)
+	cmd.Env = env
+	cmd.Stderr = io.MultiWriter(os.Stderr, streamMerger.ErrW, &attempt.stderr)
+	cmd.Stdout = io.MultiWriter(os.Stdout, streamMerger.OutW)
+	streamMerger.Start()
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		quit := quitOnTimeout(cmd.Process, sigterm, deadline, done)
+		err = cmd.Wait()
+		close(done)
+		attempt.quit = <-quit
+	}
+	streamMerger.ErrW.Close()
+	streamMerger.OutW.Close()
+	streamMerger.Wait()
+	jsonConverter.Close()
+	attempt.end = events.offset()
+	attempt.timedOut = attempt.quit || strings.Contains(attempt.stderr.String(), "panic: test timed out")
+	return attempt, err
+}
+
+func Wrap(pkg string) error {
 	args := os.Args[1:]
 	if shouldAddTestV() {
 		args = append([]string{"-test.v"}, args...)
@@ -127,23 +214,54 @@ func Wrap(pkg string) error {
 
 	// If Bazel sends a SIGTERM because the test timed out, it sends it to all child processes. However,
 	// we want the wrapper to be around to capute and forward the test output when this happens. Thus,
-	// we need to ignore the signal. This wrapper will natually ends after the Go test ends, either by
-	// SIGTERM or the time set by -test.timeout expires. If that doesn't happen, the test and this warpper
-	// will be killed by Bazel after the grace period (15s) expires.
-	signal.Ignore(syscall.SIGTERM)
+	// we need to catch the signal. The Go test normally ends by itself shortly after, when
+	// -test.timeout expires. Otherwise, as when a retry started late, the wrapper sends it SIGQUIT,
+	// which makes it dump its goroutines and exit. The wrapper does the same if TEST_TIMEOUT expires
+	// without SIGTERM. If the test doesn't exit, the test and this warpper will be killed by Bazel
+	// after the grace period (15s) expires.
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM)
+	deadline := timeoutDeadline(time.Now())
+
+	events, err := openEventLog()
+	if err != nil {
+		log.Printf("error while creating %s: %s", eventLogFile, err)
+		events = &eventLog{}
+	}
+	defer events.Close()
+
+	env := append(os.Environ(), "GO_TEST_WRAP=0")
+	attempt, err := runTest(pkg, exePath, args, env, events, sigterm, deadline)
+	attempts := []*testAttempt{attempt}
+	// Only the failed top-level tests are rerun, each retry in a fresh process.
+	retries := testRetries()
+	for i := 1; i <= retries && isTestFailure(err); i++ {
+		report, perr := parseReport(attempt.events())
+		if perr != nil {
+			break
+		}
+		failed := report.failedTests()
+		if len(failed) == 0 {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "Retrying failed tests (attempt %d of %d): %s\n", i, retries, strings.Join(failed, " "))
+		retryEnv := append(env, "GO_TEST_RETRY_ATTEMPT="+strconv.Itoa(i))
+		attempt, err = runTest(pkg, exePath, retryArgs(args, failed), retryEnv, events, sigterm, deadline)
+		attempts = append(attempts, attempt)
+	}
+
+	if attempt.timedOut {
+		if derr := saveGoroutineDump(goroutineDump(attempt.stderr.String())); derr != nil {
+			log.Printf("error while saving goroutine dump: %s", derr)
+		}
+	}
+
+	if rerr := saveRaceReports(attempts); rerr != nil {
+		log.Printf("error while saving race reports: %s", rerr)
+	}
 
-	cmd := exec.Command(exePath, args...)
-	cmd.Env = append(os.Environ(), "GO_TEST_WRAP=0")
-	cmd.Stderr = io.MultiWriter(os.Stderr, streamMerger.ErrW)
-	cmd.Stdout = io.MultiWriter(os.Stdout, streamMerger.OutW)
-	streamMerger.Start()
-	err := cmd.Run()
-	streamMerger.ErrW.Close()
-	streamMerger.OutW.Close()
-	streamMerger.Wait()
-	jsonConverter.Close()
 	if out, ok := os.LookupEnv("XML_OUTPUT_FILE"); ok {
-		werr := writeReport(jsonBuffer, pkg, out)
+		werr := writeReport(attempts, pkg, out)
 		if werr != nil {
 			if err != nil {
 				return fmt.Errorf("error while generating testreport: %s, (error wrapping test execution: %s)", werr, err)
@@ -151,11 +269,37 @@ func Wrap(pkg string) error {
 			return fmt.Errorf("error while generating testreport: %s", werr)
 		}
 	}
+	// The covdata files are complete only after the test process has exited.
+	if cerr := ConvertCovdataToLcov(); cerr != nil {
+		if err != nil {
+			return fmt.Errorf("error while collecting coverage: %s, (error wrapping test execution: %s)", cerr, err)
+		}
+		return fmt.Errorf("error while collecting coverage: %s", cerr)
+	}
 	return err
 }
 
-func writeReport(jsonBuffer bytes.Buffer, pkg string, path string) error {
-	xml, cerr := json2xml(&jsonBuffer, pkg)
+// writeReport writes the test.xml of the given attempts. The results of the
+// tests rerun in an attempt replace those of the earlier attempts.
+func writeReport(attempts []*testAttempt, pkg string, path string) error {
+	var report *testReport
+	var stderr strings.Builder
+	for _, attempt := range attempts {
+		r, err := parseReport(attempt.events())
+		if err != nil {
+			return fmt.Errorf("error converting test output to xml: %s", err)
+		}
+		if attempt.timedOut {
+			r.markTimedOut()
+		}
+		if report == nil {
+			report = r
+		} else {
+			report.addRetry(r)
+		}
+		stderr.Write(attempt.stderr.Bytes())
+	}
+	xml, cerr := report.xml(pkg, stderr.String(), reportProperties())
 	if cerr != nil {
 		return fmt.Errorf("error converting test output to xml: %s", cerr)
 	}
@@ -164,3 +308,18 @@ func writeReport(jsonBuffer bytes.Buffer, pkg string, path string) error {
 	}
 	return nil
 }
+
+// reportProperties returns the properties of the test run reported in the
+// test.xml.
+func reportProperties() []xmlProperty {
+	properties := []xmlProperty{
+		{Name: "GOOS", Value: runtime.GOOS},
+		{Name: "GOARCH", Value: runtime.GOARCH},
+	}
+	for _, key := range []string{"TEST_SHARD_INDEX", "TEST_TOTAL_SHARDS"} {
+		if value, ok := os.LookupEnv(key); ok {
+			properties = append(properties, xmlProperty{Name: key, Value: value})
+		}
+	}
+	return properties
+}
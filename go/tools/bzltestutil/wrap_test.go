@@ -17,6 +17,7 @@ package bzltestutil
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -61,3 +62,11 @@ func TestShouldWrap(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryArgs(t *testing.T) {
+	got := retryArgs([]string{"-test.v"}, []string{"TestA", "Test.B"})
+	want := []string{"-test.v", "-test.run=^(TestA|Test\\.B)$", "-test.bench=^$"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("retryArgs() = %q, want %q", got, want)
+	}
+}
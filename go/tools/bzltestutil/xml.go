@@ -21,6 +21,7 @@ import (
 	"io"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -30,25 +31,37 @@ type xmlTestSuites struct {
 	Suites  []xmlTestSuite `xml:"testsuite"`
 }
 
+// xmlTestSuite is the suite of a package or, nested in it, the suite of the
+// subtests of a test, which is named after the test.
 type xmlTestSuite struct {
-	XMLName   xml.Name      `xml:"testsuite"`
-	TestCases []xmlTestCase `xml:"testcase"`
-	Errors    int           `xml:"errors,attr"`
-	Failures  int           `xml:"failures,attr"`
-	Skipped   int           `xml:"skipped,attr"`
-	Tests     int           `xml:"tests,attr"`
-	Time      string        `xml:"time,attr"`
-	Name      string        `xml:"name,attr"`
+	XMLName    xml.Name       `xml:"testsuite"`
+	Properties *xmlProperties `xml:"properties,omitempty"`
+	TestCases  []xmlTestCase  `xml:"testcase"`
+	Suites     []xmlTestSuite `xml:"testsuite"`
+	SystemOut  string         `xml:"system-out,omitempty"`
+	SystemErr  string         `xml:"system-err,omitempty"`
+	Errors     int            `xml:"errors,attr"`
+	Failures   int            `xml:"failures,attr"`
+	Skipped    int            `xml:"skipped,attr"`
+	Tests      int            `xml:"tests,attr"`
+	Time       string         `xml:"time,attr"`
+	Name       string         `xml:"name,attr"`
+	Timestamp  string         `xml:"timestamp,attr,omitempty"`
 }
 
 type xmlTestCase struct {
-	XMLName   xml.Name    `xml:"testcase"`
-	Classname string      `xml:"classname,attr"`
-	Name      string      `xml:"name,attr"`
-	Time      string      `xml:"time,attr"`
-	Failure   *xmlMessage `xml:"failure,omitempty"`
-	Error     *xmlMessage `xml:"error,omitempty"`
-	Skipped   *xmlMessage `xml:"skipped,omitempty"`
+	XMLName    xml.Name       `xml:"testcase"`
+	Properties *xmlProperties `xml:"properties,omitempty"`
+	Classname  string         `xml:"classname,attr"`
+	Name       string         `xml:"name,attr"`
+	Time       string         `xml:"time,attr"`
+	Failure    *xmlMessage    `xml:"failure,omitempty"`
+	Error      *xmlMessage    `xml:"error,omitempty"`
+	Skipped    *xmlMessage    `xml:"skipped,omitempty"`
+	// FlakyFailures are the failed attempts of a test that passed when
+	// retried, RerunFailures those of a test that failed every attempt.
+	FlakyFailures []xmlMessage `xml:"flakyFailure"`
+	RerunFailures []xmlMessage `xml:"rerunFailure"`
 }
 
 type xmlMessage struct {
@@ -57,6 +70,15 @@ type xmlMessage struct {
 	Contents string `xml:",chardata"`
 }
 
+type xmlProperties struct {
+	Properties []xmlProperty `xml:"property"`
+}
+
+type xmlProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
 // jsonEvent as encoded by the test2json package.
 type jsonEvent struct {
 	Time    *time.Time
@@ -68,25 +90,59 @@ type jsonEvent struct {
 }
 
 type testCase struct {
-	state    string
-	output   strings.Builder
-	duration *float64
+	state     string
+	output    strings.Builder
+	duration  *float64
+	timestamp *time.Time
+	// metrics are the results of a benchmark.
+	metrics []xmlProperty
+	// attempts are the outputs of the earlier failed attempts of a retried
+	// test.
+	attempts []string
+}
+
+// testReport collects the test2json events of a test binary.
+type testReport struct {
+	duration  *float64
+	timestamp *time.Time
+	// output is the output of the test binary outside of tests.
+	output    strings.Builder
+	testcases map[string]*testCase
+}
+
+func (r *testReport) testCaseByName(name string) *testCase {
+	if name == "" {
+		return nil
+	}
+	if _, ok := r.testcases[name]; !ok {
+		r.testcases[name] = &testCase{}
+	}
+	return r.testcases[name]
 }
 
 // json2xml converts test2json's output into an xml output readable by Bazel.
+// Subtests are reported in nested suites named after their parent test. The
+// stderr of the test binary and the given properties are attached to the
+// suite of the package.
 // http://windyroad.com.au/dl/Open%20Source/JUnit.xsd
-func json2xml(r io.Reader, pkgName string) ([]byte, error) {
-	var pkgDuration *float64
-	testcases := make(map[string]*testCase)
-	testCaseByName := func(name string) *testCase {
-		if name == "" {
-			return nil
-		}
-		if _, ok := testcases[name]; !ok {
-			testcases[name] = &testCase{}
-		}
-		return testcases[name]
+func json2xml(r io.Reader, pkgName string, stderr string, properties []xmlProperty) ([]byte, error) {
+	report, err := parseReport(r)
+	if err != nil {
+		return nil, err
 	}
+	return report.xml(pkgName, stderr, properties)
+}
+
+// xml returns the report as an xml output readable by Bazel.
+func (r *testReport) xml(pkgName string, stderr string, properties []xmlProperty) ([]byte, error) {
+	return xml.MarshalIndent(toXML(pkgName, r, stderr, properties), "", "\t")
+}
+
+// parseReport collects the test2json output of a test binary.
+func parseReport(r io.Reader) (*testReport, error) {
+	report := &testReport{testcases: make(map[string]*testCase)}
+	var line strings.Builder
+	var lineTest string
 
 	dec := json.NewDecoder(r)
 	for {
@@ -96,63 +152,226 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 		} else if err != nil {
 			return nil, fmt.Errorf("error decoding test2json output: %s", err)
 		}
+		if report.timestamp == nil {
+			report.timestamp = e.Time
+		}
 		switch s := e.Action; s {
 		case "run":
-			if c := testCaseByName(e.Test); c != nil {
+			if c := report.testCaseByName(e.Test); c != nil {
 				c.state = s
+				c.timestamp = e.Time
 			}
 		case "output":
-			if c := testCaseByName(e.Test); c != nil {
-				c.output.WriteString(e.Output)
+			// Benchmark results are written in parts, so output is collected
+			// in complete lines.
+			if line.Len() == 0 {
+				lineTest = e.Test
+			}
+			line.WriteString(e.Output)
+			if strings.HasSuffix(e.Output, "\n") {
+				report.addOutput(lineTest, line.String())
+				line.Reset()
 			}
 		case "skip":
-			if c := testCaseByName(e.Test); c != nil {
+			if c := report.testCaseByName(e.Test); c != nil {
 				c.output.WriteString(e.Output)
 				c.state = s
 				c.duration = e.Elapsed
 			}
 		case "fail":
-			if c := testCaseByName(e.Test); c != nil {
+			if c := report.testCaseByName(e.Test); c != nil {
 				c.state = s
 				c.duration = e.Elapsed
 			} else {
-				pkgDuration = e.Elapsed
+				report.duration = e.Elapsed
 			}
 		case "pass":
-			if c := testCaseByName(e.Test); c != nil {
+			if c := report.testCaseByName(e.Test); c != nil {
 				c.duration = e.Elapsed
 				c.state = s
 			} else {
-				pkgDuration = e.Elapsed
+				report.duration = e.Elapsed
+			}
+		case "bench":
+			// Benchmarks that log are reported with "--- BENCH:".
+			if c := report.testCaseByName(e.Test); c != nil && c.state != "fail" && c.state != "skip" {
+				c.state = "pass"
+				c.duration = e.Elapsed
 			}
 		}
 	}
 
-	return xml.MarshalIndent(toXML(pkgName, pkgDuration, testcases), "", "\t")
+	if line.Len() > 0 {
+		report.addOutput(lineTest, line.String())
+	}
+	return report, nil
+}
+
+// failedTests returns the names of the top-level tests and examples that
+// failed. Failed benchmarks aren't included.
+func (r *testReport) failedTests() []string {
+	var failed []string
+	for name, c := range r.testcases {
+		if c.state == "fail" && !strings.Contains(name, "/") && !strings.HasPrefix(name, "Benchmark") {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// markTimedOut marks the tests that were still running when the test binary
+// was stopped as timed out.
+func (r *testReport) markTimedOut() {
+	for _, c := range r.testcases {
+		if c.state == "run" {
+			c.state = "timeout"
+		}
+	}
+}
+
+// addRetry merges the report of a retry of some tests into r. The results of
+// the retried tests replace the earlier ones, whose output is kept as a
+// failed attempt if they failed.
+func (r *testReport) addRetry(retry *testReport) {
+	if retry.duration != nil {
+		duration := *retry.duration
+		if r.duration != nil {
+			duration += *r.duration
+		}
+		r.duration = &duration
+	}
+	r.output.WriteString(retry.output.String())
+	for name, c := range retry.testcases {
+		if prev, ok := r.testcases[name]; ok {
+			c.attempts = prev.attempts
+			if prev.state != "pass" && prev.state != "skip" {
+				c.attempts = append(c.attempts, prev.output.String())
+			}
+		}
+		r.testcases[name] = c
+	}
 }
 
-func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase) *xmlTestSuites {
-	cases := make([]string, 0, len(testcases))
-	for k := range testcases {
+// addOutput adds a line of output to the given test. Benchmark output isn't
+// attributed to the benchmark by test2json, so it is recognized by its
+// content instead.
+func (r *testReport) addOutput(test string, line string) {
+	if name := r.parseBenchmarkResult(line); name != "" {
+		test = name
+	} else if trim := strings.TrimSpace(line); strings.HasPrefix(trim, "Benchmark") && !strings.ContainsAny(trim, " \t") {
+		// The name of a benchmark is printed before its first result.
+		test = trim
+	}
+	if c := r.testCaseByName(test); c != nil {
+		c.output.WriteString(line)
+	} else {
+		r.output.WriteString(line)
+	}
+}
+
+// parseBenchmarkResult records the metrics of a benchmark result line such as
+// "BenchmarkFoo-8 \t 100\t 175.6 ns/op\t 3 B/op\t 0 allocs/op" and
+// returns the name of the benchmark, or "" if line isn't a result line.
+func (r *testReport) parseBenchmarkResult(line string) string {
+	fields := strings.Split(strings.TrimSpace(line), "\t")
+	if len(fields) < 3 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return ""
+	}
+	name := strings.TrimSpace(fields[0])
+	iterations := strings.TrimSpace(fields[1])
+	if _, err := strconv.ParseUint(iterations, 10, 64); err != nil {
+		return ""
+	}
+	if _, ok := r.testcases[name]; !ok {
+		// Strip the GOMAXPROCS suffix.
+		if i := strings.LastIndexByte(name, '-'); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+	}
+	c := r.testCaseByName(name)
+	c.metrics = append(c.metrics, xmlProperty{Name: "iterations", Value: iterations})
+	for _, f := range fields[2:] {
+		if parts := strings.Fields(f); len(parts) == 2 {
+			c.metrics = append(c.metrics, xmlProperty{Name: parts[1], Value: parts[0]})
+		}
+	}
+	// Benchmarks only have a pass or fail event if run with -test.v.
+	if c.state == "" || c.state == "run" {
+		c.state = "pass"
+	}
+	return name
+}
+
+func toXML(pkgName string, report *testReport, stderr string, properties []xmlProperty) *xmlTestSuites {
+	cases := make([]string, 0, len(report.testcases))
+	for k := range report.testcases {
 		cases = append(cases, k)
 	}
 	sort.Strings(cases)
-	suite := xmlTestSuite{
-		Name: pkgName,
+
+	// Subtests are nested in the suite of the closest test they are named
+	// after, since subtest names may contain slashes themselves.
+	var topLevel []string
+	subtests := make(map[string][]string)
+	for _, name := range cases {
+		parent := ""
+		for i := strings.LastIndexByte(name, '/'); i > 0; i = strings.LastIndexByte(name[:i], '/') {
+			if _, ok := report.testcases[name[:i]]; ok {
+				parent = name[:i]
+				break
+			}
+		}
+		if parent == "" {
+			topLevel = append(topLevel, name)
+		} else {
+			subtests[parent] = append(subtests[parent], name)
+		}
 	}
-	if pkgDuration != nil {
-		suite.Time = fmt.Sprintf("%.3f", *pkgDuration)
+
+	suite := toXMLSuite(pkgName, path.Base(pkgName), topLevel, subtests, report.testcases)
+	if report.duration != nil {
+		suite.Time = fmt.Sprintf("%.3f", *report.duration)
+	}
+	suite.Timestamp = formatTimestamp(report.timestamp)
+	if len(properties) > 0 {
+		suite.Properties = &xmlProperties{Properties: properties}
+	}
+	suite.SystemOut = report.output.String()
+	suite.SystemErr = stderr
+	return &xmlTestSuites{Suites: []xmlTestSuite{suite}}
+}
+
+func toXMLSuite(name, classname string, cases []string, subtests map[string][]string, testcases map[string]*testCase) xmlTestSuite {
+	suite := xmlTestSuite{
+		Name: name,
 	}
 	for _, name := range cases {
 		c := testcases[name]
 		suite.Tests++
 		newCase := xmlTestCase{
 			Name:      name,
-			Classname: path.Base(pkgName),
+			Classname: classname,
 		}
 		if c.duration != nil {
 			newCase.Time = fmt.Sprintf("%.3f", *c.duration)
 		}
+		if len(c.metrics) > 0 {
+			newCase.Properties = &xmlProperties{Properties: c.metrics}
+		}
+		// A test that passed after failed attempts is flaky.
+		attempts := &newCase.RerunFailures
+		if c.state == "pass" {
+			attempts = &newCase.FlakyFailures
+		}
+		for _, output := range c.attempts {
+			*attempts = append(*attempts, xmlMessage{
+				Message:  "Failed",
+				Contents: output,
+			})
+		}
 		switch c.state {
 		case "skip":
 			suite.Skipped++
@@ -161,6 +380,15 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 				Contents: c.output.String(),
 			}
 		case "fail":
+			if len(raceReports(c.output.String())) > 0 {
+				suite.Errors++
+				newCase.Error = &xmlMessage{
+					Message:  "Race detected",
+					Type:     "race",
+					Contents: c.output.String(),
+				}
+				break
+			}
 			suite.Failures++
 			newCase.Failure = &xmlMessage{
 				Message:  "Failed",
@@ -168,6 +396,12 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 			}
 		case "pass":
 			break
+		case "timeout":
+			suite.Errors++
+			newCase.Error = &xmlMessage{
+				Message:  "Timed out",
+				Contents: c.output.String(),
+			}
 		default:
 			suite.Errors++
 			newCase.Error = &xmlMessage{
@@ -176,6 +410,26 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 			}
 		}
 		suite.TestCases = append(suite.TestCases, newCase)
+
+		if len(subtests[name]) == 0 {
+			continue
+		}
+		// The counts of a suite include those of its nested suites.
+		sub := toXMLSuite(name, classname, subtests[name], subtests, testcases)
+		sub.Time = newCase.Time
+		sub.Timestamp = formatTimestamp(c.timestamp)
+		suite.Tests += sub.Tests
+		suite.Failures += sub.Failures
+		suite.Skipped += sub.Skipped
+		suite.Errors += sub.Errors
+		suite.Suites = append(suite.Suites, sub)
 	}
-	return &xmlTestSuites{Suites: []xmlTestSuite{suite}}
+	return suite
+}
+
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
 }
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -36,7 +37,7 @@ func TestJSON2XML(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			got, err := json2xml(orig, "pkg/testing")
+			got, err := json2xml(orig, "pkg/testing", "", nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -53,3 +54,103 @@ func TestJSON2XML(t *testing.T) {
 		})
 	}
 }
+
+func TestJSON2XMLPropertiesAndStderr(t *testing.T) {
+	in := strings.NewReader(`{"Action":"output","Output":"PASS\n"}
+{"Action":"pass","Elapsed":0.01}
+`)
+	properties := []xmlProperty{{Name: "GOOS", Value: "linux"}, {Name: "TEST_SHARD_INDEX", Value: "1"}}
+	got, err := json2xml(in, "pkg/testing", "log from init\n", properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="0" time="0.010" name="pkg/testing">
+		<properties>
+			<property name="GOOS" value="linux"></property>
+			<property name="TEST_SHARD_INDEX" value="1"></property>
+		</properties>
+		<system-out>PASS&#xA;</system-out>
+		<system-err>log from init&#xA;</system-err>
+	</testsuite>
+</testsuites>`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
+func TestReportRetries(t *testing.T) {
+	first, err := parseReport(strings.NewReader(`{"Action":"run","Test":"TestFlaky"}
+{"Action":"output","Test":"TestFlaky","Output":"--- FAIL: TestFlaky (0.00s)\n"}
+{"Action":"fail","Test":"TestFlaky","Elapsed":0}
+{"Action":"run","Test":"TestBroken"}
+{"Action":"output","Test":"TestBroken","Output":"--- FAIL: TestBroken (0.00s)\n"}
+{"Action":"fail","Test":"TestBroken","Elapsed":0}
+{"Action":"run","Test":"TestPass"}
+{"Action":"pass","Test":"TestPass","Elapsed":0}
+{"Action":"fail","Elapsed":0.01}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first.failedTests(), []string{"TestBroken", "TestFlaky"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failedTests() = %q, want %q", got, want)
+	}
+	retry, err := parseReport(strings.NewReader(`{"Action":"run","Test":"TestFlaky"}
+{"Action":"pass","Test":"TestFlaky","Elapsed":0}
+{"Action":"run","Test":"TestBroken"}
+{"Action":"output","Test":"TestBroken","Output":"--- FAIL: TestBroken (0.00s)\n"}
+{"Action":"fail","Test":"TestBroken","Elapsed":0}
+{"Action":"fail","Elapsed":0.02}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.addRetry(retry)
+	got, err := first.xml("pkg/testing", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<testsuites>
+	<testsuite errors="0" failures="1" skipped="0" tests="3" time="0.030" name="pkg/testing">
+		<testcase classname="testing" name="TestBroken" time="0.000">
+			<failure message="Failed" type="">--- FAIL: TestBroken (0.00s)&#xA;</failure>
+			<rerunFailure message="Failed" type="">--- FAIL: TestBroken (0.00s)&#xA;</rerunFailure>
+		</testcase>
+		<testcase classname="testing" name="TestFlaky" time="0.000">
+			<flakyFailure message="Failed" type="">--- FAIL: TestFlaky (0.00s)&#xA;</flakyFailure>
+		</testcase>
+		<testcase classname="testing" name="TestPass" time="0.000"></testcase>
+	</testsuite>
+</testsuites>`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
+
+func TestReportTimedOut(t *testing.T) {
+	report, err := parseReport(strings.NewReader(`{"Action":"run","Test":"TestPass"}
+{"Action":"pass","Test":"TestPass","Elapsed":0}
+{"Action":"run","Test":"TestHang"}
+{"Action":"output","Test":"TestHang","Output":"=== RUN   TestHang\n"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.markTimedOut()
+	got, err := report.xml("pkg/testing", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<testsuites>
+	<testsuite errors="1" failures="0" skipped="0" tests="2" time="" name="pkg/testing">
+		<testcase classname="testing" name="TestHang" time="">
+			<error message="Timed out" type="">=== RUN   TestHang&#xA;</error>
+		</testcase>
+		<testcase classname="testing" name="TestPass" time="0.000"></testcase>
+	</testsuite>
+</testsuites>`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s\n", got, want)
+	}
+}
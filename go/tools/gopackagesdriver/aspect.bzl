@@ -49,6 +49,29 @@ def file_path(f):
         prefix = "__BAZEL_OUTPUT_BASE__"
     return paths.join(prefix, f.path)
 
+def _module(archive):
+    # The module path can be derived from the import path if packages are laid
+    # out like in Go modules. The driver replaces it with the path in the
+    # closest go.mod file of the repository, if any.
+    label = archive.data.label
+    importpath = archive.data.importpath
+    path = ""
+    if not label.package:
+        path = importpath
+    elif importpath.endswith("/" + label.package):
+        path = importpath[:-len(label.package) - 1]
+
+    if label.workspace_root:
+        dir = paths.join("__BAZEL_OUTPUT_BASE__", label.workspace_root)
+    else:
+        dir = "__BAZEL_WORKSPACE__"
+
+    return struct(
+        Path = path,
+        Main = not label.workspace_root,
+        Dir = dir,
+    )
+
 def _go_archive_to_pkg(archive):
     go_files = [
         file_path(src)
@@ -70,6 +93,7 @@ def _go_archive_to_pkg(archive):
             pkg.data.importpath: str(pkg.data.label)
             for pkg in archive.direct
         },
+        Module = _module(archive),
     )
 
 def make_pkg_json(ctx, name, pkg_info):
@@ -47,13 +47,88 @@ type Bazel struct {
 // Minimal BEP structs to access the build outputs
 type BEPNamedSet struct {
 	NamedSetOfFiles *struct {
-		Files []struct {
-			Name string `json:"name"`
-			URI  string `json:"uri"`
-		} `json:"files"`
+		Files []BEPFile `json:"files"`
 	} `json:"namedSetOfFiles"`
 }
 
+type BEPFile struct {
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+}
+
+type BEPFailureDetail struct {
+	Message string `json:"message"`
+}
+
+// BEPEvent holds the parts of a build event that report failures, besides
+// the build outputs.
+type BEPEvent struct {
+	BEPNamedSet
+	ID struct {
+		TargetCompleted   *BEPLabelID `json:"targetCompleted"`
+		TargetConfigured  *BEPLabelID `json:"targetConfigured"`
+		ConfiguredLabel   *BEPLabelID `json:"configuredLabel"`
+		UnconfiguredLabel *BEPLabelID `json:"unconfiguredLabel"`
+		ActionCompleted   *BEPLabelID `json:"actionCompleted"`
+	} `json:"id"`
+	Progress *struct {
+		Stderr string `json:"stderr"`
+	} `json:"progress"`
+	Aborted *struct {
+		Reason      string `json:"reason"`
+		Description string `json:"description"`
+	} `json:"aborted"`
+	Completed *struct {
+		Success       bool              `json:"success"`
+		FailureDetail *BEPFailureDetail `json:"failureDetail"`
+	} `json:"completed"`
+	Action *struct {
+		Success       bool              `json:"success"`
+		Stderr        *BEPFile          `json:"stderr"`
+		FailureDetail *BEPFailureDetail `json:"failureDetail"`
+	} `json:"action"`
+}
+
+type BEPLabelID struct {
+	Label string `json:"label"`
+}
+
+// label returns the label of the target an event is about, if any.
+func (e *BEPEvent) label() string {
+	for _, id := range []*BEPLabelID{
+		e.ID.TargetCompleted,
+		e.ID.TargetConfigured,
+		e.ID.ConfiguredLabel,
+		e.ID.UnconfiguredLabel,
+		e.ID.ActionCompleted,
+	} {
+		if id != nil {
+			return id.Label
+		}
+	}
+	return ""
+}
+
+// BuildResult holds the outputs of a build and the errors that made some of
+// its targets fail.
+type BuildResult struct {
+	Files []string
+	// Failures holds the messages reported for the targets that failed, by
+	// label.
+	Failures map[string][]string
+	// Errors holds the errors that Bazel printed, such as
+	// "/path/to/BUILD.bazel:3:11: message".
+	Errors []string
+}
+
+func (r *BuildResult) addFailure(label, msg string) {
+	msg = strings.TrimSpace(msg)
+	if label == "" || msg == "" || contains(r.Failures[label], msg) {
+		return
+	}
+	r.Failures[label] = append(r.Failures[label], msg)
+}
+
 func NewBazel(ctx context.Context, bazelBin, workspaceRoot string, buildWorkingDirectory string, bazelCommonFlags []string, bazelStartupFlags []string) (*Bazel, error) {
 	b := &Bazel{
 		bazelBin:              bazelBin,
@@ -102,7 +177,7 @@ func (b *Bazel) run(ctx context.Context, command string, args ...string) (string
 	return string(output), err
 }
 
-func (b *Bazel) Build(ctx context.Context, args ...string) ([]string, error) {
+func (b *Bazel) Build(ctx context.Context, args ...string) (*BuildResult, error) {
 	jsonFile, err := ioutil.TempFile("", "gopackagesdriver_bep_")
 	if err != nil {
 		return nil, fmt.Errorf("unable to create BEP JSON file: %w", err)
@@ -127,26 +202,72 @@ func (b *Bazel) Build(ctx context.Context, args ...string) ([]string, error) {
 		}
 	}
 
-	files := make([]string, 0)
+	result := &BuildResult{
+		Files:    make([]string, 0),
+		Failures: map[string][]string{},
+	}
 	decoder := json.NewDecoder(jsonFile)
 	for decoder.More() {
-		var namedSet BEPNamedSet
-		if err := decoder.Decode(&namedSet); err != nil {
+		var event BEPEvent
+		if err := decoder.Decode(&event); err != nil {
 			return nil, fmt.Errorf("unable to decode %s: %w", jsonFile.Name(), err)
 		}
 
-		if namedSet.NamedSetOfFiles != nil {
-			for _, f := range namedSet.NamedSetOfFiles.Files {
+		if event.NamedSetOfFiles != nil {
+			for _, f := range event.NamedSetOfFiles.Files {
 				fileUrl, err := url.Parse(f.URI)
 				if err != nil {
 					return nil, fmt.Errorf("unable to parse file URI: %w", err)
 				}
-				files = append(files, filepath.FromSlash(fileUrl.Path))
+				result.Files = append(result.Files, filepath.FromSlash(fileUrl.Path))
+			}
+		}
+
+		label := event.label()
+		switch {
+		case event.Progress != nil:
+			for _, line := range strings.Split(event.Progress.Stderr, "\n") {
+				if strings.HasPrefix(line, "ERROR: ") {
+					result.Errors = append(result.Errors, strings.TrimPrefix(line, "ERROR: "))
+				}
+			}
+		case event.Aborted != nil:
+			if reason := event.Aborted.Reason; reason == "ANALYSIS_FAILURE" || reason == "LOADING_FAILURE" {
+				result.addFailure(label, event.Aborted.Description)
+			}
+		case event.Completed != nil:
+			if !event.Completed.Success && event.Completed.FailureDetail != nil {
+				result.addFailure(label, event.Completed.FailureDetail.Message)
+			}
+		case event.Action != nil:
+			if event.Action.Success {
+				break
+			}
+			if event.Action.FailureDetail != nil {
+				result.addFailure(label, event.Action.FailureDetail.Message)
+			}
+			// The output of compilers holds the errors in the sources.
+			if event.Action.Stderr != nil {
+				result.addFailure(label, readFileURI(event.Action.Stderr.URI))
 			}
 		}
 	}
 
-	return files, nil
+	return result, nil
+}
+
+// readFileURI returns the contents of a local file reported in build events,
+// or nothing if it can't be read.
+func readFileURI(uri string) string {
+	fileUrl, err := url.Parse(uri)
+	if err != nil || fileUrl.Scheme != "file" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.FromSlash(fileUrl.Path))
+	if err != nil {
+		return ""
+	}
+	return string(data)
 }
 
 func (b *Bazel) Query(ctx context.Context, args ...string) ([]string, error) {
@@ -154,13 +275,31 @@ func (b *Bazel) Query(ctx context.Context, args ...string) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("bazel query failed: %w", err)
 	}
+	return splitLabels(output), nil
+}
+
+// QueryPartial runs a query with --keep_going, and returns the labels found
+// even if parts of the query failed, like patterns of repositories that don't
+// exist.
+func (b *Bazel) QueryPartial(ctx context.Context, args ...string) ([]string, error) {
+	output, err := b.run(ctx, "query", append([]string{"--keep_going"}, args...)...)
+	if err != nil {
+		// Exit code 3 means that the query only partially succeeded.
+		var exerr *exec.ExitError
+		if !errors.As(err, &exerr) || exerr.ExitCode() != 3 {
+			return nil, fmt.Errorf("bazel query failed: %w", err)
+		}
+	}
+	return splitLabels(output), nil
+}
 
+func splitLabels(output string) []string {
 	trimmedOutput := strings.TrimSpace(output)
 	if len(trimmedOutput) == 0 {
-		return nil, nil
+		return nil
 	}
 
-	return strings.Split(trimmedOutput, "\n"), nil
+	return strings.Split(trimmedOutput, "\n")
 }
 
 func (b *Bazel) WorkspaceRoot() string {
@@ -171,6 +310,14 @@ func (b *Bazel) BuildWorkingDirectory() string {
 	return b.buildWorkingDirectory
 }
 
+// WithBuildWorkingDirectory returns a copy of b that resolves relative
+// requests against dir instead.
+func (b *Bazel) WithBuildWorkingDirectory(dir string) *Bazel {
+	clone := *b
+	clone.buildWorkingDirectory = dir
+	return &clone
+}
+
 func (b *Bazel) ExecutionRoot() string {
 	return b.info["execution_root"]
 }
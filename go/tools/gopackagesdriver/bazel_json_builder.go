@@ -19,6 +19,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go/build"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -30,6 +31,7 @@ import (
 type BazelJSONBuilder struct {
 	bazel        *Bazel
 	includeTests bool
+	config       *buildConfig
 }
 
 var RulesGoStdlibLabel = rulesGoRepositoryName + "//:stdlib"
@@ -49,6 +51,7 @@ func (b *BazelJSONBuilder) fileQuery(label string) string {
 		label = fmt.Sprintf("@%s//%s", matches[1], strings.Join(matches[2:], ":"))
 	}
 
+	kinds := append(_defaultKinds, additionalKinds...)
 	relToBin, err := filepath.Rel(b.bazel.info["output_path"], filename)
 	if err == nil && !strings.HasPrefix(relToBin, filepath.FromSlash("../")) {
 		parts := strings.SplitN(relToBin, string(filepath.Separator), 3)
@@ -69,11 +72,10 @@ func (b *BazelJSONBuilder) fileQuery(label string) string {
 				relToBin = ""
 			}
 			label = fmt.Sprintf("//%s:all", relToBin)
-			additionalKinds = append(additionalKinds, "go_.*")
+			kinds = append(kinds, "go_.*")
 		}
 	}
 
-	kinds := append(_defaultKinds, additionalKinds...)
 	return fmt.Sprintf(`kind("^(%s) rule$", same_pkg_direct_rdeps("%s"))`, strings.Join(kinds, "|"), label)
 }
 
@@ -149,10 +151,15 @@ func (b *BazelJSONBuilder) queryFromRequests(requests ...string) string {
 	return strings.Join(ret, " union ")
 }
 
-func NewBazelJSONBuilder(bazel *Bazel, includeTests bool) (*BazelJSONBuilder, error) {
+func NewBazelJSONBuilder(bazel *Bazel, request *DriverRequest) (*BazelJSONBuilder, error) {
+	config, err := newBuildConfig(request.Env, request.BuildFlags)
+	if err != nil {
+		return nil, err
+	}
 	return &BazelJSONBuilder{
 		bazel:        bazel,
-		includeTests: includeTests,
+		includeTests: request.Tests,
+		config:       config,
 	}, nil
 }
 
@@ -164,22 +171,25 @@ func (b *BazelJSONBuilder) outputGroupsForMode(mode LoadMode) string {
 	return og
 }
 
-func (b *BazelJSONBuilder) query(ctx context.Context, query string) ([]string, error) {
+func (b *BazelJSONBuilder) queryArgs(output, query string) []string {
 	var bzlmodQueryFlags []string
 	if b.bazel.version.isAtLeast(bazelVersion{6, 4, 0}) {
 		bzlmodQueryFlags = []string{"--consistent_labels"}
 	}
-	queryArgs := concatStringsArrays(bazelQueryFlags, bzlmodQueryFlags, []string{
+	return concatStringsArrays(bazelQueryFlags, bzlmodQueryFlags, []string{
 		"--ui_event_filters=-info,-stderr",
 		"--noshow_progress",
 		"--order_output=no",
-		"--output=label",
+		"--output=" + output,
 		"--nodep_deps",
 		"--noimplicit_deps",
 		"--notool_deps",
 		query,
 	})
-	labels, err := b.bazel.Query(ctx, queryArgs...)
+}
+
+func (b *BazelJSONBuilder) query(ctx context.Context, query string) ([]string, error) {
+	labels, err := b.bazel.Query(ctx, b.queryArgs("label", query)...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to query: %w", err)
 	}
@@ -200,7 +210,41 @@ func (b *BazelJSONBuilder) Labels(ctx context.Context, requests []string) ([]str
 	return labels, nil
 }
 
-func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode LoadMode) ([]string, error) {
+// ImportLabels returns the labels of the libraries with the given import
+// paths. It is used to find the packages of imports that have not been added
+// to the deps of the importing target yet.
+func (b *BazelJSONBuilder) ImportLabels(ctx context.Context, importPaths []string) ([]string, error) {
+	quoted := make([]string, 0, len(importPaths))
+	for _, importPath := range importPaths {
+		quoted = append(quoted, regexp.QuoteMeta(importPath))
+	}
+	scope := "//..."
+	if bazelQueryScope != "" {
+		scope = fmt.Sprintf("deps(%s)", bazelQueryScope)
+	} else {
+		// Libraries of other repositories, like those of go_deps, are looked
+		// up in the repositories named after the modules that may provide the
+		// imports. Some of them may not exist.
+		for _, repo := range importRepositories(importPaths, newModuleResolver().goMod(workspaceRoot)) {
+			scope += fmt.Sprintf(" + @%s//...", repo)
+		}
+	}
+	kinds := append([]string{"go_library", "go_proto_library"}, additionalKinds...)
+	labels, err := b.bazel.QueryPartial(ctx, b.queryArgs("label", fmt.Sprintf(
+		`kind("^(%s) rule$", attr(importpath, "^(%s)$", %s))`,
+		strings.Join(kinds, "|"),
+		strings.Join(quoted, "|"),
+		scope))...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return labels, nil
+}
+
+// Build builds the .pkg.json files of the targets with the given labels. The
+// targets that failed to build are returned as packages holding the errors.
+func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode LoadMode) ([]string, []*FlatPackage, error) {
 	aspects := append(additionalAspects, goDefaultAspect)
 
 	buildArgs := concatStringsArrays([]string{
@@ -210,7 +254,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 		"--aspects=" + strings.Join(aspects, ","),
 		"--output_groups=" + b.outputGroupsForMode(mode),
 		"--keep_going", // Build all possible packages
-	}, bazelBuildFlags)
+	}, bazelBuildFlags, b.config.bazelFlags)
 
 	if len(labels) < 100 {
 		buildArgs = append(buildArgs, labels...)
@@ -218,7 +262,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 		// To avoid hitting MAX_ARGS length, write labels to a file and use `--target_pattern_file`
 		targetsFile, err := ioutil.TempFile("", "gopackagesdriver_targets_")
 		if err != nil {
-			return nil, fmt.Errorf("unable to create target pattern file: %w", err)
+			return nil, nil, fmt.Errorf("unable to create target pattern file: %w", err)
 		}
 		writer := bufio.NewWriter(targetsFile)
 		defer writer.Flush()
@@ -226,7 +270,7 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 			writer.WriteString(l + "\n")
 		}
 		if err := writer.Flush(); err != nil {
-			return nil, fmt.Errorf("unable to flush data to target pattern file: %w", err)
+			return nil, nil, fmt.Errorf("unable to flush data to target pattern file: %w", err)
 		}
 		defer func() {
 			targetsFile.Close()
@@ -235,19 +279,19 @@ func (b *BazelJSONBuilder) Build(ctx context.Context, labels []string, mode Load
 
 		buildArgs = append(buildArgs, "--target_pattern_file="+targetsFile.Name())
 	}
-	files, err := b.bazel.Build(ctx, buildArgs...)
+	result, err := b.bazel.Build(ctx, buildArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to bazel build %v: %w", buildArgs, err)
+		return nil, nil, fmt.Errorf("unable to bazel build %v: %w", buildArgs, err)
 	}
 
 	ret := []string{}
-	for _, f := range files {
+	for _, f := range result.Files {
 		if strings.HasSuffix(f, ".pkg.json") {
 			ret = append(ret, cleanPath(f))
 		}
 	}
 
-	return ret, nil
+	return ret, b.failedPackages(ctx, result, labels), nil
 }
 
 func (b *BazelJSONBuilder) PathResolver() PathResolverFunc {
@@ -259,6 +303,12 @@ func (b *BazelJSONBuilder) PathResolver() PathResolverFunc {
 	}
 }
 
+// BuildContext returns the build context that source files are filtered
+// with.
+func (b *BazelJSONBuilder) BuildContext() *build.Context {
+	return b.config.context
+}
+
 func cleanPath(p string) string {
 	// On Windows the paths may contain a starting `\`, this would make them not resolve
 	if runtime.GOOS == "windows" && p[0] == '\\' {
@@ -1,12 +1,89 @@
 package main
 
 import (
+	"fmt"
 	"go/build"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
-var buildContext = makeBuildContext()
+// buildConfig holds the Bazel build flags and the build context that match
+// the environment and build flags of a request.
+type buildConfig struct {
+	bazelFlags []string
+	context    *build.Context
+}
+
+// newBuildConfig translates the environment and the go build flags of a
+// request to Bazel build flags: -tags sets gotags, GOOS and GOARCH select a
+// platform and CGO_ENABLED sets pure. Other build flags are passed to Bazel
+// as is.
+func newBuildConfig(env, buildFlags []string) (*buildConfig, error) {
+	bctx := makeBuildContext()
+	c := &buildConfig{context: bctx}
+
+	var tags []string
+	var hasTags bool
+	for i := 0; i < len(buildFlags); i++ {
+		flag := buildFlags[i]
+		name, value, hasValue := strings.Cut(flag, "=")
+		if name != "-tags" && name != "--tags" {
+			c.bazelFlags = append(c.bazelFlags, flag)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(buildFlags) {
+				return nil, fmt.Errorf("missing value for build flag %s", flag)
+			}
+			i++
+			value = buildFlags[i]
+		}
+		// Like with go build, tags may be separated by commas or spaces and
+		// the last -tags flag wins.
+		tags = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		hasTags = true
+	}
+	if hasTags {
+		c.bazelFlags = append(c.bazelFlags, "--define=gotags="+strings.Join(tags, ","))
+		bctx.BuildTags = append(bctx.BuildTags, tags...)
+	}
+
+	vars := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if v := vars["GOOS"]; v != "" {
+		goos = v
+	}
+	if v := vars["GOARCH"]; v != "" {
+		goarch = v
+	}
+	cgo := vars["CGO_ENABLED"]
+	bctx.GOOS, bctx.GOARCH = goos, goarch
+	if goos != runtime.GOOS || goarch != runtime.GOARCH {
+		// Cross-compiling platforms disable cgo unless asked for.
+		platform := fmt.Sprintf("%s//go/toolchain:%s_%s", rulesGoRepositoryName, goos, goarch)
+		if cgo == "1" {
+			platform += "_cgo"
+		}
+		c.bazelFlags = append(c.bazelFlags, "--platforms="+platform)
+		bctx.CgoEnabled = cgo == "1"
+	}
+	switch cgo {
+	case "0":
+		c.bazelFlags = append(c.bazelFlags, "--"+rulesGoRepositoryName+"//go/config:pure")
+		bctx.CgoEnabled = false
+	case "1":
+		c.bazelFlags = append(c.bazelFlags, "--"+rulesGoRepositoryName+"//go/config:pure=false")
+		bctx.CgoEnabled = true
+	}
+
+	return c, nil
+}
 
 func makeBuildContext() *build.Context {
 	bctx := build.Default
@@ -15,14 +92,14 @@ func makeBuildContext() *build.Context {
 	return &bctx
 }
 
-func filterSourceFilesForTags(files []string) []string {
+func filterSourceFilesForTags(bctx *build.Context, files []string) []string {
 	ret := make([]string, 0, len(files))
 
 	for _, f := range files {
 		dir, filename := filepath.Split(f)
 		ext := filepath.Ext(f)
 
-		match, _ := buildContext.MatchFile(dir, filename)
+		match, _ := bctx.MatchFile(dir, filename)
 		// MatchFile filters out anything without a file extension. In the
 		// case of CompiledGoFiles (in particular gco processed files from
 		// the cache), we want them.
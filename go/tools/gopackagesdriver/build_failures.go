@@ -0,0 +1,207 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xmlQuery is the part of the XML output of bazel query that describes where
+// rules are defined, their import path and their sources.
+type xmlQuery struct {
+	Rules []xmlRule `xml:"rule"`
+}
+
+type xmlRule struct {
+	Name     string `xml:"name,attr"`
+	Location string `xml:"location,attr"`
+	Strings  []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"string"`
+	Lists []struct {
+		Name   string `xml:"name,attr"`
+		Labels []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"label"`
+	} `xml:"list"`
+}
+
+func (r *xmlRule) stringAttr(name string) string {
+	for _, s := range r.Strings {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func (r *xmlRule) labelListAttr(name string) []string {
+	var labels []string
+	for _, l := range r.Lists {
+		if l.Name == name {
+			for _, label := range l.Labels {
+				labels = append(labels, label.Value)
+			}
+		}
+	}
+	return labels
+}
+
+// failedPackages returns packages for the targets that failed to build, with
+// the errors Bazel reported for them at the position of their rule. They
+// replace the .pkg.json files that the targets did not produce.
+func (b *BazelJSONBuilder) failedPackages(ctx context.Context, result *BuildResult, requested []string) []*FlatPackage {
+	if len(result.Failures) == 0 {
+		return nil
+	}
+	labels := keysFromMap(result.Failures)
+	sort.Strings(labels)
+	// Use the labels as queried, which are the IDs of the packages.
+	ids := map[string]string{}
+	for _, label := range requested {
+		ids[unqualifiedLabel(label)] = label
+	}
+
+	rules, err := b.queryRules(ctx, labels)
+	if err != nil {
+		// The errors are still worth reporting without a position.
+		fmt.Fprintf(os.Stderr, "unable to lookup failed targets: %v\n", err)
+	}
+
+	pkgs := make([]*FlatPackage, 0, len(labels))
+	for _, label := range labels {
+		pkg := &FlatPackage{
+			ID:      label,
+			Imports: map[string]string{},
+		}
+		id, requested := ids[unqualifiedLabel(label)]
+		if requested {
+			pkg.ID = id
+		}
+		var pos string
+		var msgs []string
+		if rule, ok := rules[unqualifiedLabel(label)]; ok {
+			if !requested {
+				pkg.ID = rule.Name
+			}
+			pkg.PkgPath = rule.stringAttr("importpath")
+			for _, src := range rule.labelListAttr("srcs") {
+				if path := b.sourcePath(src); strings.HasSuffix(path, ".go") {
+					pkg.GoFiles = append(pkg.GoFiles, path)
+				}
+			}
+			if len(pkg.GoFiles) > 0 {
+				pkg.Name = packageName(pkg.GoFiles[0])
+			}
+			// Errors printed at the position of the rule are usually the most
+			// precise ones.
+			pos = rule.Location
+			for _, e := range result.Errors {
+				if msg := strings.TrimPrefix(e, pos+": "); pos != "" && msg != e {
+					msgs = append(msgs, msg)
+				}
+			}
+		}
+		for _, msg := range result.Failures[label] {
+			if !contains(msgs, msg) {
+				msgs = append(msgs, msg)
+			}
+		}
+		pkg.Errors = []FlatPackagesError{{
+			Pos:  pos,
+			Msg:  strings.Join(msgs, "\n"),
+			Kind: ListError,
+		}}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+// queryRules returns the rules of the given labels, by their label without
+// repository qualifiers.
+func (b *BazelJSONBuilder) queryRules(ctx context.Context, labels []string) (map[string]*xmlRule, error) {
+	quoted := make([]string, 0, len(labels))
+	for _, label := range labels {
+		quoted = append(quoted, strconv.Quote(label))
+	}
+	output, err := b.bazel.run(ctx, "query", b.queryArgs("xml", strings.Join(quoted, " + "))...)
+	if err != nil {
+		return nil, fmt.Errorf("bazel query failed: %w", err)
+	}
+	// Bazel declares XML 1.1, which encoding/xml does not support, but the
+	// output does not use any of its features.
+	if strings.HasPrefix(output, "<?xml") {
+		if i := strings.Index(output, "?>"); i >= 0 {
+			output = output[i+len("?>"):]
+		}
+	}
+	var q xmlQuery
+	if err := xml.Unmarshal([]byte(output), &q); err != nil {
+		return nil, fmt.Errorf("unable to parse query output: %w", err)
+	}
+	rules := make(map[string]*xmlRule, len(q.Rules))
+	for i := range q.Rules {
+		rules[unqualifiedLabel(q.Rules[i].Name)] = &q.Rules[i]
+	}
+	return rules, nil
+}
+
+// unqualifiedLabel strips the @ signs from a label, since Bazel qualifies the
+// labels of the main repository differently in build events and queries.
+func unqualifiedLabel(label string) string {
+	return strings.TrimLeft(label, "@")
+}
+
+// sourcePath returns the path of a source file label, or nothing if the file
+// does not exist, such as when it is generated.
+func (b *BazelJSONBuilder) sourcePath(label string) string {
+	repo, rest, ok := strings.Cut(unqualifiedLabel(label), "//")
+	if !ok {
+		return ""
+	}
+	pkg, name, ok := strings.Cut(rest, ":")
+	if !ok {
+		return ""
+	}
+	root := b.bazel.WorkspaceRoot()
+	if repo != "" {
+		root = filepath.Join(b.bazel.OutputBase(), "external", repo)
+	}
+	path := filepath.Join(root, filepath.FromSlash(pkg), filepath.FromSlash(name))
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// packageName returns the package name declared in a Go file, which may not
+// compile.
+func packageName(file string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+	if err != nil || f.Name == nil {
+		return ""
+	}
+	return f.Name.Name
+}
@@ -0,0 +1,128 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// serverStartTimeout is how long a driver waits for the server it started to
+// listen on its socket.
+const serverStartTimeout = 10 * time.Second
+
+// runClient forwards a request to the driver server listening on
+// serverSocket, starting it if needed. The packages are loaded without the
+// server if it can't be reached or runs with other settings.
+func runClient(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("unable to read request: %w", err)
+	}
+	request, err := ReadDriverRequest(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to read request: %w", err)
+	}
+
+	conn, err := dialServer(serverSocket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to reach driver server, loading packages without it: %v\n", err)
+		return run(ctx, bytes.NewReader(data), out, args)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := json.NewEncoder(conn).Encode(&serverRequest{
+		Settings:         currentSettings(),
+		WorkingDirectory: buildWorkingDirectory,
+		Args:             args,
+		Request:          request,
+	}); err != nil {
+		return fmt.Errorf("unable to send request to driver server: %w", err)
+	}
+	var resp serverResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("unable to read response of driver server: %w", err)
+	}
+	if resp.Rejected {
+		fmt.Fprintf(os.Stderr, "%s, loading packages without it\n", resp.Error)
+		return run(ctx, bytes.NewReader(data), out, args)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	_, err = out.Write(resp.Response)
+	return err
+}
+
+func dialServer(socket string) (net.Conn, error) {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		return conn, nil
+	}
+	if err := startServer(socket); err != nil {
+		return nil, fmt.Errorf("unable to start driver server: %w", err)
+	}
+	deadline := time.Now().Add(serverStartTimeout)
+	for {
+		conn, err := net.Dial("unix", socket)
+		if err == nil || time.Now().After(deadline) {
+			return conn, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// startServer starts a driver server that outlives this driver. Its output
+// is appended to a log file next to the socket.
+func startServer(socket string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(socket+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := exec.Command(exe, serveFlag)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -72,9 +72,9 @@ const NeedExportsFile = NeedExportFile
 type DriverRequest struct {
 	Mode LoadMode `json:"mode"`
 	// Env specifies the environment the underlying build system should be run in.
-	// Env []string `json:"env"`
+	Env []string `json:"env"`
 	// BuildFlags are flags that should be passed to the underlying build system.
-	// BuildFlags []string `json:"build_flags"`
+	BuildFlags []string `json:"build_flags"`
 	// Tests specifies whether the patterns should also return test packages.
 	Tests bool `json:"tests"`
 	// Overlay maps file paths (relative to the driver's working directory) to the byte contents
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"io"
@@ -26,7 +27,7 @@ import (
 	"strings"
 )
 
-type ResolvePkgFunc func(importPath string) string
+type ResolvePkgFunc func(importPath string) *FlatPackage
 
 // Copy and pasted from golang.org/x/tools/go/packages
 type FlatPackagesError struct {
@@ -52,6 +53,18 @@ func (err FlatPackagesError) Error() string {
 	return pos + ": " + err.Msg
 }
 
+// Module provides module information for a package.
+// Copy and pasted from golang.org/x/tools/go/packages, without the fields
+// that are not filled.
+type Module struct {
+	Path      string // module path
+	Version   string `json:",omitempty"` // module version
+	Main      bool   `json:",omitempty"` // is this the main module?
+	Dir       string `json:",omitempty"` // directory holding files for this module, if any
+	GoMod     string `json:",omitempty"` // path to go.mod file used when loading this module, if any
+	GoVersion string `json:",omitempty"` // go version used in module
+}
+
 // FlatPackage is the JSON form of Package
 // It drops all the type and syntax fields, and transforms the Imports
 type FlatPackage struct {
@@ -65,6 +78,7 @@ type FlatPackage struct {
 	ExportFile      string              `json:",omitempty"`
 	Imports         map[string]string   `json:",omitempty"`
 	Standard        bool                `json:",omitempty"`
+	Module          *Module             `json:",omitempty"`
 }
 
 type (
@@ -102,14 +116,17 @@ func (fp *FlatPackage) ResolvePaths(prf PathResolverFunc) error {
 	resolvePathsInPlace(prf, fp.GoFiles)
 	resolvePathsInPlace(prf, fp.OtherFiles)
 	fp.ExportFile = prf(fp.ExportFile)
+	if fp.Module != nil {
+		fp.Module.Dir = prf(fp.Module.Dir)
+	}
 	return nil
 }
 
-// FilterFilesForBuildTags filters the source files given the current build
-// tags.
-func (fp *FlatPackage) FilterFilesForBuildTags() {
-	fp.GoFiles = filterSourceFilesForTags(fp.GoFiles)
-	fp.CompiledGoFiles = filterSourceFilesForTags(fp.CompiledGoFiles)
+// FilterFilesForBuildTags filters the source files given the build tags and
+// platform of bctx.
+func (fp *FlatPackage) FilterFilesForBuildTags(bctx *build.Context) {
+	fp.GoFiles = filterSourceFilesForTags(bctx, fp.GoFiles)
+	fp.CompiledGoFiles = filterSourceFilesForTags(bctx, fp.CompiledGoFiles)
 }
 
 func (fp *FlatPackage) filterTestSuffix(files []string) (err error, testFiles []string, xTestFiles, nonTestFiles []string) {
@@ -158,19 +175,72 @@ func (fp *FlatPackage) MoveTestFiles() *FlatPackage {
 
 	newImports[fp.PkgPath] = fp.ID
 
+	// Errors in the external test files belong to the external test package.
+	var errs, xErrs []FlatPackagesError
+	for _, e := range fp.Errors {
+		switch file := errorFile(e); {
+		case contains(xtgf, file) || contains(cxtgf, file):
+			xErrs = append(xErrs, e)
+		case contains(fp.GoFiles, file) || contains(fp.CompiledGoFiles, file):
+			errs = append(errs, e)
+		default:
+			errs = append(errs, e)
+			xErrs = append(xErrs, e)
+		}
+	}
+	fp.Errors = errs
+
 	// Clone package, only xtgf files
 	return &FlatPackage{
 		ID:              fp.ID + "_xtest",
 		Name:            fp.Name + "_test",
 		PkgPath:         fp.PkgPath + "_test",
 		Imports:         newImports,
-		Errors:          fp.Errors,
+		Errors:          xErrs,
 		GoFiles:         append([]string{}, xtgf...),
 		CompiledGoFiles: append([]string{}, cxtgf...),
 		OtherFiles:      fp.OtherFiles,
 		ExportFile:      fp.ExportFile,
 		Standard:        fp.Standard,
+		Module:          fp.Module,
+	}
+}
+
+// Clone returns a copy of the package whose files and imports can be
+// modified without affecting fp.
+func (fp *FlatPackage) Clone() *FlatPackage {
+	clone := *fp
+	clone.Errors = append([]FlatPackagesError(nil), fp.Errors...)
+	clone.GoFiles = append([]string(nil), fp.GoFiles...)
+	clone.CompiledGoFiles = append([]string(nil), fp.CompiledGoFiles...)
+	clone.OtherFiles = append([]string(nil), fp.OtherFiles...)
+	if fp.Module != nil {
+		module := *fp.Module
+		clone.Module = &module
+	}
+	if fp.Imports != nil {
+		clone.Imports = make(map[string]string, len(fp.Imports))
+		for k, v := range fp.Imports {
+			clone.Imports[k] = v
+		}
+	}
+	return &clone
+}
+
+// errorFile returns the file of the position of an error.
+func errorFile(err FlatPackagesError) string {
+	file := err.Pos
+	for i := 0; i < 2; i++ {
+		j := strings.LastIndexByte(file, ':')
+		if j < 0 {
+			break
+		}
+		if _, err := strconv.Atoi(file[j+1:]); err != nil {
+			break
+		}
+		file = file[:j]
 	}
+	return file
 }
 
 func (fp *FlatPackage) IsStdlib() bool {
@@ -179,6 +249,8 @@ func (fp *FlatPackage) IsStdlib() bool {
 
 // ResolveImports resolves imports for non-stdlib packages and integrates file overlays
 // to allow modification of package imports without modifying disk files.
+// Imports of packages that are not in the deps of the package are resolved too
+// and reported as errors.
 func (fp *FlatPackage) ResolveImports(resolve ResolvePkgFunc, overlays map[string][]byte) error {
 	// Stdlib packages are already complete import wise
 	if fp.IsStdlib() {
@@ -213,12 +285,34 @@ func (fp *FlatPackage) ResolveImports(resolve ResolvePkgFunc, overlays map[strin
 			if imp == "C" {
 				continue
 			}
+			// Files of the external test package import the package itself.
+			if imp == fp.PkgPath {
+				continue
+			}
 			if _, ok := fp.Imports[imp]; ok {
 				continue
 			}
 
-			if pkgID := resolve(imp); pkgID != "" {
-				fp.Imports[imp] = pkgID
+			pkg := resolve(imp)
+			if pkg == nil {
+				if isDomainImportPath(imp) {
+					// No target was found, but it still has to be added.
+					fp.Errors = append(fp.Errors, FlatPackagesError{
+						Pos:  fset.Position(rawImport.Pos()).String(),
+						Msg:  fmt.Sprintf("no library found for import %q, whose target has to be added to the deps of %s", imp, targetLabel(fp.ID)),
+						Kind: ListError,
+					})
+				}
+				continue
+			}
+			fp.Imports[imp] = pkg.ID
+			if !pkg.IsStdlib() {
+				// The import was added without updating the BUILD file.
+				fp.Errors = append(fp.Errors, FlatPackagesError{
+					Pos:  fset.Position(rawImport.Pos()).String(),
+					Msg:  fmt.Sprintf("import %q requires adding %q to the deps of %s", imp, targetLabel(pkg.ID), targetLabel(fp.ID)),
+					Kind: ListError,
+				})
 			}
 		}
 	}
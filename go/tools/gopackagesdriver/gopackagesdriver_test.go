@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -35,6 +39,11 @@ go_test(
 	embed = [":hello"],
 )
 
+-- go.mod --
+module example.com/hello
+
+go 1.21
+
 -- hello.go --
 package hello
 
@@ -63,7 +72,10 @@ load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
     name = "subhello",
-    srcs = ["subhello.go"],
+    srcs = [
+        "subhello.go",
+        "subhello_integration.go",
+    ],
     importpath = "example.com/hello/subhello",
     visibility = ["//visibility:public"],
 )
@@ -76,6 +88,28 @@ import "os"
 func main() {
 	fmt.Fprintln(os.Stderr, "Subdirectory Hello World!")
 }
+
+-- subhello/subhello_integration.go --
+//go:build integration
+
+package subhello
+
+-- broken/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+filegroup(
+    name = "data",
+)
+
+go_library(
+    name = "broken",
+    srcs = ["broken.go"],
+    importpath = "example.com/hello/broken",
+    deps = [":data"],
+)
+
+-- broken/broken.go --
+package broken
 		`,
 	})
 }
@@ -266,6 +300,158 @@ func TestExternalTests(t *testing.T) {
 	}
 }
 
+func TestBuildFlags(t *testing.T) {
+	resp := runForTest(t, DriverRequest{BuildFlags: []string{"-tags", "integration"}}, "subhello", "file=./subhello.go")
+
+	pkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if pkg == nil {
+		t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+	}
+	assertSuffixesInList(t, pkg.GoFiles, "/subhello.go", "/subhello_integration.go")
+}
+
+func TestBuildFailure(t *testing.T) {
+	resp := runForTest(t, DriverRequest{}, "broken", "file=./broken.go")
+	if len(resp.Roots) != 1 {
+		t.Fatalf("Expected 1 package root: %+v", resp.Roots)
+	}
+
+	pkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if pkg == nil {
+		t.Fatalf("Expected to find %q in resp.Packages", resp.Roots[0])
+	}
+	assertSuffixesInList(t, pkg.GoFiles, "/broken.go")
+	if len(pkg.Errors) != 1 {
+		t.Fatalf("Expected 1 error for the failed target, got %+v", pkg.Errors)
+	}
+	if err := pkg.Errors[0]; err.Kind != ListError || !strings.Contains(err.Pos, "broken/BUILD.bazel:") || err.Msg == "" {
+		t.Errorf("Expected a list error at the rule of the failed target, got %+v", err)
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	otherOS := "linux"
+	if runtime.GOOS == "linux" {
+		otherOS = "windows"
+	}
+	for _, tc := range []struct {
+		desc       string
+		env        []string
+		buildFlags []string
+		want       []string
+	}{
+		{
+			desc: "empty",
+		}, {
+			desc:       "tags",
+			buildFlags: []string{"-tags=a,b", "--config=ci", "--tags", "c d"},
+			want:       []string{"--config=ci", "--define=gotags=c,d"},
+		}, {
+			desc: "host",
+			env:  []string{"GOOS=" + runtime.GOOS, "GOARCH=" + runtime.GOARCH},
+		}, {
+			desc: "platform",
+			env:  []string{"GOOS=" + otherOS, "GOARCH=arm64"},
+			want: []string{"--platforms=" + rulesGoRepositoryName + "//go/toolchain:" + otherOS + "_arm64"},
+		}, {
+			desc: "cgo platform",
+			env:  []string{"GOOS=" + otherOS, "GOARCH=amd64", "CGO_ENABLED=1"},
+			want: []string{
+				"--platforms=" + rulesGoRepositoryName + "//go/toolchain:" + otherOS + "_amd64_cgo",
+				"--" + rulesGoRepositoryName + "//go/config:pure=false",
+			},
+		}, {
+			desc: "pure",
+			env:  []string{"CGO_ENABLED=1", "CGO_ENABLED=0"},
+			want: []string{"--" + rulesGoRepositoryName + "//go/config:pure"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := newBuildConfig(tc.env, tc.buildFlags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(c.bazelFlags, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("got flags %q, want %q", c.bazelFlags, tc.want)
+			}
+		})
+	}
+
+	if _, err := newBuildConfig(nil, []string{"-tags"}); err == nil {
+		t.Error("Expected an error for -tags without a value")
+	}
+}
+
+func TestModule(t *testing.T) {
+	resp := runForTest(t, DriverRequest{}, ".", "file=hello.go")
+
+	for _, pkg := range resp.Packages {
+		if pkg.ID == osPkgID || pkg.ID == bzlmodOsPkgID {
+			if pkg.Module != nil {
+				t.Errorf("Expected no module for stdlib package %q, got %+v", pkg.ID, pkg.Module)
+			}
+			continue
+		}
+		if pkg.PkgPath != "example.com/hello" {
+			continue
+		}
+		m := pkg.Module
+		if m == nil {
+			t.Fatalf("Expected a module for package %q", pkg.ID)
+		}
+		if m.Path != "example.com/hello" || !m.Main || m.GoVersion != "1.21" || !strings.HasSuffix(m.GoMod, "/go.mod") {
+			t.Errorf("Unexpected module for package %q: %+v", pkg.ID, m)
+		}
+	}
+}
+
+func TestParseGoMod(t *testing.T) {
+	gomod := parseGoMod("go.mod", []byte(`// A comment.
+module "example.com/m" // trailing comment
+
+go 1.21
+
+require example.com/a v1.0.0
+require (
+	example.com/b v1.2.3 // indirect
+	"example.com/c" v0.0.0-20240101000000-abcdef123456
+)
+
+replace example.com/a => ./a
+`))
+	if gomod.module != "example.com/m" {
+		t.Errorf("got module %q, want %q", gomod.module, "example.com/m")
+	}
+	if gomod.goVersion != "1.21" {
+		t.Errorf("got go version %q, want %q", gomod.goVersion, "1.21")
+	}
+	want := map[string]string{
+		"example.com/a": "v1.0.0",
+		"example.com/b": "v1.2.3",
+		"example.com/c": "v0.0.0-20240101000000-abcdef123456",
+	}
+	if len(gomod.requires) != len(want) {
+		t.Errorf("got requires %v, want %v", gomod.requires, want)
+	}
+	for path, version := range want {
+		if gomod.requires[path] != version {
+			t.Errorf("got version %q for %s, want %q", gomod.requires[path], path, version)
+		}
+	}
+}
+
+func TestImportRepositories(t *testing.T) {
+	gomod := parseGoMod("go.mod", []byte(`module example.com/hello
+
+require github.com/Example/go-lib v1.0.0
+`))
+	got := importRepositories([]string{"github.com/Example/go-lib/sub", "example.com/other/pkg", "fmt"}, gomod)
+	want := []string{"com_example", "com_example_other", "com_example_other_pkg", "com_github_example_go_lib"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got repositories %v, want %v", got, want)
+	}
+}
+
 func TestOverlay(t *testing.T) {
 	// format filepaths for overlay request using working directory
 	wd, err := os.Getwd()
@@ -324,8 +510,181 @@ func TestOverlay(t *testing.T) {
 	expectSetEquality(t, expectedImportsPerFile[subhelloPath], subhelloPkgImportPaths, "subhello imports")
 }
 
+func TestOverlayMissingDep(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	helloPath := path.Join(wd, "hello.go")
+
+	resp := runForTest(t, DriverRequest{
+		Overlay: map[string][]byte{
+			helloPath: []byte(`
+				package hello
+				import "os"
+				import "example.com/hello/subhello"
+				`),
+		},
+	}, ".", "file=hello.go")
+
+	helloPkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if helloPkg == nil {
+		t.Fatalf("hello package not found in response root %q", resp.Roots[0])
+	}
+	subhelloID, ok := helloPkg.Imports["example.com/hello/subhello"]
+	if !ok {
+		t.Fatalf("Expected subhello import to be resolved:\n%+v", helloPkg)
+	}
+	if findPackageByID(resp.Packages, subhelloID) == nil {
+		t.Errorf("Expected %q to be included in resp.Packages", subhelloID)
+	}
+
+	if len(helloPkg.Errors) != 1 || !strings.Contains(helloPkg.Errors[0].Msg, `"//subhello:subhello"`) ||
+		!strings.HasPrefix(helloPkg.Errors[0].Pos, helloPath+":") {
+		t.Errorf("Expected an error naming the missing dep //subhello:subhello in hello.go:\n%+v", helloPkg.Errors)
+	}
+}
+
+func TestOverlayUnknownImport(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	helloPath := path.Join(wd, "hello.go")
+
+	resp := runForTest(t, DriverRequest{
+		Overlay: map[string][]byte{
+			helloPath: []byte(`
+				package hello
+				import "os"
+				import "example.com/unknown"
+				`),
+		},
+	}, ".", "file=hello.go")
+
+	helloPkg := findPackageByID(resp.Packages, resp.Roots[0])
+	if helloPkg == nil {
+		t.Fatalf("hello package not found in response root %q", resp.Roots[0])
+	}
+	if len(helloPkg.Errors) != 1 || !strings.Contains(helloPkg.Errors[0].Msg, `no library found for import "example.com/unknown"`) ||
+		!strings.HasPrefix(helloPkg.Errors[0].Pos, helloPath+":") {
+		t.Errorf("Expected an error naming the unknown import in hello.go:\n%+v", helloPkg.Errors)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := newDriverServer()
+	runServer := func(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
+		request, err := ReadDriverRequest(in)
+		if err != nil {
+			return err
+		}
+		resp, err := s.handle(ctx, &serverRequest{
+			Settings:         currentSettings(),
+			WorkingDirectory: buildWorkingDirectory,
+			Args:             args,
+			Request:          request,
+		})
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(resp)
+	}
+	helloImports := func(resp driverResponse) []string {
+		t.Helper()
+		pkg := findPackageByID(resp.Packages, resp.Roots[0])
+		if pkg == nil {
+			t.Fatalf("hello package not found in response root %q", resp.Roots[0])
+		}
+		return keysFromMap(pkg.Imports)
+	}
+
+	resp := runWithForTest(t, runServer, DriverRequest{}, ".", "file=hello.go")
+	expectSetEquality(t, []string{"os"}, helloImports(resp), "hello imports")
+
+	// Requests for cached packages must not invoke Bazel.
+	oldBazelBin := s.bazel.bazelBin
+	s.bazel.bazelBin = "/nonexistent/bazel"
+	defer func() { s.bazel.bazelBin = oldBazelBin }()
+
+	resp = runWithForTest(t, runServer, DriverRequest{}, ".", "file=hello.go")
+	expectSetEquality(t, []string{"os"}, helloImports(resp), "hello imports")
+
+	// Changed sources only have their imports resolved again.
+	hello, err := os.ReadFile("hello.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.WriteFile("hello.go", hello, 0o666)
+	if err := os.WriteFile("hello.go", []byte("package hello\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = runWithForTest(t, runServer, DriverRequest{}, ".", "file=hello.go")
+	expectSetEquality(t, []string{"fmt", "os"}, helloImports(resp), "hello imports")
+
+	// A changed go.mod file changes the module of the package.
+	gomod, err := os.ReadFile("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.WriteFile("go.mod", gomod, 0o666)
+	if err := os.WriteFile("go.mod", []byte("module example.com/hello\n\ngo 1.22.0\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = runWithForTest(t, runServer, DriverRequest{}, ".", "file=hello.go")
+	if m := findPackageByID(resp.Packages, resp.Roots[0]).Module; m == nil || m.GoVersion != "1.22.0" {
+		t.Errorf("Expected the module of the hello package to have go version 1.22.0, got %+v", m)
+	}
+
+	// A go.mod file added to the directory of a cached package makes it a
+	// module of its own. The directory changed, so the package is built again.
+	s.bazel.bazelBin = oldBazelBin
+	resp = runWithForTest(t, runServer, DriverRequest{}, "subhello", "file=subhello.go")
+	if m := findPackageByID(resp.Packages, resp.Roots[0]).Module; m == nil || m.Path != "example.com/hello" {
+		t.Errorf("Expected the subhello package to be in module example.com/hello, got %+v", m)
+	}
+	defer os.Remove("subhello/go.mod")
+	if err := os.WriteFile("subhello/go.mod", []byte("module example.com/hello/subhello\n\ngo 1.21\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = runWithForTest(t, runServer, DriverRequest{}, "subhello", "file=subhello.go")
+	if m := findPackageByID(resp.Packages, resp.Roots[0]).Module; m == nil || m.Path != "example.com/hello/subhello" {
+		t.Errorf("Expected the subhello package to be in module example.com/hello/subhello, got %+v", m)
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	s := newDriverServer()
+	s.busy <- struct{}{}
+
+	// A request cancelled while another is served returns without waiting.
+	client, server := net.Pipe()
+	ctx := connContext(context.Background(), server)
+	client.Close()
+	if _, err := s.handle(ctx, &serverRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the request to be cancelled once the driver closed the connection, got %v", err)
+	}
+}
+
+func TestServerSettings(t *testing.T) {
+	s := newDriverServer()
+	settings := currentSettings()
+	settings.BuildFlags = append(settings.BuildFlags, "--config=other")
+	if _, err := s.handle(context.Background(), &serverRequest{Settings: settings}); !errors.Is(err, errSettings) {
+		t.Errorf("Expected a request with other build flags to be rejected, got %v", err)
+	}
+}
+
 func runForTest(t *testing.T, driverRequest DriverRequest, relativeWorkingDir string, args ...string) driverResponse {
 	t.Helper()
+	return runWithForTest(t, run, driverRequest, relativeWorkingDir, args...)
+}
+
+func runWithForTest(t *testing.T, run func(context.Context, io.Reader, io.Writer, []string) error, driverRequest DriverRequest, relativeWorkingDir string, args ...string) driverResponse {
+	t.Helper()
 
 	// Remove most environment variables, other than those on an allowlist.
 	//
@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"go/build"
 	"runtime"
 )
 
@@ -23,7 +24,7 @@ type JSONPackagesDriver struct {
 	registry *PackageRegistry
 }
 
-func NewJSONPackagesDriver(jsonFiles []string, prf PathResolverFunc, bazelVersion bazelVersion, overlays map[string][]byte) (*JSONPackagesDriver, error) {
+func NewJSONPackagesDriver(jsonFiles []string, failures []*FlatPackage, prf PathResolverFunc, bctx *build.Context, bazelVersion bazelVersion, overlays map[string][]byte) (*JSONPackagesDriver, error) {
 	jpd := &JSONPackagesDriver{
 		registry: NewPackageRegistry(bazelVersion),
 	}
@@ -35,11 +36,14 @@ func NewJSONPackagesDriver(jsonFiles []string, prf PathResolverFunc, bazelVersio
 			return nil, fmt.Errorf("unable to walk json: %w", err)
 		}
 	}
+	jpd.registry.AddFailures(failures...)
 
-	if err := jpd.registry.ResolvePaths(prf); err != nil {
+	if err := jpd.registry.ResolvePaths(prf, bctx); err != nil {
 		return nil, fmt.Errorf("unable to resolve paths: %w", err)
 	}
 
+	jpd.registry.ResolveModules()
+
 	if err := jpd.registry.ResolveImports(overlays); err != nil {
 		return nil, fmt.Errorf("unable to resolve imports: %w", err)
 	}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -66,6 +67,8 @@ var (
 	buildWorkingDirectory = os.Getenv("BUILD_WORKING_DIRECTORY")
 	additionalAspects     = strings.Fields(os.Getenv("GOPACKAGESDRIVER_BAZEL_ADDTL_ASPECTS"))
 	additionalKinds       = strings.Fields(os.Getenv("GOPACKAGESDRIVER_BAZEL_KINDS"))
+	serverSocket          = os.Getenv("GOPACKAGESDRIVER_SERVER")
+	serverIdleTimeout     = getenvDefault("GOPACKAGESDRIVER_SERVER_IDLE_TIMEOUT", "3h")
 	emptyResponse         = &driverResponse{
 		NotHandled: true,
 		Compiler:   "gc",
@@ -76,55 +79,126 @@ var (
 )
 
 func run(ctx context.Context, in io.Reader, out io.Writer, args []string) error {
-	queries := args
-
 	request, err := ReadDriverRequest(in)
 	if err != nil {
 		return fmt.Errorf("unable to read request: %w", err)
 	}
 
+	resp, err := load(ctx, request, args)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("unable to marshal response: %v", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func load(ctx context.Context, request *DriverRequest, queries []string) (*driverResponse, error) {
 	bazel, err := NewBazel(ctx, bazelBin, workspaceRoot, buildWorkingDirectory, bazelCommonFlags, bazelStartupFlags)
 	if err != nil {
-		return fmt.Errorf("unable to create bazel instance: %w", err)
+		return nil, fmt.Errorf("unable to create bazel instance: %w", err)
 	}
 
-	bazelJsonBuilder, err := NewBazelJSONBuilder(bazel, request.Tests)
+	bazelJsonBuilder, err := NewBazelJSONBuilder(bazel, request)
 	if err != nil {
-		return fmt.Errorf("unable to build JSON files: %w", err)
+		return nil, fmt.Errorf("unable to build JSON files: %w", err)
 	}
 
 	labels, err := bazelJsonBuilder.Labels(ctx, queries)
 	if err != nil {
-		return fmt.Errorf("unable to lookup package: %w", err)
+		return nil, fmt.Errorf("unable to lookup package: %w", err)
 	}
 
-	jsonFiles, err := bazelJsonBuilder.Build(ctx, labels, request.Mode)
+	jsonFiles, failures, err := bazelJsonBuilder.Build(ctx, labels, request.Mode)
 	if err != nil {
-		return fmt.Errorf("unable to build JSON files: %w", err)
+		return nil, fmt.Errorf("unable to build JSON files: %w", err)
 	}
 
-	driver, err := NewJSONPackagesDriver(jsonFiles, bazelJsonBuilder.PathResolver(), bazel.version, request.Overlay)
+	driver, err := NewJSONPackagesDriver(jsonFiles, failures, bazelJsonBuilder.PathResolver(), bazelJsonBuilder.BuildContext(), bazel.version, request.Overlay)
 	if err != nil {
-		return fmt.Errorf("unable to load JSON files: %w", err)
+		return nil, fmt.Errorf("unable to load JSON files: %w", err)
+	}
+
+	// Imports may have been added before the deps in BUILD files. Load their
+	// packages too, so that they resolve. Imports that were not found before
+	// are only looked up again once the sources importing them change.
+	unknownPath := filepath.Join(bazel.OutputBase(), unknownImportsFile)
+	unknown := readUnknownImports(unknownPath)
+	var missing []string
+	for _, importPath := range driver.registry.MissingImports() {
+		if _, ok := unknown[importPath]; !ok {
+			missing = append(missing, importPath)
+		}
+	}
+	if importJsonFiles := buildMissingImports(ctx, bazelJsonBuilder, missing, request.Mode); len(importJsonFiles) > 0 {
+		driver, err = NewJSONPackagesDriver(append(jsonFiles, importJsonFiles...), failures, bazelJsonBuilder.PathResolver(), bazelJsonBuilder.BuildContext(), bazel.version, request.Overlay)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load JSON files: %w", err)
+		}
+	}
+	if len(missing) > 0 {
+		stillMissing := driver.registry.MissingImports()
+		for _, importPath := range missing {
+			if contains(stillMissing, importPath) {
+				unknown.add(importPath, driver.registry)
+			}
+		}
+		if err := unknown.write(unknownPath); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to record unknown imports: %v\n", err)
+		}
 	}
 
 	// Note: we are returning all files required to build a specific package.
 	// For file queries (`file=`), this means that the CompiledGoFiles will
 	// include more than the only file being specified.
-	resp := driver.GetResponse(labels)
-	data, err := json.Marshal(resp)
+	return driver.GetResponse(labels), nil
+}
+
+// buildMissingImports builds the libraries with the given import paths and
+// returns their JSON files. Failures are only logged since they should not
+// prevent loading the requested packages, and libraries that failed to build
+// are left out.
+func buildMissingImports(ctx context.Context, b *BazelJSONBuilder, importPaths []string, mode LoadMode) []string {
+	if len(importPaths) == 0 {
+		return nil
+	}
+	labels, err := b.ImportLabels(ctx, importPaths)
 	if err != nil {
-		return fmt.Errorf("unable to marshal response: %v", err)
+		fmt.Fprintf(os.Stderr, "unable to lookup missing imports: %v\n", err)
+		return nil
 	}
-	_, err = out.Write(data)
-	return err
+	if len(labels) == 0 {
+		return nil
+	}
+	jsonFiles, _, err := b.Build(ctx, labels, mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to build missing imports: %v\n", err)
+		return nil
+	}
+	return jsonFiles
 }
 
 func main() {
 	ctx, cancel := signalContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	if err := run(ctx, os.Stdin, os.Stdout, os.Args[1:]); err != nil {
+	if len(os.Args) == 2 && os.Args[1] == serveFlag {
+		if err := serve(ctx, serverSocket); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	runner := run
+	if serverSocket != "" {
+		// Forward the request to a long-lived driver server.
+		runner = runClient
+	}
+	if err := runner(ctx, os.Stdin, os.Stdout, os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v", err)
 		// gopls will check the packages driver exit code, and if there is an
 		// error, it will fall back to go list. Obviously we don't want that,
@@ -0,0 +1,225 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goModFile holds the directives of a go.mod file that module information is
+// derived from.
+type goModFile struct {
+	path      string
+	module    string
+	goVersion string
+	requires  map[string]string
+}
+
+// moduleResolver completes the module information of packages that the
+// aspect derived from their labels. go.mod files are read at most once.
+type moduleResolver struct {
+	goMods map[string]*goModFile
+	// stamps covers the go.mod files that were looked up, including missing
+	// ones. The resolver is outdated once they change.
+	stamps stampSet
+}
+
+func newModuleResolver() *moduleResolver {
+	return &moduleResolver{goMods: map[string]*goModFile{}, stamps: stampSet{}}
+}
+
+// resolve sets the module path, go.mod file and go version of pkg from the
+// closest go.mod file of its repository. Packages of other repositories get
+// the version their module is required at by the main module. The module is
+// dropped if its path is unknown.
+func (r *moduleResolver) resolve(pkg *FlatPackage) {
+	m := pkg.Module
+	if m == nil || pkg.IsStdlib() {
+		return
+	}
+	if gomod := r.findGoMod(m.Dir, packageSourceDir(pkg)); gomod != nil {
+		if gomod.module != "" {
+			m.Path = gomod.module
+		}
+		m.Dir = filepath.Dir(gomod.path)
+		m.GoMod = gomod.path
+		m.GoVersion = gomod.goVersion
+	}
+	if !m.Main {
+		if root := r.goMod(workspaceRoot); root != nil {
+			m.Version = root.requires[m.Path]
+		}
+	}
+	if m.Path == "" {
+		pkg.Module = nil
+	}
+}
+
+// packageSourceDir returns the directory of the first source file of pkg.
+func packageSourceDir(pkg *FlatPackage) string {
+	for _, files := range [][]string{pkg.GoFiles, pkg.OtherFiles} {
+		if len(files) > 0 {
+			return filepath.Dir(files[0])
+		}
+	}
+	return ""
+}
+
+// findGoMod returns the closest go.mod file to dir, stopping at the root of
+// the repository.
+func (r *moduleResolver) findGoMod(root, dir string) *goModFile {
+	if root == "" {
+		return nil
+	}
+	if rel, err := filepath.Rel(root, dir); dir == "" || err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		dir = root
+	}
+	for {
+		if gomod := r.goMod(dir); gomod != nil {
+			return gomod
+		}
+		if dir == root {
+			return nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// goMod returns the parsed go.mod file in dir, or nil if there is none.
+func (r *moduleResolver) goMod(dir string) *goModFile {
+	if gomod, ok := r.goMods[dir]; ok {
+		return gomod
+	}
+	path := filepath.Join(dir, "go.mod")
+	r.stamps.addFile(path)
+	var gomod *goModFile
+	if data, err := os.ReadFile(path); err == nil {
+		gomod = parseGoMod(path, data)
+	}
+	r.goMods[dir] = gomod
+	return gomod
+}
+
+// parseGoMod parses the module, go and require directives of a go.mod file.
+// Other directives are ignored.
+func parseGoMod(path string, data []byte) *goModFile {
+	gomod := &goModFile{path: path, requires: map[string]string{}}
+	var block string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		for i, f := range fields {
+			if s, err := strconv.Unquote(f); err == nil {
+				fields[i] = s
+			}
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) >= 2 {
+				gomod.module = fields[1]
+			}
+		case "go":
+			if len(fields) >= 2 {
+				gomod.goVersion = fields[1]
+			}
+		case "require":
+			if len(fields) >= 3 {
+				gomod.requires[fields[1]] = fields[2]
+			}
+		}
+	}
+	return gomod
+}
+
+// importRepositories returns the names of the repositories that may provide
+// the given import paths, following the naming of go_repository. These are the
+// repositories of the modules required by gomod that the import paths belong
+// to, or of any of their prefixes without a go.mod file.
+func importRepositories(importPaths []string, gomod *goModFile) []string {
+	repos := map[string]struct{}{}
+	for _, importPath := range importPaths {
+		if !isDomainImportPath(importPath) {
+			continue
+		}
+		var found bool
+		if gomod != nil {
+			for modulePath := range gomod.requires {
+				if importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/") {
+					repos[goRepositoryName(modulePath)] = struct{}{}
+					found = true
+				}
+			}
+		}
+		if found {
+			continue
+		}
+		for i, c := range importPath {
+			if c == '/' {
+				repos[goRepositoryName(importPath[:i])] = struct{}{}
+			}
+		}
+		repos[goRepositoryName(importPath)] = struct{}{}
+	}
+	names := keysFromMap(repos)
+	sort.Strings(names)
+	return names
+}
+
+// isDomainImportPath reports whether an import path starts with a domain name,
+// unlike those of the standard library.
+func isDomainImportPath(importPath string) bool {
+	elem, _, _ := strings.Cut(importPath, "/")
+	return strings.Contains(elem, ".")
+}
+
+// goRepositoryName returns the name that Gazelle gives the repository of a
+// module, like com_github_example_repo for github.com/example/repo.
+func goRepositoryName(modulePath string) string {
+	elems := strings.Split(strings.ToLower(modulePath), "/")
+	domain := strings.Split(elems[0], ".")
+	for i, j := 0, len(domain)-1; i < j; i, j = i+1, j-1 {
+		domain[i], domain[j] = domain[j], domain[i]
+	}
+	name := strings.Join(append(domain, elems[1:]...), "_")
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
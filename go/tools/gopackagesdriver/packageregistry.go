@@ -16,21 +16,30 @@ package main
 
 import (
 	"fmt"
+	"go/build"
 	"os"
+	"sort"
 	"strings"
 )
 
 type PackageRegistry struct {
 	packagesByID map[string]*FlatPackage
 	stdlib       map[string]string
-	bazelVersion bazelVersion
+	// importPaths holds the IDs of the other packages by import path.
+	importPaths map[string][]string
+	// missingImports holds the import paths that could not be resolved by
+	// the ID of the importing package.
+	missingImports map[string][]string
+	bazelVersion   bazelVersion
 }
 
 func NewPackageRegistry(bazelVersion bazelVersion, pkgs ...*FlatPackage) *PackageRegistry {
 	pr := &PackageRegistry{
-		packagesByID: map[string]*FlatPackage{},
-		stdlib:       map[string]string{},
-		bazelVersion: bazelVersion,
+		packagesByID:   map[string]*FlatPackage{},
+		stdlib:         map[string]string{},
+		importPaths:    map[string][]string{},
+		missingImports: map[string][]string{},
+		bazelVersion:   bazelVersion,
 	}
 	pr.Add(pkgs...)
 	return pr
@@ -42,42 +51,171 @@ func (pr *PackageRegistry) Add(pkgs ...*FlatPackage) *PackageRegistry {
 
 		if pkg.IsStdlib() {
 			pr.stdlib[pkg.PkgPath] = pkg.ID
+		} else if ids := pr.importPaths[pkg.PkgPath]; !contains(ids, pkg.ID) {
+			pr.importPaths[pkg.PkgPath] = append(ids, pkg.ID)
 		}
 	}
 	return pr
 }
 
-func (pr *PackageRegistry) ResolvePaths(prf PathResolverFunc) error {
+// AddFailures adds the packages of targets that failed to build. Their errors
+// are added to the packages that were loaded anyway.
+func (pr *PackageRegistry) AddFailures(pkgs ...*FlatPackage) *PackageRegistry {
+	for _, pkg := range pkgs {
+		pkg.ID = pr.labelID(pkg.ID)
+		if loaded, ok := pr.packagesByID[pkg.ID]; ok {
+			loaded.Errors = append(loaded.Errors, pkg.Errors...)
+			continue
+		}
+		pr.Add(pkg)
+	}
+	return pr
+}
+
+func (pr *PackageRegistry) ResolvePaths(prf PathResolverFunc, bctx *build.Context) error {
 	for _, pkg := range pr.packagesByID {
 		pkg.ResolvePaths(prf)
-		pkg.FilterFilesForBuildTags()
+		pkg.FilterFilesForBuildTags(bctx)
 	}
 	return nil
 }
 
+// ResolveModules completes the modules of the packages from their go.mod
+// files.
+func (pr *PackageRegistry) ResolveModules() {
+	modules := newModuleResolver()
+	for _, pkg := range pr.packagesByID {
+		modules.resolve(pkg)
+	}
+}
+
+// Remove removes the packages with the given IDs from the registry.
+func (pr *PackageRegistry) Remove(ids ...string) *PackageRegistry {
+	for _, id := range ids {
+		pkg, ok := pr.packagesByID[id]
+		if !ok {
+			continue
+		}
+		delete(pr.packagesByID, id)
+		delete(pr.missingImports, id)
+
+		if pkg.IsStdlib() {
+			if pr.stdlib[pkg.PkgPath] == id {
+				delete(pr.stdlib, pkg.PkgPath)
+			}
+			continue
+		}
+		var ids []string
+		for _, other := range pr.importPaths[pkg.PkgPath] {
+			if other != id {
+				ids = append(ids, other)
+			}
+		}
+		if len(ids) > 0 {
+			pr.importPaths[pkg.PkgPath] = ids
+		} else {
+			delete(pr.importPaths, pkg.PkgPath)
+		}
+	}
+	return pr
+}
+
+// Clone returns a registry with the same packages, which can be added or
+// removed without affecting pr.
+func (pr *PackageRegistry) Clone() *PackageRegistry {
+	clone := NewPackageRegistry(pr.bazelVersion)
+	for id, pkg := range pr.packagesByID {
+		clone.packagesByID[id] = pkg
+	}
+	for importPath, id := range pr.stdlib {
+		clone.stdlib[importPath] = id
+	}
+	for importPath, ids := range pr.importPaths {
+		clone.importPaths[importPath] = ids
+	}
+	for id, importPaths := range pr.missingImports {
+		clone.missingImports[id] = importPaths
+	}
+	return clone
+}
+
 // ResolveImports adds stdlib imports to packages. This is required because
 // stdlib packages are not part of the JSON file exports as bazel is unaware of
 // them.
 func (pr *PackageRegistry) ResolveImports(overlays map[string][]byte) error {
-	resolve := func(importPath string) string {
+	for _, pkg := range pr.packagesByID {
+		if err := pr.resolveImports(pkg, overlays); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveImports resolves the imports of a single package and adds its
+// external test package, if any, to the registry.
+func (pr *PackageRegistry) resolveImports(pkg *FlatPackage, overlays map[string][]byte) error {
+	delete(pr.missingImports, pkg.ID)
+	resolve := func(importPath string) *FlatPackage {
 		if pkgID, ok := pr.stdlib[importPath]; ok {
-			return pkgID
+			return pr.packagesByID[pkgID]
+		}
+		if imported := pr.lookupImport(importPath); imported != nil {
+			return imported
 		}
 
-		return ""
+		pr.missingImports[pkg.ID] = append(pr.missingImports[pkg.ID], importPath)
+		return nil
 	}
 
-	for _, pkg := range pr.packagesByID {
-		if err := pkg.ResolveImports(resolve, overlays); err != nil {
-			return err
+	if err := pkg.ResolveImports(resolve, overlays); err != nil {
+		return err
+	}
+	testFp := pkg.MoveTestFiles()
+	if testFp != nil {
+		pr.packagesByID[testFp.ID] = testFp
+	}
+	return nil
+}
+
+// lookupImport returns the package with the given import path. Libraries are
+// preferred over tests that embed them.
+func (pr *PackageRegistry) lookupImport(importPath string) *FlatPackage {
+	var found *FlatPackage
+	for _, id := range pr.importPaths[importPath] {
+		pkg := pr.packagesByID[id]
+		if pkg == nil {
+			continue
 		}
-		testFp := pkg.MoveTestFiles()
-		if testFp != nil {
-			pr.packagesByID[testFp.ID] = testFp
+		if found == nil || hasTestFiles(found) && !hasTestFiles(pkg) ||
+			hasTestFiles(found) == hasTestFiles(pkg) && pkg.ID < found.ID {
+			found = pkg
 		}
 	}
+	return found
+}
 
-	return nil
+func hasTestFiles(pkg *FlatPackage) bool {
+	for _, f := range pkg.GoFiles {
+		if strings.HasSuffix(f, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingImports returns the import paths that could not be resolved to any
+// package in the registry.
+func (pr *PackageRegistry) MissingImports() []string {
+	seen := map[string]struct{}{}
+	for _, importPaths := range pr.missingImports {
+		for _, importPath := range importPaths {
+			seen[importPath] = struct{}{}
+		}
+	}
+	missing := keysFromMap(seen)
+	sort.Strings(missing)
+	return missing
 }
 
 func (pr *PackageRegistry) walk(acc map[string]*FlatPackage, root string) {
@@ -96,16 +234,23 @@ func (pr *PackageRegistry) walk(acc map[string]*FlatPackage, root string) {
 	}
 }
 
+// labelID returns the ID of the package built by the target with the given
+// label.
+func (pr *PackageRegistry) labelID(label string) string {
+	// When packagesdriver is ran from rules go, rulesGoRepositoryName will just be @
+	if pr.bazelVersion.isAtLeast(bazelVersion{6, 0, 0}) &&
+		!strings.HasPrefix(label, "@") {
+		// Canonical labels is only since Bazel 6.0.0
+		label = fmt.Sprintf("@%s", label)
+	}
+	return label
+}
+
 func (pr *PackageRegistry) Match(labels []string) ([]string, []*FlatPackage) {
 	roots := map[string]struct{}{}
 
 	for _, label := range labels {
-		// When packagesdriver is ran from rules go, rulesGoRepositoryName will just be @
-		if pr.bazelVersion.isAtLeast(bazelVersion{6, 0, 0}) &&
-			!strings.HasPrefix(label, "@") {
-			// Canonical labels is only since Bazel 6.0.0
-			label = fmt.Sprintf("@%s", label)
-		}
+		label = pr.labelID(label)
 
 		if label == RulesGoStdlibLabel {
 			// For stdlib, we need to append all the subpackages as roots
@@ -0,0 +1,665 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveFlag makes the driver run as a server listening on the socket set in
+// GOPACKAGESDRIVER_SERVER. Drivers start it on demand.
+const serveFlag = "-serve"
+
+// serverRequest is sent by a driver to the server for each request of
+// go/packages.
+type serverRequest struct {
+	Settings         driverSettings
+	WorkingDirectory string
+	Args             []string
+	Request          *DriverRequest
+}
+
+type serverResponse struct {
+	Error    string          `json:",omitempty"`
+	Response json.RawMessage `json:",omitempty"`
+	// Rejected is set if the server runs with other settings than the
+	// driver, which then loads the packages without it.
+	Rejected bool `json:",omitempty"`
+}
+
+// driverSettings holds the workspace and the Bazel settings of a driver,
+// which the server only shares with the driver that started it.
+type driverSettings struct {
+	WorkspaceRoot     string
+	BazelBin          string
+	StartupFlags      []string
+	CommonFlags       []string
+	QueryFlags        []string
+	QueryScope        string
+	BuildFlags        []string
+	AdditionalAspects []string
+	AdditionalKinds   []string
+}
+
+func currentSettings() driverSettings {
+	return driverSettings{
+		WorkspaceRoot:     workspaceRoot,
+		BazelBin:          bazelBin,
+		StartupFlags:      bazelStartupFlags,
+		CommonFlags:       bazelCommonFlags,
+		QueryFlags:        bazelQueryFlags,
+		QueryScope:        bazelQueryScope,
+		BuildFlags:        bazelBuildFlags,
+		AdditionalAspects: additionalAspects,
+		AdditionalKinds:   additionalKinds,
+	}
+}
+
+// errSettings is returned for requests of drivers with other settings than
+// the server.
+var errSettings = errors.New("driver server is running with other settings")
+
+// cachedQuery holds the labels matching the patterns of a request.
+type cachedQuery struct {
+	labels []string
+	// stamps covers the BUILD files that determine which targets match.
+	stamps stampSet
+}
+
+// cachedPackage holds a package read from a .pkg.json file.
+type cachedPackage struct {
+	// pkg is the package as read from the file, with resolved paths. It is
+	// never modified: the registry holds copies with resolved imports.
+	pkg *FlatPackage
+	// build stamps the BUILD files of the package and the directories of its
+	// sources. The package has to be built again when they change.
+	build stampSet
+	// srcs stamps the sources the imports of the package were resolved from.
+	srcs stampSet
+	// exportFile is set once the export file of the package has been built.
+	exportFile bool
+	// errors holds the errors of the last build of the package if it
+	// failed. The package is built again until it succeeds.
+	errors []FlatPackagesError
+}
+
+// clone returns a copy of the cached package with its module and build
+// errors, to resolve the imports of.
+func (c *cachedPackage) clone(modules *moduleResolver) *FlatPackage {
+	pkg := c.pkg.Clone()
+	modules.resolve(pkg)
+	pkg.Errors = append(pkg.Errors, c.errors...)
+	return pkg
+}
+
+// cachedJSONFile records the packages read from a .pkg.json file.
+type cachedJSONFile struct {
+	stamp string
+	ids   []string
+}
+
+// driverServer answers driver requests from the packages it keeps in memory.
+// Bazel is only invoked for packages that are missing or whose BUILD files
+// or source directories changed. Changed sources only have their imports
+// resolved again.
+type driverServer struct {
+	// busy holds the request being served. Requests are served one at a time.
+	busy      chan struct{}
+	bazel     *Bazel
+	registry  *PackageRegistry
+	packages  map[string]*cachedPackage
+	jsonFiles map[string]*cachedJSONFile
+	queries   map[string]*cachedQuery
+	// modules holds the go.mod files that the modules of packages are
+	// resolved from.
+	modules *moduleResolver
+	// config identifies the build flags the packages were built with.
+	config string
+
+	// unknownImports holds the import paths that no library was found for.
+	// They are looked up again once the sources importing them change.
+	unknownImports map[string]bool
+}
+
+func newDriverServer() *driverServer {
+	return &driverServer{
+		busy:           make(chan struct{}, 1),
+		packages:       map[string]*cachedPackage{},
+		jsonFiles:      map[string]*cachedJSONFile{},
+		queries:        map[string]*cachedQuery{},
+		modules:        newModuleResolver(),
+		unknownImports: map[string]bool{},
+	}
+}
+
+func (s *driverServer) handle(ctx context.Context, req *serverRequest) (*driverResponse, error) {
+	// Requests cancelled while waiting for others are not served.
+	select {
+	case s.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.busy }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Empty and missing flags are the same.
+	if settings := currentSettings(); fmt.Sprintf("%q", req.Settings) != fmt.Sprintf("%q", settings) {
+		return nil, fmt.Errorf("%w: %+q, not %+q", errSettings, settings, req.Settings)
+	}
+	if s.bazel == nil {
+		bazel, err := NewBazel(ctx, bazelBin, workspaceRoot, buildWorkingDirectory, bazelCommonFlags, bazelStartupFlags)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create bazel instance: %w", err)
+		}
+		s.bazel = bazel
+		s.registry = NewPackageRegistry(bazel.version)
+	}
+
+	bazelJsonBuilder, err := NewBazelJSONBuilder(s.bazel.WithBuildWorkingDirectory(req.WorkingDirectory), req.Request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build JSON files: %w", err)
+	}
+	if config := fmt.Sprintf("%q", bazelJsonBuilder.config.bazelFlags); config != s.config {
+		// The packages are built and filtered differently, so start over.
+		s.config = config
+		s.registry = NewPackageRegistry(s.bazel.version)
+		s.packages = map[string]*cachedPackage{}
+		s.jsonFiles = map[string]*cachedJSONFile{}
+		s.unknownImports = map[string]bool{}
+	}
+	if s.modules.stamps.changed() {
+		// Any package may belong to another module now, such as when a
+		// go.mod file was added to its directory, so they are all resolved
+		// again.
+		s.modules = newModuleResolver()
+		for _, cached := range s.packages {
+			if err := s.resolve(cached); err != nil {
+				return nil, fmt.Errorf("unable to resolve imports: %w", err)
+			}
+		}
+	}
+
+	labels, err := s.labels(ctx, bazelJsonBuilder, req.Request.Tests, req.WorkingDirectory, req.Args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lookup package: %w", err)
+	}
+
+	exportFile := req.Request.Mode&NeedExportsFile != 0
+	stale, err := s.refresh(labels, exportFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve imports: %w", err)
+	}
+	if len(stale) > 0 {
+		jsonFiles, failures, err := bazelJsonBuilder.Build(ctx, stale, req.Request.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build JSON files: %w", err)
+		}
+		if err := s.update(jsonFiles, bazelJsonBuilder.PathResolver(), bazelJsonBuilder.BuildContext(), exportFile); err != nil {
+			return nil, fmt.Errorf("unable to load JSON files: %w", err)
+		}
+		if err := s.addFailures(failures, bazelJsonBuilder.BuildContext()); err != nil {
+			return nil, fmt.Errorf("unable to resolve imports: %w", err)
+		}
+	}
+
+	registry, err := s.overlaid(req.Request.Overlay)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve imports: %w", err)
+	}
+	var missing []string
+	for _, importPath := range registry.MissingImports() {
+		if !s.unknownImports[importPath] {
+			missing = append(missing, importPath)
+		}
+	}
+	if len(missing) > 0 {
+		// Imports may have been added before the deps in BUILD files. Load
+		// their packages too, so that they resolve.
+		if jsonFiles := buildMissingImports(ctx, bazelJsonBuilder, missing, req.Request.Mode); len(jsonFiles) > 0 {
+			if err := s.update(jsonFiles, bazelJsonBuilder.PathResolver(), bazelJsonBuilder.BuildContext(), exportFile); err != nil {
+				return nil, fmt.Errorf("unable to load JSON files: %w", err)
+			}
+			for id := range s.registry.missingImports {
+				if cached, ok := s.packages[id]; ok {
+					if err := s.resolve(cached); err != nil {
+						return nil, fmt.Errorf("unable to resolve imports: %w", err)
+					}
+				}
+			}
+			if registry, err = s.overlaid(req.Request.Overlay); err != nil {
+				return nil, fmt.Errorf("unable to resolve imports: %w", err)
+			}
+		}
+		stillMissing := registry.MissingImports()
+		for _, importPath := range missing {
+			if contains(stillMissing, importPath) {
+				s.unknownImports[importPath] = true
+			}
+		}
+	}
+	driver := &JSONPackagesDriver{registry: registry}
+	return driver.GetResponse(labels), nil
+}
+
+// labels returns the labels of the targets matching patterns, only querying
+// Bazel if they are not cached or the BUILD files they came from changed.
+func (s *driverServer) labels(ctx context.Context, b *BazelJSONBuilder, tests bool, wd string, patterns []string) ([]string, error) {
+	key := fmt.Sprintf("%t %s %q", tests, wd, patterns)
+	if q, ok := s.queries[key]; ok && !q.stamps.changed() {
+		return q.labels, nil
+	}
+	delete(s.queries, key)
+
+	// Stamp the BUILD files before querying, so that changes made during the
+	// query invalidate its result.
+	stamps := queryStamps(b, patterns)
+	labels, err := b.Labels(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		if dir, ok := packageDir(label); ok {
+			stamps.addBuildFiles(dir)
+		}
+	}
+	s.queries[key] = &cachedQuery{labels: labels, stamps: stamps}
+	return labels, nil
+}
+
+// refresh brings the packages reachable from labels up to date with their
+// sources, and returns the labels that have to be built again because one of
+// these packages is missing or its BUILD files changed.
+func (s *driverServer) refresh(labels []string, exportFile bool) ([]string, error) {
+	var stale []string
+	checked := map[string]bool{}
+	for _, label := range labels {
+		id := s.registry.labelID(label)
+		if id == RulesGoStdlibLabel {
+			if len(s.registry.stdlib) == 0 {
+				stale = append(stale, label)
+			}
+			continue
+		}
+		isStale, err := s.check(id, exportFile, checked)
+		if err != nil {
+			return nil, err
+		}
+		if isStale {
+			stale = append(stale, label)
+		}
+	}
+	return stale, nil
+}
+
+func (s *driverServer) check(id string, exportFile bool, checked map[string]bool) (bool, error) {
+	if stale, ok := checked[id]; ok {
+		return stale, nil
+	}
+	checked[id] = false
+
+	cached, ok := s.packages[id]
+	pkg := s.registry.packagesByID[id]
+	stale := !ok || pkg == nil || len(cached.errors) > 0 || cached.build.changed() || exportFile && !cached.exportFile
+	if !stale && cached.srcs.changed() {
+		if exportFile {
+			// The export file has to be compiled from the new sources.
+			stale = true
+		} else {
+			s.forgetUnknownImports(id)
+			if err := s.resolve(cached); err != nil {
+				return false, err
+			}
+			pkg = s.registry.packagesByID[id]
+		}
+	}
+	if !stale {
+		for _, dep := range pkg.Imports {
+			depStale, err := s.check(dep, exportFile, checked)
+			if err != nil {
+				return false, err
+			}
+			stale = stale || depStale
+		}
+	}
+	checked[id] = stale
+	return stale, nil
+}
+
+// update reads the .pkg.json files that changed since they were last read,
+// and restamps the packages of the others.
+func (s *driverServer) update(jsonFiles []string, prf PathResolverFunc, bctx *build.Context, exportFile bool) error {
+	var resolve []*cachedPackage
+	for _, jsonFile := range jsonFiles {
+		st := fileStamp(jsonFile)
+		if cachedFile, ok := s.jsonFiles[jsonFile]; ok {
+			if cachedFile.stamp == st {
+				for _, id := range cachedFile.ids {
+					cached := s.packages[id]
+					cached.build = buildStamps(cached.pkg)
+					cached.exportFile = cached.exportFile || exportFile
+					if len(cached.errors) > 0 || cached.srcs.changed() {
+						cached.errors = nil
+						resolve = append(resolve, cached)
+					}
+				}
+				continue
+			}
+			for _, id := range cachedFile.ids {
+				delete(s.packages, id)
+				s.registry.Remove(id, id+"_xtest")
+			}
+		}
+
+		cachedFile := &cachedJSONFile{stamp: st}
+		if err := WalkFlatPackagesFromJSON(jsonFile, func(pkg *FlatPackage) {
+			pkg.ResolvePaths(prf)
+			pkg.FilterFilesForBuildTags(bctx)
+			cached := &cachedPackage{
+				pkg:        pkg,
+				build:      buildStamps(pkg),
+				exportFile: exportFile,
+			}
+			s.packages[pkg.ID] = cached
+			cachedFile.ids = append(cachedFile.ids, pkg.ID)
+			resolve = append(resolve, cached)
+		}); err != nil {
+			return fmt.Errorf("unable to walk json: %w", err)
+		}
+		s.jsonFiles[jsonFile] = cachedFile
+	}
+
+	// Imports are resolved to other packages, so they all have to be
+	// registered first. The cached packages are only replaced by resolved
+	// copies.
+	for _, cached := range resolve {
+		s.forgetUnknownImports(cached.pkg.ID)
+		s.registry.Remove(cached.pkg.ID, cached.pkg.ID+"_xtest").Add(cached.pkg)
+	}
+	for _, cached := range resolve {
+		if err := s.resolve(cached); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFailures registers the packages of targets that failed to build, or
+// adds their errors to the cached packages of the targets.
+func (s *driverServer) addFailures(failures []*FlatPackage, bctx *build.Context) error {
+	for _, failure := range failures {
+		failure.ID = s.registry.labelID(failure.ID)
+		cached, ok := s.packages[failure.ID]
+		if !ok {
+			pkg := failure.Clone()
+			pkg.Errors = nil
+			pkg.FilterFilesForBuildTags(bctx)
+			cached = &cachedPackage{pkg: pkg, build: buildStamps(pkg)}
+			s.packages[pkg.ID] = cached
+		}
+		cached.errors = failure.Errors
+		if err := s.resolve(cached); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetUnknownImports makes the imports of a package that no library was
+// found for be looked up again.
+func (s *driverServer) forgetUnknownImports(id string) {
+	for _, importPath := range s.registry.missingImports[id] {
+		delete(s.unknownImports, importPath)
+	}
+}
+
+// resolve replaces the package in the registry with a copy of the cached
+// package whose imports are resolved from its current sources.
+func (s *driverServer) resolve(cached *cachedPackage) error {
+	pkg := cached.clone(s.modules)
+	cached.srcs = sourceStamps(pkg)
+	s.registry.Remove(pkg.ID, pkg.ID+"_xtest").Add(pkg)
+	return s.registry.resolveImports(pkg, nil)
+}
+
+// overlaid returns a registry in which the imports of the packages with
+// overlaid files are resolved from the overlays.
+func (s *driverServer) overlaid(overlays map[string][]byte) (*PackageRegistry, error) {
+	registry := s.registry
+	if len(overlays) == 0 {
+		return registry, nil
+	}
+	for _, cached := range s.packages {
+		if !hasOverlay(cached.pkg, overlays) {
+			continue
+		}
+		if registry == s.registry {
+			registry = s.registry.Clone()
+		}
+		pkg := cached.clone(s.modules)
+		registry.Remove(pkg.ID, pkg.ID+"_xtest").Add(pkg)
+		if err := registry.resolveImports(pkg, overlays); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func hasOverlay(pkg *FlatPackage, overlays map[string][]byte) bool {
+	for _, f := range pkg.CompiledGoFiles {
+		if _, ok := overlays[f]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// queryStamps stamps the BUILD files that determine which targets match
+// patterns.
+func queryStamps(b *BazelJSONBuilder, patterns []string) stampSet {
+	stamps := stampSet{}
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasSuffix(pattern, ".go"):
+			// The file belongs to a target in the closest package above it.
+			dir := filepath.Dir(workspacePath(b, strings.TrimPrefix(pattern, "file=")))
+			for {
+				stamps.addBuildFiles(dir)
+				if !strings.HasPrefix(dir, workspaceRoot) || dir == workspaceRoot || dir == filepath.Dir(dir) {
+					break
+				}
+				dir = filepath.Dir(dir)
+			}
+		case isLocalPattern(pattern) && strings.HasSuffix(pattern, "..."):
+			stamps.addBuildFileTree(workspacePath(b, strings.TrimSuffix(pattern, "...")))
+		case isLocalPattern(pattern):
+			stamps.addBuildFiles(workspacePath(b, pattern))
+		}
+	}
+	return stamps
+}
+
+// buildStamps stamps the files that the .pkg.json file of a package is
+// generated from.
+func buildStamps(pkg *FlatPackage) stampSet {
+	stamps := stampSet{}
+	if dir, ok := packageDir(pkg.ID); ok {
+		stamps.addBuildFiles(dir)
+	}
+	if pkg.IsStdlib() {
+		return stamps
+	}
+	// Sources may be globbed, so adding or removing a file in one of their
+	// directories may change the package.
+	for _, files := range [][]string{pkg.GoFiles, pkg.CompiledGoFiles, pkg.OtherFiles} {
+		for _, f := range files {
+			if strings.HasPrefix(f, workspaceRoot+string(filepath.Separator)) {
+				stamps.addDir(filepath.Dir(f))
+			}
+		}
+	}
+	return stamps
+}
+
+// sourceStamps stamps the sources that the imports of a package are resolved
+// from. Its module is resolved again whenever go.mod files change.
+func sourceStamps(pkg *FlatPackage) stampSet {
+	stamps := stampSet{}
+	if pkg.IsStdlib() {
+		return stamps
+	}
+	for _, files := range [][]string{pkg.GoFiles, pkg.CompiledGoFiles} {
+		for _, f := range files {
+			stamps.addFile(f)
+		}
+	}
+	return stamps
+}
+
+// packageDir returns the directory of the package of a label in the main
+// repository.
+func packageDir(label string) (string, bool) {
+	label = strings.TrimLeft(label, "@")
+	if !strings.HasPrefix(label, "//") {
+		return "", false
+	}
+	pkg, _, _ := strings.Cut(strings.TrimPrefix(label, "//"), ":")
+	return filepath.Join(workspaceRoot, filepath.FromSlash(pkg)), true
+}
+
+func workspacePath(b *BazelJSONBuilder, request string) string {
+	return ensureAbsolutePathFromWorkspace(filepath.FromSlash(b.adjustToRelativePathIfPossible(request)))
+}
+
+// serve answers the requests of drivers on a unix socket until it has not
+// received any for serverIdleTimeout.
+func serve(ctx context.Context, socket string) error {
+	if socket == "" {
+		return errors.New("GOPACKAGESDRIVER_SERVER must be set to the socket to listen on")
+	}
+	idleTimeout, err := time.ParseDuration(serverIdleTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid GOPACKAGESDRIVER_SERVER_IDLE_TIMEOUT: %w", err)
+	}
+	ln, err := listen(socket)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Fprintln(os.Stderr, "Listening on", socket)
+
+	idle := time.AfterFunc(idleTimeout, func() { ln.Close() })
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	s := newDriverServer()
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		active int
+	)
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("unable to accept connection: %w", err)
+		}
+
+		mu.Lock()
+		active++
+		idle.Stop()
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+
+			mu.Lock()
+			active--
+			if active == 0 {
+				idle.Reset(idleTimeout)
+			}
+			mu.Unlock()
+		}()
+	}
+}
+
+func (s *driverServer) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	var resp serverResponse
+	var req serverRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("unable to decode request: %v", err)
+	} else if driverResp, err := s.handle(connContext(ctx, conn), &req); err != nil {
+		resp.Error = err.Error()
+		resp.Rejected = errors.Is(err, errSettings)
+	} else if resp.Response, err = json.Marshal(driverResp); err != nil {
+		resp.Error = fmt.Sprintf("unable to marshal response: %v", err)
+	}
+	if err := json.NewEncoder(conn).Encode(&resp); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to send response: %v\n", err)
+	}
+}
+
+// connContext returns a context that is cancelled once the driver closes conn,
+// which it does when its request is cancelled. Nothing else is read from conn
+// after the request.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		io.Copy(io.Discard, conn)
+	}()
+	return ctx
+}
+
+// listen listens on socket, replacing the socket of a server that did not
+// shut down cleanly.
+func listen(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create socket directory: %w", err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err == nil {
+		return ln, nil
+	}
+	if conn, dialErr := net.Dial("unix", socket); dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a server is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", socket, err)
+	}
+	return net.Listen("unix", socket)
+}
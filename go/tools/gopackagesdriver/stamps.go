@@ -0,0 +1,114 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stamp records the state of a file or a directory at the time a cached
+// result was computed from it. Stamps are exported to be recorded by drivers
+// that run without a server.
+type stamp struct {
+	Dir   bool `json:",omitempty"`
+	Value string
+}
+
+// stampSet holds the stamps of all files and directories a cached result
+// depends on, by path.
+type stampSet map[string]stamp
+
+func newStamp(path string, dir bool) stamp {
+	if dir {
+		return stamp{Dir: true, Value: dirStamp(path)}
+	}
+	return stamp{Value: fileStamp(path)}
+}
+
+// fileStamp identifies the contents of a file by its size and modification
+// time. It is empty if the file does not exist.
+func fileStamp(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d %d", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// dirStamp identifies the Go files in a directory by their names, so that it
+// only changes when sources are added or removed.
+func dirStamp(path string) string {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n")
+}
+
+func (s stampSet) addFile(path string) {
+	if _, ok := s[path]; !ok {
+		s[path] = newStamp(path, false)
+	}
+}
+
+func (s stampSet) addDir(path string) {
+	if _, ok := s[path]; !ok {
+		s[path] = newStamp(path, true)
+	}
+}
+
+// addBuildFiles stamps the BUILD files that may define a package in dir,
+// including ones that do not exist yet.
+func (s stampSet) addBuildFiles(dir string) {
+	s.addFile(filepath.Join(dir, "BUILD.bazel"))
+	s.addFile(filepath.Join(dir, "BUILD"))
+}
+
+// addBuildFileTree stamps the BUILD files of all packages below dir.
+func (s stampSet) addBuildFileTree(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); path != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "bazel-")) {
+			return filepath.SkipDir
+		}
+		s.addBuildFiles(path)
+		return nil
+	})
+}
+
+// changed reports whether any of the files or directories have changed
+// since they were stamped.
+func (s stampSet) changed() bool {
+	for path, st := range s {
+		if newStamp(path, st.Dir) != st {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// unknownImportsFile is the file in the output base in which drivers running
+// without a server record the imports that no library was found for, like
+// the server does in memory.
+const unknownImportsFile = "gopackagesdriver_unknown_imports.json"
+
+// unknownImports maps the imports that no library was found for to the
+// sources importing them. They are looked up again once the sources change.
+type unknownImports map[string]stampSet
+
+// readUnknownImports reads the unknown imports recorded in path whose sources
+// did not change.
+func readUnknownImports(path string) unknownImports {
+	unknown := unknownImports{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &unknown); err != nil {
+			return unknownImports{}
+		}
+	}
+	for importPath, stamps := range unknown {
+		if len(stamps) == 0 || stamps.changed() {
+			delete(unknown, importPath)
+		}
+	}
+	return unknown
+}
+
+// add records that no library was found for importPath, with the sources of
+// the packages of registry that import it.
+func (u unknownImports) add(importPath string, registry *PackageRegistry) {
+	stamps := stampSet{}
+	for id, importPaths := range registry.missingImports {
+		pkg := registry.packagesByID[id]
+		if pkg == nil || !contains(importPaths, importPath) {
+			continue
+		}
+		for path, st := range sourceStamps(pkg) {
+			stamps[path] = st
+		}
+	}
+	u[importPath] = stamps
+}
+
+func (u unknownImports) write(path string) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
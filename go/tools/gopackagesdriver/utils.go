@@ -22,6 +22,7 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
 func getenvDefault(key, defaultValue string) string {
@@ -76,6 +77,15 @@ func packageID(pattern string) string {
 	return fmt.Sprintf("//%s", pattern)
 }
 
+// targetLabel returns the label of a target as it is written in the BUILD
+// files of the main repository.
+func targetLabel(id string) string {
+	if label := strings.TrimLeft(id, "@"); strings.HasPrefix(label, "//") {
+		return label
+	}
+	return id
+}
+
 func findPackageByID(packages []*FlatPackage, id string) *FlatPackage {
 	for _, pkg := range packages {
 		if pkg.ID == id {
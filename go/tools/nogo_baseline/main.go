@@ -0,0 +1,276 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nogo_baseline creates or updates a nogo baseline file from the JSON findings
+// written by nogo.
+//
+// Build the findings with --output_groups=nogo_findings and pass the findings
+// files, or directories containing them such as bazel-bin, to this tool:
+//
+//	bazel build --norun_validations --output_groups=nogo_findings //...
+//	bazel run @io_bazel_rules_go//go/tools/nogo_baseline -- -baseline nogo_baseline.json $(bazel info bazel-bin)
+//
+// Findings in the analyzed packages are added to the baseline and entries that
+// no longer match a finding are removed. Entries for files that were not
+// analyzed are kept as is. With -check, the baseline file is not modified and
+// the tool fails if it is out of date.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// findingsSuffix is the extension of the JSON findings files declared by the
+// Go rules.
+const findingsSuffix = ".nogo.json"
+
+// The subset of the JSON findings format and the baseline format of nogo used
+// by this tool, see go/tools/builders/nogo_findings.go and
+// go/tools/builders/nogo_baseline.go.
+type findingsFile struct {
+	Findings []struct {
+		Analyzer string `json:"analyzer"`
+		Range    struct {
+			File string `json:"file"`
+		} `json:"range"`
+		Message     string `json:"message"`
+		Fingerprint string `json:"fingerprint"`
+	} `json:"findings"`
+	StaleBaseline []baselineEntry `json:"stale_baseline"`
+}
+
+type baselineFile struct {
+	Entries []baselineEntry `json:"entries"`
+}
+
+type baselineEntry struct {
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Fingerprint string `json:"fingerprint"`
+	Message     string `json:"message,omitempty"`
+	Count       int    `json:"count"`
+}
+
+type entryKey struct {
+	analyzer, file, fingerprint string
+}
+
+func (e baselineEntry) key() entryKey {
+	return entryKey{e.Analyzer, e.File, e.Fingerprint}
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nogo_baseline: ")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("nogo_baseline", flag.ExitOnError)
+	baselinePath := flags.String("baseline", "", "The baseline file to create or update, relative to the working directory")
+	check := flags.Bool("check", false, "Don't modify the baseline file, but fail if it is out of date")
+	flags.Parse(args)
+	if *baselinePath == "" || flags.NArg() == 0 {
+		return errors.New("usage: nogo_baseline [-check] -baseline <file> <findings file or directory>...")
+	}
+	wd := os.Getenv("BUILD_WORKING_DIRECTORY")
+	resolve := func(path string) string {
+		if !filepath.IsAbs(path) && wd != "" {
+			return filepath.Join(wd, path)
+		}
+		return path
+	}
+
+	var old []baselineEntry
+	if content, err := os.ReadFile(resolve(*baselinePath)); err == nil {
+		var baseline baselineFile
+		if err := json.Unmarshal(content, &baseline); err != nil {
+			return fmt.Errorf("%s: %v", *baselinePath, err)
+		}
+		old = baseline.Entries
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var findings []findingsFile
+	for _, arg := range flags.Args() {
+		paths, err := findFindings(resolve(arg))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var f findingsFile
+			if err := json.Unmarshal(content, &f); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	updated, added, removed := updateBaseline(old, findings)
+	for _, e := range added {
+		fmt.Printf("new: %s: %s (%s) x%d\n", e.File, e.Message, e.Analyzer, e.Count)
+	}
+	for _, e := range removed {
+		fmt.Printf("stale: %s: %s (%s) x%d\n", e.File, e.Message, e.Analyzer, e.Count)
+	}
+	if *check {
+		if len(added) > 0 || len(removed) > 0 {
+			return fmt.Errorf("%s is out of date: %d new and %d stale entries", *baselinePath, len(added), len(removed))
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(baselineFile{Entries: updated}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(resolve(*baselinePath), append(content, '\n'), 0o666); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s with %d entries\n", *baselinePath, len(updated))
+	return nil
+}
+
+// findFindings returns the findings files at or below path.
+func findFindings(path string) ([]string, error) {
+	// bazel-bin and friends are usually symlinks, which filepath.WalkDir does not
+	// follow.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (p != path && !strings.HasSuffix(p, findingsSuffix)) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+// updateBaseline returns the baseline that matches the given findings as well
+// as the entries whose counts were increased and decreased, respectively, with
+// Count set to the difference.
+//
+// A findings file covers the entries that it has findings or stale entries for.
+// Since a file may be analyzed as part of several packages, for example when a
+// library is also compiled as part of a go_test, the count of an entry is the
+// maximum of the counts in all findings files that cover it. Entries not
+// covered by any findings file are kept.
+func updateBaseline(old []baselineEntry, findings []findingsFile) (updated, added, removed []baselineEntry) {
+	counts := make(map[entryKey]int)
+	messages := make(map[entryKey]string)
+	for _, e := range old {
+		counts[e.key()] += e.Count
+		if e.Message != "" {
+			messages[e.key()] = e.Message
+		}
+	}
+
+	covered := make(map[entryKey]int)
+	for _, f := range findings {
+		fileCounts := make(map[entryKey]int)
+		// Stale entries are covered even though they have no findings.
+		for _, e := range f.StaleBaseline {
+			fileCounts[e.key()] = 0
+		}
+		for _, finding := range f.Findings {
+			if finding.Range.File == "" || finding.Fingerprint == "" {
+				// Findings without a position can't be baselined.
+				continue
+			}
+			key := entryKey{finding.Analyzer, finding.Range.File, finding.Fingerprint}
+			fileCounts[key]++
+			if _, ok := messages[key]; !ok {
+				messages[key] = finding.Message
+			}
+		}
+		for key, n := range fileCounts {
+			if prev, ok := covered[key]; !ok || n > prev {
+				covered[key] = n
+			}
+		}
+	}
+
+	for key, n := range covered {
+		diff := n - counts[key]
+		e := baselineEntry{
+			Analyzer:    key.analyzer,
+			File:        key.file,
+			Fingerprint: key.fingerprint,
+			Message:     messages[key],
+		}
+		if diff > 0 {
+			e.Count = diff
+			added = append(added, e)
+		} else if diff < 0 {
+			e.Count = -diff
+			removed = append(removed, e)
+		}
+		counts[key] = n
+	}
+
+	for key, n := range counts {
+		if n == 0 {
+			continue
+		}
+		updated = append(updated, baselineEntry{
+			Analyzer:    key.analyzer,
+			File:        key.file,
+			Fingerprint: key.fingerprint,
+			Message:     messages[key],
+			Count:       n,
+		})
+	}
+	sortEntries(updated)
+	sortEntries(added)
+	sortEntries(removed)
+	if updated == nil {
+		updated = []baselineEntry{}
+	}
+	return updated, added, removed
+}
+
+func sortEntries(entries []baselineEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Analyzer != b.Analyzer {
+			return a.Analyzer < b.Analyzer
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateBaseline(t *testing.T) {
+	old := []baselineEntry{
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "1", Message: "fixed", Count: 1},
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "2", Message: "partially fixed", Count: 3},
+		{Analyzer: "bools", File: "b/b.go", Fingerprint: "3", Message: "not analyzed", Count: 1},
+	}
+	// a/a.go is analyzed both as part of the library and its test.
+	lib := `{
+  "package": "a",
+  "findings": [
+    {"analyzer": "bools", "range": {"file": "a/a.go"}, "message": "partially fixed", "fingerprint": "2", "baselined": true},
+    {"analyzer": "bools", "range": {"file": "a/a.go"}, "message": "new", "fingerprint": "4"},
+    {"analyzer": "nilness", "message": "no position", "fingerprint": "5"}
+  ],
+  "stale_baseline": [
+    {"analyzer": "bools", "file": "a/a.go", "fingerprint": "1", "count": 1},
+    {"analyzer": "bools", "file": "a/a.go", "fingerprint": "2", "count": 2}
+  ]
+}`
+	test := `{
+  "package": "a",
+  "findings": [
+    {"analyzer": "bools", "range": {"file": "a/a.go"}, "message": "partially fixed", "fingerprint": "2", "baselined": true},
+    {"analyzer": "bools", "range": {"file": "a/a.go"}, "message": "new", "fingerprint": "4"},
+    {"analyzer": "bools", "range": {"file": "a/a_test.go"}, "message": "new in test", "fingerprint": "6"}
+  ],
+  "stale_baseline": [
+    {"analyzer": "bools", "file": "a/a.go", "fingerprint": "1", "count": 1},
+    {"analyzer": "bools", "file": "a/a.go", "fingerprint": "2", "count": 2}
+  ]
+}`
+	var findings []findingsFile
+	for _, content := range []string{lib, test} {
+		var f findingsFile
+		if err := json.Unmarshal([]byte(content), &f); err != nil {
+			t.Fatal(err)
+		}
+		findings = append(findings, f)
+	}
+
+	updated, added, removed := updateBaseline(old, findings)
+	wantUpdated := []baselineEntry{
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "2", Message: "partially fixed", Count: 1},
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "4", Message: "new", Count: 1},
+		{Analyzer: "bools", File: "a/a_test.go", Fingerprint: "6", Message: "new in test", Count: 1},
+		{Analyzer: "bools", File: "b/b.go", Fingerprint: "3", Message: "not analyzed", Count: 1},
+	}
+	wantAdded := []baselineEntry{
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "4", Message: "new", Count: 1},
+		{Analyzer: "bools", File: "a/a_test.go", Fingerprint: "6", Message: "new in test", Count: 1},
+	}
+	wantRemoved := []baselineEntry{
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "1", Message: "fixed", Count: 1},
+		{Analyzer: "bools", File: "a/a.go", Fingerprint: "2", Message: "partially fixed", Count: 2},
+	}
+	if !reflect.DeepEqual(updated, wantUpdated) {
+		t.Errorf("got updated baseline %#v, want %#v", updated, wantUpdated)
+	}
+	if !reflect.DeepEqual(added, wantAdded) {
+		t.Errorf("got added entries %#v, want %#v", added, wantAdded)
+	}
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("got removed entries %#v, want %#v", removed, wantRemoved)
+	}
+
+	// Updating the baseline with the same findings is a no-op.
+	if again, added, removed := updateBaseline(updated, findings); !reflect.DeepEqual(again, updated) || added != nil || removed != nil {
+		t.Errorf("second update changed the baseline: %#v, added %#v, removed %#v", again, added, removed)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nogo_fix applies the suggested fixes collected by nogo to the workspace.
+//
+// Build the patches with --output_groups=nogo_fix and pass the patch files, or
+// directories containing them such as bazel-bin, to this tool:
+//
+//	bazel build --output_groups=nogo_fix //...
+//	bazel run @io_bazel_rules_go//go/tools/nogo_fix -- $(bazel info bazel-bin)
+//
+// All patches are expected to have been generated against the current state of
+// the workspace. The same fix may be contained in several patches, for example
+// when a library is also compiled as part of a go_test, and is applied once.
+// Conflicting changes are skipped with a warning.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patchSuffix is the extension of the patch files declared by the Go rules.
+const patchSuffix = ".nogo.patch"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nogo_fix: ")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	workspace := os.Getenv("BUILD_WORKSPACE_DIRECTORY")
+	if workspace == "" {
+		return errors.New("BUILD_WORKSPACE_DIRECTORY is not set, use bazel run to invoke this tool")
+	}
+	if len(args) == 0 {
+		return errors.New("usage: nogo_fix <patch file or directory>...")
+	}
+	wd := os.Getenv("BUILD_WORKING_DIRECTORY")
+
+	var patchFiles []string
+	for _, arg := range args {
+		if !filepath.IsAbs(arg) && wd != "" {
+			arg = filepath.Join(wd, arg)
+		}
+		found, err := findPatches(arg)
+		if err != nil {
+			return err
+		}
+		patchFiles = append(patchFiles, found...)
+	}
+
+	changes := make(map[string][]change)
+	for _, patchFile := range patchFiles {
+		content, err := os.ReadFile(patchFile)
+		if err != nil {
+			return err
+		}
+		fileChanges, err := parsePatch(string(content))
+		if err != nil {
+			return fmt.Errorf("%s: %v", patchFile, err)
+		}
+		for path, cs := range fileChanges {
+			changes[path] = append(changes[path], cs...)
+		}
+	}
+
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		applied, err := applyChanges(filepath.Join(workspace, filepath.FromSlash(path)), changes[path])
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if applied > 0 {
+			fmt.Printf("fixed %s\n", path)
+		}
+	}
+	return nil
+}
+
+// findPatches returns the non-empty patch files at or below path.
+func findPatches(path string) ([]string, error) {
+	// bazel-bin and friends are usually symlinks, which filepath.WalkDir does not
+	// follow.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	var patches []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (p != path && !strings.HasSuffix(p, patchSuffix)) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil {
+			return err
+		} else if info.Size() > 0 {
+			patches = append(patches, p)
+		}
+		return nil
+	})
+	return patches, err
+}
+
+// change replaces the lines [start, end) of the original file, which are
+// expected to equal old, with lines.
+type change struct {
+	start, end int
+	old, lines []string
+}
+
+func (c change) equal(other change) bool {
+	if c.start != other.start || c.end != other.end || len(c.lines) != len(other.lines) {
+		return false
+	}
+	for i := range c.lines {
+		if c.lines[i] != other.lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the lines replaced by c are present in lines.
+func (c change) matches(lines []string) bool {
+	if c.end > len(lines) {
+		return false
+	}
+	for i, line := range c.old {
+		if lines[c.start+i] != line {
+			return false
+		}
+	}
+	return true
+}
+
+func (c change) overlaps(other change) bool {
+	if c.start == c.end && other.start == other.end {
+		return c.start == other.start
+	}
+	return c.start < other.end && other.start < c.end
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+// parsePatch parses a unified diff with paths prefixed by b/ and returns the
+// changes it makes to each file, with context lines removed. Lines retain
+// their trailing newlines, if any.
+func parsePatch(patch string) (map[string][]change, error) {
+	changes := make(map[string][]change)
+	lines := strings.SplitAfter(patch, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var path string
+	for i := 0; i < len(lines); {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			i++
+			continue
+		case strings.HasPrefix(line, "+++ "):
+			path = strings.TrimPrefix(strings.TrimSpace(line[len("+++ "):]), "b/")
+			i++
+			continue
+		case !strings.HasPrefix(line, "@@ "):
+			return nil, fmt.Errorf("line %d: unexpected line outside of hunk: %q", i+1, line)
+		}
+		if path == "" {
+			return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+		}
+		m := hunkHeaderPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: invalid hunk header: %q", i+1, line)
+		}
+		start, _ := strconv.Atoi(m[1])
+		oldCount := 1
+		if m[2] != "" {
+			oldCount, _ = strconv.Atoi(m[2])
+		}
+		if oldCount > 0 {
+			// Empty ranges refer to the line before them and thus already are
+			// zero-based line indices.
+			start--
+		}
+		i++
+
+		// Read the hunk body, recording the old and new lines along with the
+		// lengths of the leading and trailing context.
+		var oldLines, newLines []string
+		leading, trailing := 0, 0
+		seenChange := false
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			if line == "" || line == "\n" {
+				return nil, fmt.Errorf("line %d: invalid empty line in hunk", i+1)
+			}
+			text := line[1:]
+			switch line[0] {
+			case ' ':
+				oldLines = append(oldLines, text)
+				newLines = append(newLines, text)
+				if seenChange {
+					trailing++
+				} else {
+					leading++
+				}
+			case '-':
+				oldLines = append(oldLines, text)
+				seenChange, trailing = true, 0
+			case '+':
+				newLines = append(newLines, text)
+				seenChange, trailing = true, 0
+			case '\\':
+				// "\ No newline at end of file" applies to the preceding line.
+				switch lines[i-1][0] {
+				case ' ':
+					oldLines[len(oldLines)-1] = strings.TrimSuffix(oldLines[len(oldLines)-1], "\n")
+					newLines[len(newLines)-1] = strings.TrimSuffix(newLines[len(newLines)-1], "\n")
+				case '-':
+					oldLines[len(oldLines)-1] = strings.TrimSuffix(oldLines[len(oldLines)-1], "\n")
+				case '+':
+					newLines[len(newLines)-1] = strings.TrimSuffix(newLines[len(newLines)-1], "\n")
+				}
+			default:
+				return nil, fmt.Errorf("line %d: invalid line in hunk: %q", i+1, line)
+			}
+			if len(oldLines) == oldCount && (i+1 == len(lines) || !isContinuation(lines[i+1])) {
+				break
+			}
+		}
+		if len(oldLines) != oldCount {
+			return nil, fmt.Errorf("line %d: hunk does not match its header", i)
+		}
+		i++
+		changes[path] = append(changes[path], change{
+			start: start + leading,
+			end:   start + oldCount - trailing,
+			old:   oldLines[leading : len(oldLines)-trailing],
+			lines: newLines[leading : len(newLines)-trailing],
+		})
+	}
+	return changes, nil
+}
+
+// isContinuation reports whether line may continue a hunk whose old lines have
+// all been read.
+func isContinuation(line string) bool {
+	return strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "\\")
+}
+
+// applyChanges applies the given changes to the file at path and returns the
+// number of changes applied. Duplicate changes are applied once and changes
+// conflicting with a previous change are skipped.
+func applyChanges(path string, changes []change) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var accepted []change
+nextChange:
+	for _, c := range changes {
+		for _, prev := range accepted {
+			if c.equal(prev) {
+				continue nextChange
+			}
+			if c.overlaps(prev) {
+				log.Printf("warning: %s: skipping change to lines %d-%d that conflicts with another fix", path, c.start+1, c.end)
+				continue nextChange
+			}
+		}
+		if !c.matches(lines) {
+			log.Printf("warning: %s: skipping change to lines %d-%d that does not match the file, it may already have been applied", path, c.start+1, c.end)
+			continue
+		}
+		accepted = append(accepted, c)
+	}
+	if len(accepted) == 0 {
+		return 0, nil
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].start < accepted[j].start })
+
+	var out strings.Builder
+	pos := 0
+	for _, c := range accepted {
+		out.WriteString(strings.Join(lines[pos:c.start], ""))
+		out.WriteString(strings.Join(c.lines, ""))
+		pos = c.end
+	}
+	out.WriteString(strings.Join(lines[pos:], ""))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return len(accepted), os.WriteFile(path, []byte(out.String()), info.Mode().Perm())
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	original = `package fix
+
+func a() {
+	x := 1
+	_ = x
+}
+
+func b() {}
+
+func c() {}
+
+func d() {}`
+
+	patch1 = `--- a/pkg/fix.go
++++ b/pkg/fix.go
+@@ -1,4 +1,5 @@
+-package fix
++// Package fix is a test.
++package fix
+ 
+ func a() {
+ 	x := 1
+@@ -9,4 +10,5 @@
+ 
+ func c() {}
+ 
+-func d() {}
+\ No newline at end of file
++func d() {
++}
+`
+
+	// patch2 repeats the first change of patch1 and conflicts with its second.
+	patch2 = `--- a/pkg/fix.go
++++ b/pkg/fix.go
+@@ -1,4 +1,5 @@
+-package fix
++// Package fix is a test.
++package fix
+ 
+ func a() {
+ 	x := 1
+@@ -8,5 +9,5 @@
+ func b() {}
+ 
+ func c() {}
+ 
+-func d() {}
+\ No newline at end of file
++func d(int) {}
+\ No newline at end of file
+`
+
+	fixed = `// Package fix is a test.
+package fix
+
+func a() {
+	x := 1
+	_ = x
+}
+
+func b() {}
+
+func c() {}
+
+func d() {
+}
+`
+)
+
+func TestApplyPatches(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fix.go")
+	if err := os.WriteFile(path, []byte(original), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []change
+	for _, patch := range []string{patch1, patch2} {
+		fileChanges, err := parsePatch(patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fileChanges) != 1 {
+			t.Fatalf("got changes for %d files, want 1", len(fileChanges))
+		}
+		changes = append(changes, fileChanges["pkg/fix.go"]...)
+	}
+	applied, err := applyChanges(path, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("got %d applied changes, want 2", applied)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != fixed {
+		t.Errorf("got:\n%s\nwant:\n%s", got, fixed)
+	}
+
+	// Applying the same changes again is a no-op.
+	if applied, err := applyChanges(path, changes); err != nil {
+		t.Fatal(err)
+	} else if applied != 0 {
+		t.Errorf("got %d applied changes on second run, want 0", applied)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nogo_profile ranks nogo analyzers by the total time they spent across a
+// build.
+//
+// Build the timing profiles with --@io_bazel_rules_go//go/config:nogo_profile
+// and --output_groups=nogo_profile and pass the profile files, or directories
+// containing them such as bazel-bin, to this tool:
+//
+//	bazel build --@io_bazel_rules_go//go/config:nogo_profile --output_groups=nogo_profile //...
+//	bazel run @io_bazel_rules_go//go/tools/nogo_profile -- $(bazel info bazel-bin)
+//
+// Note that only profiles of nogo actions that were executed in the build,
+// rather than taken from a cache, reflect the current state of the analyzers.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// profileSuffix is the extension of the timing profiles declared by the Go
+// rules.
+const profileSuffix = ".nogo.profile.json"
+
+// The timing profile format of nogo, see go/tools/builders/nogo_profile.go.
+type nogoProfile struct {
+	Package    string            `json:"package"`
+	Total      time.Duration     `json:"total_ns"`
+	Parse      time.Duration     `json:"parse_ns"`
+	TypeCheck  time.Duration     `json:"type_check_ns"`
+	FactDecode time.Duration     `json:"fact_decode_ns"`
+	FactEncode time.Duration     `json:"fact_encode_ns"`
+	Analyzers  []analyzerProfile `json:"analyzers"`
+}
+
+type analyzerProfile struct {
+	Name string        `json:"name"`
+	Time time.Duration `json:"time_ns"`
+}
+
+// cost is the time spent by an analyzer or in a phase across all packages.
+type cost struct {
+	Name     string        `json:"name"`
+	Total    time.Duration `json:"total_ns"`
+	Packages int           `json:"packages"`
+	// Max is the time spent on the most expensive package, MaxPackage.
+	Max        time.Duration `json:"max_ns"`
+	MaxPackage string        `json:"max_package"`
+}
+
+func (c *cost) add(pkg string, d time.Duration) {
+	c.Total += d
+	c.Packages++
+	if c.MaxPackage == "" || d > c.Max {
+		c.Max, c.MaxPackage = d, pkg
+	}
+}
+
+// summary aggregates a set of timing profiles.
+type summary struct {
+	// Total is the sum of the total times of all nogo runs.
+	Total    time.Duration `json:"total_ns"`
+	Packages int           `json:"packages"`
+	// Analyzers and Phases are sorted by decreasing total time.
+	Analyzers []cost `json:"analyzers"`
+	Phases    []cost `json:"phases"`
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nogo_profile: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("nogo_profile", flag.ExitOnError)
+	top := flags.Int("top", 0, "The number of analyzers to print, or 0 to print all of them")
+	jsonOut := flags.Bool("json", false, "Print the summary in JSON format")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("usage: nogo_profile [-top <n>] [-json] <profile file or directory>...")
+	}
+	wd := os.Getenv("BUILD_WORKING_DIRECTORY")
+
+	var profiles []nogoProfile
+	for _, arg := range flags.Args() {
+		if !filepath.IsAbs(arg) && wd != "" {
+			arg = filepath.Join(wd, arg)
+		}
+		paths, err := findProfiles(arg)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var p nogoProfile
+			if err := json.Unmarshal(content, &p); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			profiles = append(profiles, p)
+		}
+	}
+
+	s := summarize(profiles)
+	if *top > 0 && len(s.Analyzers) > *top {
+		s.Analyzers = s.Analyzers[:*top]
+	}
+	if *jsonOut {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+	return printSummary(out, s)
+}
+
+// findProfiles returns the timing profiles at or below path.
+func findProfiles(path string) ([]string, error) {
+	// bazel-bin and friends are usually symlinks, which filepath.WalkDir does not
+	// follow.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (p != path && !strings.HasSuffix(p, profileSuffix)) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+// summarize adds up the times of each analyzer and phase across all profiles.
+// Profiles of packages without Go sources are ignored.
+func summarize(profiles []nogoProfile) summary {
+	var s summary
+	analyzers := make(map[string]*cost)
+	phases := []*cost{{Name: "parse"}, {Name: "type check"}, {Name: "fact decode"}, {Name: "fact encode"}}
+	for _, p := range profiles {
+		if p.Total == 0 {
+			continue
+		}
+		s.Total += p.Total
+		s.Packages++
+		for i, d := range []time.Duration{p.Parse, p.TypeCheck, p.FactDecode, p.FactEncode} {
+			phases[i].add(p.Package, d)
+		}
+		for _, a := range p.Analyzers {
+			c, ok := analyzers[a.Name]
+			if !ok {
+				c = &cost{Name: a.Name}
+				analyzers[a.Name] = c
+			}
+			c.add(p.Package, a.Time)
+		}
+	}
+	s.Analyzers = []cost{}
+	for _, c := range analyzers {
+		s.Analyzers = append(s.Analyzers, *c)
+	}
+	s.Phases = []cost{}
+	for _, c := range phases {
+		s.Phases = append(s.Phases, *c)
+	}
+	sortCosts(s.Analyzers)
+	sortCosts(s.Phases)
+	return s
+}
+
+func sortCosts(costs []cost) {
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Total != costs[j].Total {
+			return costs[i].Total > costs[j].Total
+		}
+		return costs[i].Name < costs[j].Name
+	})
+}
+
+func printSummary(out io.Writer, s summary) error {
+	fmt.Fprintf(out, "%d packages analyzed in %v\n", s.Packages, round(s.Total))
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\nANALYZER\tTOTAL\tSHARE\tPACKAGES\tMAX\tMAX PACKAGE\n")
+	for _, c := range s.Analyzers {
+		printCost(w, c, s.Total)
+	}
+	fmt.Fprintf(w, "\nPHASE\tTOTAL\tSHARE\tPACKAGES\tMAX\tMAX PACKAGE\n")
+	for _, c := range s.Phases {
+		printCost(w, c, s.Total)
+	}
+	return w.Flush()
+}
+
+func printCost(w io.Writer, c cost, total time.Duration) {
+	share := 0.0
+	if total > 0 {
+		share = 100 * float64(c.Total) / float64(total)
+	}
+	fmt.Fprintf(w, "%s\t%v\t%.1f%%\t%d\t%v\t%s\n", c.Name, round(c.Total), share, c.Packages, round(c.Max), c.MaxPackage)
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond / 10)
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	profiles := []nogoProfile{
+		{
+			Package:   "a",
+			Total:     10 * time.Millisecond,
+			TypeCheck: 4 * time.Millisecond,
+			Analyzers: []analyzerProfile{
+				{Name: "inspect", Time: time.Millisecond},
+				{Name: "printf", Time: 2 * time.Millisecond},
+			},
+		},
+		{
+			Package:   "b",
+			Total:     20 * time.Millisecond,
+			TypeCheck: 3 * time.Millisecond,
+			Analyzers: []analyzerProfile{
+				{Name: "inspect", Time: 2 * time.Millisecond},
+				{Name: "printf", Time: 6 * time.Millisecond},
+			},
+		},
+		// Packages without Go sources have empty profiles.
+		{Package: "empty"},
+	}
+	s := summarize(profiles)
+	if s.Total != 30*time.Millisecond || s.Packages != 2 {
+		t.Errorf("got total %v for %d packages, want 30ms for 2 packages", s.Total, s.Packages)
+	}
+	wantAnalyzers := []cost{
+		{Name: "printf", Total: 8 * time.Millisecond, Packages: 2, Max: 6 * time.Millisecond, MaxPackage: "b"},
+		{Name: "inspect", Total: 3 * time.Millisecond, Packages: 2, Max: 2 * time.Millisecond, MaxPackage: "b"},
+	}
+	if !reflect.DeepEqual(s.Analyzers, wantAnalyzers) {
+		t.Errorf("got analyzers %+v, want %+v", s.Analyzers, wantAnalyzers)
+	}
+	wantTypeCheck := cost{Name: "type check", Total: 7 * time.Millisecond, Packages: 2, Max: 4 * time.Millisecond, MaxPackage: "a"}
+	if s.Phases[0] != wantTypeCheck {
+		t.Errorf("got most expensive phase %+v, want %+v", s.Phases[0], wantTypeCheck)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.nogo.profile.json": `{"package": "a", "total_ns": 4000000, "analyzers": [{"name": "printf", "time_ns": 3000000}]}`,
+		"b.nogo.profile.json": `{"package": "b", "total_ns": 1000000, "analyzers": [{"name": "nilness", "time_ns": 500000}]}`,
+		"a.nogo.json":         `not a profile`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := run([]string{"-top", "1", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "2 packages analyzed in 5ms\n") {
+		t.Errorf("unexpected header in output:\n%s", got)
+	}
+	if !strings.Contains(got, "printf") || strings.Contains(got, "nilness") {
+		t.Errorf("output should only contain the most expensive analyzer:\n%s", got)
+	}
+}
@@ -243,8 +243,14 @@ func TestLcovCoverageWithTool(t *testing.T) {
 
 var expectedGoCoverage = []string{
 	`SF:src/other_lib.go
-FNF:0
-FNH:0
+FN:3,HelloOtherLib
+FNDA:1,HelloOtherLib
+FNF:1
+FNH:1
+BRDA:4,0,0,1
+BRDA:4,0,1,0
+BRF:2
+BRH:1
 DA:3,1
 DA:4,1
 DA:5,0
@@ -255,8 +261,16 @@ LF:5
 end_of_record
 `,
 	`SF:src/lib.go
-FNF:0
-FNH:0
+FN:9,HelloFromLib
+FNDA:1,HelloFromLib
+FNF:1
+FNH:1
+BRDA:11,0,0,1
+BRDA:11,0,1,0
+BRDA:13,0,0,0
+BRDA:13,0,1,1
+BRF:4
+BRH:2
 DA:9,1
 DA:10,1
 DA:11,1
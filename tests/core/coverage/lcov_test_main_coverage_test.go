@@ -108,8 +108,16 @@ func TestLcovCoverageWithTestMain(t *testing.T) {
 }
 
 const expectedIndividualCoverage = `SF:src/lib.go
-FNF:0
-FNH:0
+FN:3,HelloFromLib
+FNDA:1,HelloFromLib
+FNF:1
+FNH:1
+BRDA:4,0,0,1
+BRDA:4,0,1,0
+BRDA:6,0,0,0
+BRDA:6,0,1,1
+BRF:4
+BRH:2
 DA:3,1
 DA:4,1
 DA:5,0
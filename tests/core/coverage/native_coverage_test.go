@@ -0,0 +1,169 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native_coverage_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- src/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["main.go"],
+    deps = [":lib"],
+)
+
+go_test(
+    name = "bin_test",
+    srcs = ["bin_test.go"],
+    data = [":bin"],
+    env = {"BIN": "$(rootpath :bin)"},
+    rundir = ".",
+    deps = [":lib"],
+)
+-- src/lib.go --
+package lib
+
+func Hello(informal bool) string {
+	if informal {
+		return "hey"
+	}
+	return "good morning"
+}
+-- src/main.go --
+package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.Hello(false))
+}
+-- src/bin_test.go --
+package bin_test
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"example.com/lib"
+)
+
+func TestLib(t *testing.T) {
+	if got := lib.Hello(true); got != "hey" {
+		t.Errorf("got %q, want %q", got, "hey")
+	}
+}
+
+func TestBin(t *testing.T) {
+	out, err := exec.Command(os.Getenv("BIN")).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "good morning" {
+		t.Errorf("got %q, want %q", got, "good morning")
+	}
+}
+`,
+	})
+}
+
+func TestNativeCoverage(t *testing.T) {
+	t.Run("without-race", func(t *testing.T) {
+		testNativeCoverage(t)
+	})
+
+	t.Run("with-race", func(t *testing.T) {
+		testNativeCoverage(t, "--@io_bazel_rules_go//go/config:race")
+	})
+}
+
+func testNativeCoverage(t *testing.T, extraArgs ...string) {
+	args := append([]string{
+		"coverage",
+		"--@io_bazel_rules_go//go/config:native_coverage",
+		"//src:bin_test",
+	}, extraArgs...)
+
+	if err := bazel_testing.RunBazel(args...); err != nil {
+		t.Fatal(err)
+	}
+
+	coveragePath := filepath.FromSlash("bazel-testlogs/src/bin_test/coverage.dat")
+	coverageData, err := os.ReadFile(coveragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range expectedCoverage {
+		if !strings.Contains(string(coverageData), expected) {
+			t.Errorf(
+				"%s: does not contain:\n\n%s\nactual content:\n\n%s",
+				coveragePath,
+				expected,
+				string(coverageData),
+			)
+		}
+	}
+}
+
+var expectedCoverage = []string{
+	// Covered by the test and the binary.
+	`SF:src/lib.go
+FN:3,Hello
+FNDA:1,Hello
+FNF:1
+FNH:1
+DA:4,1
+DA:5,1
+DA:6,1
+DA:7,1
+LH:4
+LF:4
+end_of_record
+`,
+	// Covered by the binary only.
+	`SF:src/main.go
+FN:9,main
+FNDA:1,main
+FNF:1
+FNH:1
+DA:10,1
+DA:11,1
+LH:2
+LF:2
+end_of_record
+`,
+}
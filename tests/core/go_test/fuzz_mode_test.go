@@ -0,0 +1,119 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuzz_mode_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "fuzz_test",
+    srcs = ["fuzz_test.go"],
+    data = glob(["testdata/**"]),
+    deps = [":lib"],
+)
+
+-- lib.go --
+package lib
+
+func IsSeed(s string) bool {
+	return s == "seed"
+}
+
+-- fuzz_test.go --
+package fuzz
+
+import (
+	"testing"
+
+	"example.com/lib"
+)
+
+func FuzzCrash(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		if !lib.IsSeed(s) {
+			t.Fatalf("crash on %q", s)
+		}
+	})
+}
+
+-- testdata/fuzz/FuzzCrash/seed --
+go test fuzz v1
+string("seed")
+`,
+	})
+}
+
+func TestFuzzWritesCrasherToSourceTree(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("fuzz instrumentation is not supported on " + runtime.GOARCH)
+	}
+	// The seed corpus passes, so the failure is a crasher found by fuzzing.
+	if err := bazel_testing.RunBazel("test", "//:fuzz_test"); err != nil {
+		t.Fatalf("expected the seed corpus to pass: %v", err)
+	}
+	err := bazel_testing.RunBazel("run", "--@io_bazel_rules_go//go/config:fuzz", "//:fuzz_test", "--", "-test.fuzz=FuzzCrash", "-test.fuzztime=30s")
+	if err == nil {
+		t.Fatal("expected fuzzing to find a crasher")
+	}
+
+	crashers, err := os.ReadDir(filepath.Join("testdata", "fuzz", "FuzzCrash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The seed and the new crasher.
+	if len(crashers) != 2 {
+		t.Errorf("expected a crasher to be written next to the seed, got %d files", len(crashers))
+	}
+}
+
+func TestFuzzCoverage(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("fuzz instrumentation is not supported on " + runtime.GOARCH)
+	}
+	if err := bazel_testing.RunBazel("coverage", "--@io_bazel_rules_go//go/config:fuzz", "//:fuzz_test"); err != nil {
+		t.Fatalf("expected the seed corpus to pass: %v", err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlogs root: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(strings.TrimSpace(string(p)), "fuzz_test", "coverage.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "SF:lib.go") {
+		t.Errorf("expected lcov coverage of lib.go, got:\n%s", b)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry_test
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "retry_test",
+    srcs = ["retry_test.go"],
+    env = {"GO_TEST_RETRIES": "2"},
+)
+
+-- retry_test.go --
+package retry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPass(t *testing.T) {}
+
+// TestFlaky fails on its first attempt only.
+func TestFlaky(t *testing.T) {
+	marker := filepath.Join(os.Getenv("TEST_TMPDIR"), "attempted")
+	if _, err := os.Stat(marker); os.IsNotExist(err) {
+		os.WriteFile(marker, nil, 0666)
+		t.Fatal("first attempt")
+	}
+}
+`,
+	})
+}
+
+type xmlTestCase struct {
+	Name          string     `xml:"name,attr"`
+	Failure       *struct{}  `xml:"failure"`
+	FlakyFailures []struct{} `xml:"flakyFailure"`
+}
+
+type xmlTestSuites struct {
+	Suites []struct {
+		TestCases []xmlTestCase `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+func TestRetry(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:retry_test"); err != nil {
+		t.Fatalf("expected the flaky test to pass when retried: %v", err)
+	}
+
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlog root: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(strings.TrimSpace(string(p)), "retry_test/test.xml"))
+	if err != nil {
+		t.Fatalf("could not read generated xml file: %s", err)
+	}
+	var suites xmlTestSuites
+	if err := xml.Unmarshal(b, &suites); err != nil {
+		t.Fatalf("could not unmarshall generated xml: %s", err)
+	}
+
+	flaky := map[string]int{}
+	for _, suite := range suites.Suites {
+		for _, tc := range suite.TestCases {
+			if tc.Failure != nil {
+				t.Errorf("test %s failed", tc.Name)
+			}
+			flaky[tc.Name] = len(tc.FlakyFailures)
+		}
+	}
+	if flaky["TestFlaky"] != 1 || flaky["TestPass"] != 0 {
+		t.Errorf("expected only TestFlaky to have one flaky failure, got %v", flaky)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard_strategy_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "hash_test",
+    srcs = ["shard_test.go"],
+    shard_count = 2,
+    shard_strategy = "hash",
+)
+
+go_test(
+    name = "duration_test",
+    srcs = ["shard_test.go"],
+    shard_count = 2,
+    shard_strategy = "duration",
+    shard_timings = "timings.xml",
+)
+-- shard_test.go --
+package shard_test
+
+import "testing"
+
+func TestSlow(t *testing.T) {}
+func TestFast1(t *testing.T) {}
+func TestFast2(t *testing.T) {}
+func TestFast3(t *testing.T) {}
+-- timings.xml --
+<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="2" time="11" name="duration_test">
+		<testcase classname="duration_test" name="TestSlow" time="10"></testcase>
+		<testcase classname="duration_test" name="TestFast1" time="1"></testcase>
+	</testsuite>
+</testsuites>
+<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+	<testsuite errors="0" failures="0" skipped="0" tests="2" time="2" name="duration_test">
+		<testcase classname="duration_test" name="TestFast2" time="1"></testcase>
+		<testcase classname="duration_test" name="TestFast3" time="1"></testcase>
+	</testsuite>
+</testsuites>
+`,
+	})
+}
+
+// xml test suites to check which test cases were run
+type xmlTestCase struct {
+	XMLName xml.Name `xml:"testcase"`
+	Name    string   `xml:"name,attr"`
+}
+type xmlTestSuite struct {
+	XMLName   xml.Name      `xml:"testsuite"`
+	TestCases []xmlTestCase `xml:"testcase"`
+}
+type xmlTestSuites struct {
+	XMLName xml.Name       `xml:"testsuites"`
+	Suites  []xmlTestSuite `xml:"testsuite"`
+}
+
+func TestHashStrategy(t *testing.T) {
+	shards := runShards(t, "hash_test")
+	var all []string
+	for _, tests := range shards {
+		all = append(all, tests...)
+	}
+	sort.Strings(all)
+	if expected := []string{"TestFast1", "TestFast2", "TestFast3", "TestSlow"}; !reflect.DeepEqual(all, expected) {
+		t.Errorf("got tests %v across all shards, expected each of %v exactly once", all, expected)
+	}
+}
+
+func TestDurationStrategy(t *testing.T) {
+	shards := runShards(t, "duration_test")
+	expected := [][]string{{"TestSlow"}, {"TestFast1", "TestFast2", "TestFast3"}}
+	if !reflect.DeepEqual(shards, expected) {
+		t.Errorf("got shards %v, expected %v", shards, expected)
+	}
+}
+
+// runShards runs the test and returns the sorted names of the tests run by
+// each of its two shards.
+func runShards(t *testing.T, target string) [][]string {
+	if err := bazel_testing.RunBazel("test", "//:"+target, "--test_env=GO_TEST_WRAP_TESTV=1"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlog root: %s", err)
+	}
+	var shards [][]string
+	for shard := 1; shard <= 2; shard++ {
+		path := filepath.Join(strings.TrimSpace(string(p)), target, fmt.Sprintf("shard_%d_of_2", shard), "test.xml")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("could not read generated xml file: %s", err)
+		}
+		var suites xmlTestSuites
+		if err := xml.Unmarshal(b, &suites); err != nil {
+			t.Fatalf("could not unmarshall generated xml: %s", err)
+		}
+		var tests []string
+		for _, suite := range suites.Suites {
+			for _, tc := range suite.TestCases {
+				tests = append(tests, tc.Name)
+			}
+		}
+		sort.Strings(tests)
+		shards = append(shards, tests)
+	}
+	return shards
+}
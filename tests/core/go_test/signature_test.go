@@ -0,0 +1,105 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "bad_test",
+    srcs = ["bad_test.go"],
+    embed = [":lib"],
+)
+
+go_test(
+    name = "good_test",
+    srcs = ["good_test.go"],
+    embed = [":lib"],
+)
+
+-- lib.go --
+package lib
+
+func Describe() string { return "lib" }
+
+-- bad_test.go --
+package lib
+
+import "testing"
+
+func TestDescribe(t *testing.B) {}
+
+func Testdescribe(t *testing.T) {}
+
+func ExampleDescrbe() {}
+
+-- good_test.go --
+package lib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {}
+
+func ExampleDescribe() {
+	fmt.Println(Describe())
+	// Output: lib
+}
+`,
+	})
+}
+
+func TestWrongSignatures(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:bad_test")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	for _, want := range []string{
+		"bad_test.go:5:1: wrong signature for TestDescribe, must be: func TestDescribe(t *testing.T)",
+		"bad_test.go:7:1: Testdescribe has malformed name: first letter after 'Test' must not be lowercase",
+		"bad_test.go:9:1: ExampleDescrbe refers to unknown identifier: Descrbe",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("output did not contain %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestGoodSignatures(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:good_test"); err != nil {
+		t.Fatal(err)
+	}
+}
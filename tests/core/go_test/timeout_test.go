@@ -41,8 +41,32 @@ func TestTimeout(t *testing.T) {
 		t.Skip("stack traces on timeouts are not yet supported on Windows")
 	}
 
+	for _, test := range []struct {
+		desc   string
+		args   []string
+		header string
+	}{
+		{
+			desc:   "test_timeout",
+			header: "panic: test timed out after 3s",
+		}, {
+			// The wrapper dumps the goroutines of a test that keeps running
+			// after Bazel's timeout.
+			desc:   "sigquit",
+			args:   []string{"--test_arg=-test.timeout=1h"},
+			header: "SIGQUIT: quit",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			testTimeout(t, test.args, test.header)
+		})
+	}
+}
+
+func testTimeout(t *testing.T, args []string, header string) {
 	var stderr string
-	if err := bazel_testing.RunBazel("test", "//:timeout_test", "--test_timeout=3", "--test_arg=-test.v"); err == nil {
+	args = append([]string{"test", "//:timeout_test", "--test_timeout=3", "--test_arg=-test.v"}, args...)
+	if err := bazel_testing.RunBazel(args...); err == nil {
 		t.Fatal("expected bazel test to fail")
 	} else if exitErr, ok := err.(*bazel_testing.StderrExitError); !ok || exitErr.Err.ExitCode() != 3 {
 		t.Fatalf("expected bazel test to fail with exit code 3, got %v", err)
@@ -65,7 +89,7 @@ func TestTimeout(t *testing.T) {
 	}
 
 	testLog := string(b)
-	if !strings.Contains(testLog, "panic: test timed out after 3s") {
+	if !strings.Contains(testLog, header) {
 		t.Errorf("test log does not contain expected header:\n%s", testLog)
 	}
 	if !strings.Contains(testLog, "timeout_test.neverTerminates(") {
@@ -82,4 +106,7 @@ func TestTimeout(t *testing.T) {
 	if !strings.Contains(testXML, `<testcase classname="timeout_test" name="TestFoo"`) {
 		t.Errorf("test XML does not contain expected element:\n%s", testXML)
 	}
+	if !strings.Contains(testXML, `<error message="Timed out"`) {
+		t.Errorf("test XML does not mark the test as timed out:\n%s", testXML)
+	}
 }
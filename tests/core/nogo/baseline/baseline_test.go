@@ -0,0 +1,200 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baseline_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    baseline = "nogo_baseline.json",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- nogo_baseline.json --
+{"entries": []}
+
+-- lib.go --
+package lib
+
+func A(b bool) bool {
+	return b || b
+}
+
+func B(b bool) bool {
+	return b && b
+}
+`,
+	})
+}
+
+const (
+	shiftedLib = `package lib
+
+// A and B are legacy code.
+
+func A(b bool) bool {
+	return b || b
+}
+
+func B(b bool) bool {
+	return b && b
+}
+`
+
+	newFindingLib = shiftedLib + `
+func C(b bool) bool {
+	return b || b
+}
+`
+
+	fixedLib = `package lib
+
+func A(b bool) bool {
+	return b
+}
+
+func B(b bool) bool {
+	return b
+}
+`
+)
+
+type baselineFile struct {
+	Entries []struct {
+		Analyzer string `json:"analyzer"`
+		File     string `json:"file"`
+		Count    int    `json:"count"`
+	} `json:"entries"`
+}
+
+func TestBaseline(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:lib"); err == nil {
+		t.Fatal("unexpected success without baseline entries")
+	}
+
+	// Record the existing findings.
+	updateBaseline(t)
+	baseline := readBaseline(t)
+	if len(baseline.Entries) != 2 {
+		t.Fatalf("got %d baseline entries, want 2: %+v", len(baseline.Entries), baseline.Entries)
+	}
+	for _, e := range baseline.Entries {
+		if e.Analyzer != "bools" || e.File != "lib.go" || e.Count != 1 {
+			t.Errorf("unexpected baseline entry: %+v", e)
+		}
+	}
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatalf("unexpected failure with baseline: %v", err)
+	}
+
+	// Baselined findings still match after inserting lines above them.
+	writeLib(t, shiftedLib)
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatalf("unexpected failure after shifting lines: %v", err)
+	}
+
+	// New findings are reported.
+	writeLib(t, newFindingLib)
+	out, err := bazel_testing.BazelCmd("build", "//:lib").CombinedOutput()
+	if err == nil {
+		t.Fatal("unexpected success with new finding")
+	}
+	if !strings.Contains(string(out), "lib.go:14:9: redundant or: b || b (bools)") {
+		t.Errorf("output does not contain new finding:\n%s", out)
+	}
+	if strings.Contains(string(out), "lib.go:6:9") || strings.Contains(string(out), "lib.go:10:9") {
+		t.Errorf("output contains baselined findings:\n%s", out)
+	}
+
+	// Entries of fixed findings are reported as stale and removed.
+	writeLib(t, fixedLib)
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatalf("unexpected failure after fixing findings: %v", err)
+	}
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_findings", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = bazel_testing.BazelCmd("run", "@io_bazel_rules_go//go/tools/nogo_baseline", "--", "-check", "-baseline", "nogo_baseline.json", bazelBin(t)).CombinedOutput()
+	if err == nil {
+		t.Fatal("unexpected success checking stale baseline")
+	}
+	if strings.Count(string(out), "stale: lib.go:") != 2 {
+		t.Errorf("output does not list two stale entries:\n%s", out)
+	}
+	updateBaseline(t)
+	if baseline := readBaseline(t); len(baseline.Entries) != 0 {
+		t.Errorf("got baseline entries after fixing all findings: %+v", baseline.Entries)
+	}
+}
+
+func updateBaseline(t *testing.T) {
+	t.Helper()
+	if err := bazel_testing.RunBazel("build", "--norun_validations", "--output_groups=nogo_findings", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go/tools/nogo_baseline", "--", "-baseline", "nogo_baseline.json", bazelBin(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bazelBin(t *testing.T) string {
+	t.Helper()
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func readBaseline(t *testing.T) baselineFile {
+	t.Helper()
+	data, err := ioutil.ReadFile("nogo_baseline.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseline baselineFile
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		t.Fatal(err)
+	}
+	return baseline
+}
+
+func writeLib(t *testing.T, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile("lib.go", []byte(content), 0o666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package findings_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "has_errors",
+    srcs = ["has_errors.go"],
+    importpath = "example.com/has_errors",
+)
+
+go_library(
+    name = "no_errors",
+    srcs = ["no_errors.go"],
+    importpath = "example.com/no_errors",
+)
+
+-- has_errors.go --
+package has_errors
+
+func F() bool {
+	return true || true
+}
+
+-- no_errors.go --
+package no_errors
+
+func F() bool {
+	return true
+}
+`,
+	})
+}
+
+type findingsFile struct {
+	Package  string `json:"package"`
+	Findings []struct {
+		Analyzer string `json:"analyzer"`
+		Message  string `json:"message"`
+		Range    struct {
+			File        string `json:"file"`
+			StartLine   int    `json:"start_line"`
+			StartColumn int    `json:"start_column"`
+			EndLine     int    `json:"end_line"`
+			EndColumn   int    `json:"end_column"`
+		} `json:"range"`
+	} `json:"findings"`
+}
+
+type sarifLog struct {
+	Version string `json:"version"`
+	Runs    []struct {
+		Results []struct {
+			RuleID  string `json:"ruleId"`
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+func TestFindings(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--norun_validations", "--output_groups=nogo_findings", "//:has_errors", "//:no_errors"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := strings.TrimSpace(string(out))
+
+	var hasErrors findingsFile
+	readJSON(t, filepath.Join(bin, "has_errors.nogo.json"), &hasErrors)
+	if hasErrors.Package != "example.com/has_errors" {
+		t.Errorf("got package %q, want example.com/has_errors", hasErrors.Package)
+	}
+	if len(hasErrors.Findings) != 1 {
+		t.Fatalf("got %d findings, want 1: %+v", len(hasErrors.Findings), hasErrors.Findings)
+	}
+	f := hasErrors.Findings[0]
+	if f.Analyzer != "bools" || f.Message != "redundant or: true || true" {
+		t.Errorf("unexpected finding: %+v", f)
+	}
+	if f.Range.File != "has_errors.go" || f.Range.StartLine != 4 || f.Range.StartColumn != 9 || f.Range.EndLine != 4 || f.Range.EndColumn != 21 {
+		t.Errorf("unexpected range: %+v", f.Range)
+	}
+
+	var sarif sarifLog
+	readJSON(t, filepath.Join(bin, "has_errors.nogo.sarif"), &sarif)
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 1 {
+		t.Fatalf("unexpected SARIF log: %+v", sarif)
+	}
+	if result := sarif.Runs[0].Results[0]; result.RuleID != "bools" || result.Message.Text != "redundant or: true || true" {
+		t.Errorf("unexpected SARIF result: %+v", result)
+	}
+
+	var noErrors findingsFile
+	readJSON(t, filepath.Join(bin, "no_errors.nogo.json"), &noErrors)
+	if len(noErrors.Findings) != 0 {
+		t.Errorf("got findings for no_errors: %+v", noErrors.Findings)
+	}
+	readJSON(t, filepath.Join(bin, "no_errors.nogo.sarif"), &sarif)
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
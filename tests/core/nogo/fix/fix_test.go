@@ -0,0 +1,156 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fix_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":increment"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "increment",
+    srcs = ["increment.go"],
+    importpath = "incrementanalyzer",
+    deps = ["@org_golang_x_tools//go/analysis"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- increment.go --
+// Package increment reports "x += 1" and suggests "x++" instead.
+package increment
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "increment",
+	Doc:  "reports x += 1",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			assign, ok := n.(*ast.AssignStmt)
+			if !ok || assign.Tok != token.ADD_ASSIGN || len(assign.Rhs) != 1 {
+				return true
+			}
+			if lit, ok := assign.Rhs[0].(*ast.BasicLit); !ok || lit.Value != "1" {
+				return true
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:     assign.Pos(),
+				End:     assign.End(),
+				Message: "use ++ to increment",
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message: "replace with ++",
+					TextEdits: []analysis.TextEdit{{
+						Pos:     assign.TokPos,
+						End:     assign.End(),
+						NewText: []byte("++"),
+					}},
+				}},
+			})
+			return true
+		})
+	}
+	return nil, nil
+}
+
+-- lib.go --
+package lib
+
+func Count(n int) int {
+	c := 0
+	for i := 0; i < n; i += 1 {
+		c += 1
+	}
+	return c
+}
+`,
+	})
+}
+
+const fixedLib = `package lib
+
+func Count(n int) int {
+	c := 0
+	for i := 0; i < n; i++ {
+		c++
+	}
+	return c
+}
+`
+
+func TestFix(t *testing.T) {
+	out, err := bazel_testing.BazelCmd("build", "//:lib").CombinedOutput()
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(string(out), "lib.go:5:26: use ++ to increment (increment)") {
+		t.Errorf("output does not contain finding:\n%s", out)
+	}
+	if !strings.Contains(string(out), "@io_bazel_rules_go//go/tools/nogo_fix") {
+		t.Errorf("output does not mention how to apply fixes:\n%s", out)
+	}
+
+	if err := bazel_testing.RunBazel("build", "--norun_validations", "--output_groups=nogo_fix", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	bin, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go/tools/nogo_fix", "--", strings.TrimSpace(string(bin))); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile("lib.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != fixedLib {
+		t.Errorf("got:\n%s\nwant:\n%s", got, fixedLib)
+	}
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatalf("unexpected failure after applying fixes: %v", err)
+	}
+}
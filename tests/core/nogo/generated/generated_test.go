@@ -0,0 +1,148 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generated_test
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+const origConfig = `# config = "",`
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    # config = "",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "uses_cgo",
+    srcs = ["uses_cgo.go"],
+    cgo = True,
+    importpath = "example.com/uses_cgo",
+)
+
+go_library(
+    name = "generated",
+    srcs = ["generated.go"],
+    importpath = "example.com/generated",
+)
+
+go_library(
+    name = "line_directive",
+    srcs = ["parser.go"],
+    importpath = "example.com/line_directive",
+)
+
+-- config.json --
+{
+  "bools": {
+    "report_generated": true
+  }
+}
+
+-- uses_cgo.go --
+package uses_cgo
+
+// #include <stdlib.h>
+import "C"
+
+func Rand(b bool) bool {
+	if C.rand() > 10 {
+		return b || b
+	}
+	return false
+}
+
+-- generated.go --
+// Code generated by hand. DO NOT EDIT.
+
+package generated
+
+func Redundant(b bool) bool {
+	return b || b
+}
+
+-- parser.go --
+// Code generated by goyacc. DO NOT EDIT.
+
+package line_directive
+
+//line parser.y:12
+func Redundant(b bool) bool { return b && b }
+`,
+	})
+}
+
+func TestCgo(t *testing.T) {
+	out := build(t, "//:uses_cgo", false)
+	if !regexp.MustCompile(`uses_cgo\.go:8:\d+: redundant or: b \|\| b \(bools\)`).MatchString(out) {
+		t.Errorf("output does not contain finding at the original position:\n%s", out)
+	}
+	if strings.Contains(out, ".cgo1.go") || strings.Contains(out, "_cgo_") {
+		t.Errorf("output contains findings in files generated by cgo:\n%s", out)
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	build(t, "//:generated", true)
+
+	if err := replaceInFile("BUILD.bazel", origConfig, `config = "config.json",`); err != nil {
+		t.Fatal(err)
+	}
+	defer replaceInFile("BUILD.bazel", `config = "config.json",`, origConfig)
+	out := build(t, "//:generated", false)
+	if !strings.Contains(out, "generated.go:6:9: redundant or: b || b (bools)") {
+		t.Errorf("output does not contain finding in generated file with report_generated:\n%s", out)
+	}
+}
+
+func TestLineDirective(t *testing.T) {
+	out := build(t, "//:line_directive", false)
+	if !strings.Contains(out, "parser.y:12:") {
+		t.Errorf("output does not contain finding at the mapped position:\n%s", out)
+	}
+}
+
+func build(t *testing.T, target string, wantSuccess bool) string {
+	t.Helper()
+	out, err := bazel_testing.BazelCmd("build", target).CombinedOutput()
+	if err == nil && !wantSuccess {
+		t.Fatalf("unexpected success building %s:\n%s", target, out)
+	} else if err != nil && wantSuccess {
+		t.Fatalf("unexpected error building %s: %v\n%s", target, err, out)
+	}
+	return string(out)
+}
+
+func replaceInFile(path, old, new string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(strings.ReplaceAll(string(data), old, new)), 0o666)
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strict_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    strict_nolint = True,
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "valid",
+    srcs = ["valid.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "no_reason",
+    srcs = ["no_reason.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "unknown",
+    srcs = ["unknown.go"],
+    importpath = "test",
+)
+
+go_library(
+    name = "unused",
+    srcs = ["unused.go"],
+    importpath = "test",
+)
+
+-- valid.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools // checked by the test
+}
+
+-- no_reason.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools
+}
+
+-- unknown.go --
+package test
+
+func F() bool {
+	return true || true //nolint:bools,unknown // checked by the test
+}
+
+-- unused.go --
+package test
+
+func F() bool {
+	return true //nolint:bools // no longer needed
+}
+`,
+	})
+}
+
+func TestStrictNolint(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:valid"); err != nil {
+		t.Fatalf("unexpected failure for valid directive: %v", err)
+	}
+
+	for _, tc := range []struct {
+		target, want string
+	}{
+		{"//:no_reason", "no_reason.go:4:22: nolint directive must explain why the diagnostics are suppressed"},
+		{"//:unknown", "unknown.go:4:22: nolint directive names unknown analyzer unknown (nolint)"},
+		{"//:unused", "unused.go:4:14: nolint directive is unused for bools (nolint)"},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			out, err := bazel_testing.BazelCmd("build", tc.target).CombinedOutput()
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(string(out), tc.want) {
+				t.Errorf("output does not contain %q:\n%s", tc.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+)
+
+-- lib.go --
+package lib
+
+import "fmt"
+
+func Greet(name string) string {
+	return fmt.Sprintf("Hello, %s!", name)
+}
+
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func TestGreet(t *testing.T) {
+	if got := Greet("nogo"); got != "Hello, nogo!" {
+		t.Errorf("got %q", got)
+	}
+}
+`,
+	})
+}
+
+type profile struct {
+	Package   string     `json:"package"`
+	Total     int64      `json:"total_ns"`
+	TypeCheck int64      `json:"type_check_ns"`
+	Analyzers []analyzer `json:"analyzers"`
+}
+
+type analyzer struct {
+	Name string `json:"name"`
+}
+
+type summary struct {
+	Packages  int `json:"packages"`
+	Analyzers []struct {
+		Name     string `json:"name"`
+		Packages int    `json:"packages"`
+	} `json:"analyzers"`
+}
+
+func TestProfile(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--output_groups=nogo_profile", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	if profiles := findProfiles(t); len(profiles) != 0 {
+		t.Fatalf("unexpected profiles without --@io_bazel_rules_go//go/config:nogo_profile: %v", profiles)
+	}
+
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:nogo_profile", "--output_groups=nogo_profile", "//:lib", "//:lib_test"); err != nil {
+		t.Fatal(err)
+	}
+	profiles := findProfiles(t)
+	if len(profiles) == 0 {
+		t.Fatal("no profiles written")
+	}
+	var libProfile *profile
+	for _, path := range profiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if p.Package == "example.com/lib" {
+			libProfile = &p
+		}
+	}
+	if libProfile == nil {
+		t.Fatalf("no profile for example.com/lib in %v", profiles)
+	}
+	if libProfile.Total <= 0 || libProfile.TypeCheck <= 0 {
+		t.Errorf("got total time %d and type check time %d, want positive times", libProfile.Total, libProfile.TypeCheck)
+	}
+	if !hasAnalyzer(libProfile.Analyzers, "printf") {
+		t.Errorf("profile doesn't contain the printf analyzer: %+v", libProfile.Analyzers)
+	}
+
+	out, err := bazel_testing.BazelOutput("run", "@io_bazel_rules_go//go/tools/nogo_profile", "--", "-json", bazelBin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s summary
+	if err := json.Unmarshal(out, &s); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if s.Packages < 2 {
+		t.Errorf("got %d packages, want at least the library and its test", s.Packages)
+	}
+	found := false
+	for _, a := range s.Analyzers {
+		if a.Name == "printf" {
+			found = true
+			if a.Packages != s.Packages {
+				t.Errorf("printf ran on %d of %d packages", a.Packages, s.Packages)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("summary doesn't contain the printf analyzer: %s", out)
+	}
+}
+
+func hasAnalyzer(analyzers []analyzer, name string) bool {
+	for _, a := range analyzers {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func findProfiles(t *testing.T) []string {
+	t.Helper()
+	// bazel-bin is usually a symlink, which filepath.Walk does not follow.
+	bin, err := filepath.EvalSymlinks(bazelBin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profiles []string
+	err = filepath.Walk(bin, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".nogo.profile.json") {
+			profiles = append(profiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profiles
+}
+
+func bazelBin(t *testing.T) string {
+	t.Helper()
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package severity_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "nogo")
+
+nogo(
+    name = "nogo",
+    vet = True,
+    config = "config.json",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "has_warnings",
+    srcs = ["has_warnings.go"],
+    importpath = "example.com/has_warnings",
+)
+
+go_library(
+    name = "has_errors",
+    srcs = ["has_errors.go"],
+    importpath = "example.com/has_errors",
+)
+
+-- config.json --
+{
+  "bools": {
+    "severity": "warning"
+  }
+}
+
+-- has_warnings.go --
+package has_warnings
+
+func F() bool {
+	return true || true
+}
+
+-- has_errors.go --
+package has_errors
+
+func F() bool {
+	return F == nil || true || true
+}
+`,
+	})
+}
+
+func TestWarningsDontFailBuild(t *testing.T) {
+	out, err := bazel_testing.BazelCmd("build", "--output_groups=+nogo_findings", "//:has_warnings").CombinedOutput()
+	if err != nil {
+		t.Fatalf("unexpected failure: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "has_warnings.go:4:9: warning: redundant or: true || true (bools)") {
+		t.Errorf("output does not contain warning:\n%s", out)
+	}
+
+	bin, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(strings.TrimSpace(string(bin)), "has_warnings.nogo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings struct {
+		Findings []struct {
+			Analyzer string `json:"analyzer"`
+			Severity string `json:"severity"`
+		} `json:"findings"`
+		Failed bool `json:"failed"`
+	}
+	if err := json.Unmarshal(data, &findings); err != nil {
+		t.Fatal(err)
+	}
+	if len(findings.Findings) != 1 || findings.Findings[0].Analyzer != "bools" || findings.Findings[0].Severity != "warning" {
+		t.Errorf("unexpected findings: %+v", findings.Findings)
+	}
+	if findings.Failed {
+		t.Error("warnings are marked as failing the build")
+	}
+}
+
+func TestErrorsFailBuild(t *testing.T) {
+	out, err := bazel_testing.BazelCmd("build", "//:has_errors").CombinedOutput()
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(string(out), "has_errors.go:4:9: comparison of function F == nil is always false (nilfunc)") {
+		t.Errorf("output does not contain error:\n%s", out)
+	}
+	if !strings.Contains(string(out), "warning: redundant or: true || true (bools)") {
+		t.Errorf("output does not contain warning:\n%s", out)
+	}
+}
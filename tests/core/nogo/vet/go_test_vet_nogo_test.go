@@ -0,0 +1,146 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_test_vet_nogo_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test", "nogo")
+
+nogo(
+    name = "nogo",
+    visibility = ["//visibility:public"],
+    deps = ["@org_golang_x_tools//go/analysis/passes/bools"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "on_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+    vet = "on",
+)
+
+go_test(
+    name = "off_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+    vet = "off",
+)
+
+go_test(
+    name = "bools_test",
+    srcs = ["bools_test.go"],
+    embed = [":lib"],
+    vet = "on",
+)
+
+-- lib.go --
+package lib
+
+import "fmt"
+
+func Describe(n int) string {
+	return fmt.Sprintf("%d", n)
+}
+
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	t.Logf("%d", Describe(1)) // printf error.
+}
+
+-- bools_test.go --
+package lib
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	s := Describe(1)
+	if s == "1" || s == "1" { // bools error.
+		t.Log(s)
+	}
+}
+`,
+	})
+}
+
+func Test(t *testing.T) {
+	for _, test := range []struct {
+		desc, target string
+		wantSuccess  bool
+		includes     []string
+		excludes     []string
+	}{
+		{
+			desc:     "on",
+			target:   "//:on_test",
+			includes: []string{"Logf format %d has arg Describe\\(1\\) of wrong type string"},
+		}, {
+			desc:        "off",
+			target:      "//:off_test",
+			wantSuccess: true,
+			excludes:    []string{"wrong type string"},
+		}, {
+			desc:     "nogo",
+			target:   "//:bools_test",
+			includes: []string{"redundant or: s == \"1\" \\|\\| s == \"1\""},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cmd := bazel_testing.BazelCmd("build", test.target)
+			stderr := &bytes.Buffer{}
+			cmd.Stderr = stderr
+			if err := cmd.Run(); err == nil && !test.wantSuccess {
+				t.Fatal("unexpected success")
+			} else if err != nil && test.wantSuccess {
+				t.Fatalf("unexpected error: %v\n%s", err, stderr)
+			}
+
+			for _, pattern := range test.includes {
+				if matched, err := regexp.Match(pattern, stderr.Bytes()); err != nil {
+					t.Fatal(err)
+				} else if !matched {
+					t.Errorf("output did not contain pattern: %s", pattern)
+				}
+			}
+			for _, pattern := range test.excludes {
+				if matched, err := regexp.Match(pattern, stderr.Bytes()); err != nil {
+					t.Fatal(err)
+				} else if matched {
+					t.Errorf("output contained pattern: %s", pattern)
+				}
+			}
+		})
+	}
+}
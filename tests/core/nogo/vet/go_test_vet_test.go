@@ -0,0 +1,181 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_test_vet_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@io_bazel_rules_go//:default_nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "auto_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+)
+
+go_test(
+    name = "on_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+    vet = "on",
+)
+
+go_test(
+    name = "off_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+    vet = "off",
+)
+
+go_test(
+    name = "external_test",
+    srcs = ["external_test.go"],
+    embed = [":lib"],
+    vet = "on",
+)
+
+go_test(
+    name = "clean_test",
+    srcs = ["clean_test.go"],
+    embed = [":lib"],
+    vet = "on",
+)
+
+-- lib.go --
+package lib
+
+import "fmt"
+
+func Describe(n int) string {
+	return fmt.Sprintf("%d", n)
+}
+
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	t.Logf("%d", Describe(1)) // printf error.
+}
+
+-- external_test.go --
+package lib_test
+
+import "testing"
+
+func TestDescribe(t *testing.T) {}
+
+func ExampleNothing() {} // tests error.
+
+-- clean_test.go --
+package lib
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	t.Logf("%s", Describe(1))
+}
+`,
+	})
+}
+
+func Test(t *testing.T) {
+	for _, test := range []struct {
+		desc, target string
+		args         []string
+		wantSuccess  bool
+		includes     []string
+		excludes     []string
+	}{
+		{
+			desc:        "auto_default",
+			target:      "//:auto_test",
+			wantSuccess: true,
+			excludes:    []string{"wrong type string"},
+		}, {
+			desc:     "auto_flag",
+			target:   "//:auto_test",
+			args:     []string{"--@io_bazel_rules_go//go/config:test_vet"},
+			includes: []string{"Logf format %d has arg Describe\\(1\\) of wrong type string"},
+		}, {
+			desc:     "on",
+			target:   "//:on_test",
+			includes: []string{"Logf format %d has arg Describe\\(1\\) of wrong type string"},
+		}, {
+			desc:        "off_flag",
+			target:      "//:off_test",
+			args:        []string{"--@io_bazel_rules_go//go/config:test_vet"},
+			wantSuccess: true,
+			excludes:    []string{"wrong type string"},
+		}, {
+			desc:     "external",
+			target:   "//:external_test",
+			includes: []string{"ExampleNothing refers to unknown identifier: Nothing"},
+		}, {
+			desc:        "clean",
+			target:      "//:clean_test",
+			wantSuccess: true,
+		}, {
+			desc:        "library_not_analyzed",
+			target:      "//:lib",
+			args:        []string{"--@io_bazel_rules_go//go/config:test_vet"},
+			wantSuccess: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			args := append([]string{"build"}, test.args...)
+			cmd := bazel_testing.BazelCmd(append(args, test.target)...)
+			stderr := &bytes.Buffer{}
+			cmd.Stderr = stderr
+			if err := cmd.Run(); err == nil && !test.wantSuccess {
+				t.Fatal("unexpected success")
+			} else if err != nil && test.wantSuccess {
+				t.Fatalf("unexpected error: %v\n%s", err, stderr)
+			}
+
+			for _, pattern := range test.includes {
+				if matched, err := regexp.Match(pattern, stderr.Bytes()); err != nil {
+					t.Fatal(err)
+				} else if !matched {
+					t.Errorf("output did not contain pattern: %s", pattern)
+				}
+			}
+			for _, pattern := range test.excludes {
+				if matched, err := regexp.Match(pattern, stderr.Bytes()); err != nil {
+					t.Fatal(err)
+				} else if matched {
+					t.Errorf("output contained pattern: %s", pattern)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package race_report_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "race_report_test",
+    srcs = ["race_report_test.go"],
+    race = "on",
+)
+
+-- race_report_test.go --
+package race
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRace(t *testing.T) {
+	t.Parallel()
+	x := 0
+	done := make(chan struct{})
+	go func() {
+		x++
+		close(done)
+	}()
+	x++
+	<-done
+}
+
+func TestOther(t *testing.T) {
+	t.Parallel()
+	time.Sleep(100 * time.Millisecond)
+}
+`,
+	})
+}
+
+func TestRaceReport(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:race_report_test"); err == nil {
+		t.Fatal("expected bazel test to have failed")
+	}
+	p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
+	if err != nil {
+		t.Fatalf("could not find testlog root: %s", err)
+	}
+	testlogs := filepath.Join(strings.TrimSpace(string(p)), "race_report_test")
+
+	xml, err := ioutil.ReadFile(filepath.Join(testlogs, "test.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`name="TestRace"`,
+		`<error message="Race detected" type="race">`,
+	} {
+		if !strings.Contains(string(xml), want) {
+			t.Errorf("test.xml does not contain %q:\n%s", want, xml)
+		}
+	}
+
+	r, err := zip.OpenReader(filepath.Join(testlogs, "test.outputs", "outputs.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	found := false
+	for _, f := range r.File {
+		if strings.HasPrefix(f.Name, "races/TestRace_") {
+			found = true
+		}
+		if strings.HasPrefix(f.Name, "races/TestOther_") {
+			t.Errorf("race report attributed to TestOther: %s", f.Name)
+		}
+	}
+	if !found {
+		t.Error("race report of TestRace not found in outputs.zip")
+	}
+}